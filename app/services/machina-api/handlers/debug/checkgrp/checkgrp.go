@@ -8,6 +8,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/lgarciaaco/machina-api/business/broker"
 	"github.com/lgarciaaco/machina-api/business/sys/database"
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
@@ -15,9 +16,10 @@ import (
 
 // Handlers manages the set of check enpoints.
 type Handlers struct {
-	Build string
-	Log   *zap.SugaredLogger
-	DB    *sqlx.DB
+	Build   string
+	Log     *zap.SugaredLogger
+	DB      *sqlx.DB
+	Breaker *broker.Breaker
 }
 
 // Readiness checks if the database is ready and if not will return a 500 status.
@@ -34,10 +36,23 @@ func (h Handlers) Readiness(w http.ResponseWriter, r *http.Request) {
 		statusCode = http.StatusInternalServerError
 	}
 
+	// The service keeps serving stored data while the exchange is down, it
+	// reports itself degraded instead of not ready.
+	var circuit string
+	if h.Breaker != nil {
+		state := h.Breaker.State()
+		circuit = state.String()
+		if state != broker.BreakerClosed && statusCode == http.StatusOK {
+			status = "degraded"
+		}
+	}
+
 	data := struct {
-		Status string `json:"status"`
+		Status  string `json:"status"`
+		Circuit string `json:"circuit,omitempty"`
 	}{
-		Status: status,
+		Status:  status,
+		Circuit: circuit,
 	}
 
 	if err := response(w, statusCode, data); err != nil {
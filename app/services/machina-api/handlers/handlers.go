@@ -37,7 +37,7 @@ type APIMuxConfig struct {
 	Log      *zap.SugaredLogger
 	Auth     *auth.Auth
 	DB       *sqlx.DB
-	Broker   broker.Broker
+	Exchange broker.Exchange
 }
 
 // APIMux constructs an http.Handler with all application routes defined.
@@ -68,10 +68,10 @@ func APIMux(cfg APIMuxConfig, options ...func(opts *Options)) http.Handler {
 
 	// Load the v1 routes.
 	v1.Routes(app, v1.Config{
-		Log:    cfg.Log,
-		Auth:   cfg.Auth,
-		DB:     cfg.DB,
-		Broker: cfg.Broker,
+		Log:      cfg.Log,
+		Auth:     cfg.Auth,
+		DB:       cfg.DB,
+		Exchange: cfg.Exchange,
 	})
 
 	return app
@@ -99,14 +99,15 @@ func DebugStandardLibraryMux() *http.ServeMux {
 // debug application routes for the service. This bypassing the use of the
 // DefaultServerMux. Using the DefaultServerMux would be a security risk since
 // a dependency could inject a handler into our service without us knowing it.
-func DebugMux(build string, log *zap.SugaredLogger, db *sqlx.DB) http.Handler {
+func DebugMux(build string, log *zap.SugaredLogger, db *sqlx.DB, brk *broker.Breaker) http.Handler {
 	mux := DebugStandardLibraryMux()
 
 	// Register debug check endpoints.
 	cgh := checkgrp.Handlers{
-		Build: build,
-		Log:   log,
-		DB:    db,
+		Build:   build,
+		Log:     log,
+		DB:      db,
+		Breaker: brk,
 	}
 	mux.HandleFunc("/debug/readiness", cgh.Readiness)
 	mux.HandleFunc("/debug/liveness", cgh.Liveness)
@@ -29,10 +29,10 @@ import (
 
 // Config contains all the mandatory systems required by handlers.
 type Config struct {
-	Log    *zap.SugaredLogger
-	Auth   *auth.Auth
-	DB     *sqlx.DB
-	Broker broker.Broker
+	Log      *zap.SugaredLogger
+	Auth     *auth.Auth
+	DB       *sqlx.DB
+	Exchange broker.Exchange
 }
 
 // Routes binds all the version 1 routes.
@@ -56,7 +56,7 @@ func Routes(app *web.App, cfg Config) {
 
 	// Register symbol endpoints
 	sbl := symbolgrp.Handlers{
-		Symbol: symbol.NewCore(cfg.Log, cfg.DB, cfg.Broker),
+		Symbol: symbol.NewCore(cfg.Log, cfg.DB, cfg.Exchange),
 	}
 	app.Handle(http.MethodGet, version, "/symbols/:page/:rows", sbl.Query)
 	app.Handle(http.MethodGet, version, "/symbols/:id", sbl.QueryByID)
@@ -64,7 +64,7 @@ func Routes(app *web.App, cfg Config) {
 
 	// Register candle endpoints
 	cgh := candlegrp.Handlers{
-		Candle: candle.NewCore(cfg.Log, cfg.DB, cfg.Broker),
+		Candle: candle.NewCore(cfg.Log, cfg.DB, cfg.Exchange),
 	}
 	app.Handle(http.MethodGet, version, "/candles/:page/:rows", cgh.Query, mid.Cors("*"))
 	app.Handle(http.MethodGet, version, "/candles/:symbol/:interval/:page/:rows", cgh.QueryBySymbolAndInterval, mid.Cors("*"))
@@ -72,19 +72,25 @@ func Routes(app *web.App, cfg Config) {
 
 	// Register position endpoints
 	pos := positiongrp.Handlers{
-		Position: position.NewCore(cfg.Log, cfg.DB),
+		Position: position.NewCore(cfg.Log, cfg.DB, cfg.Exchange),
 	}
 	app.Handle(http.MethodGet, version, "/positions/:page/:rows", pos.Query, authen, mid.Cors("*"))
 	app.Handle(http.MethodGet, version, "/positions/:id", pos.QueryByID, authen, mid.Cors("*"))
 	app.Handle(http.MethodPost, version, "/positions", pos.Create, authen, mid.Cors("*"))
 	app.Handle(http.MethodDelete, version, "/positions/:id", pos.Close, authen, mid.Cors("*"))
+	app.Handle(http.MethodGet, version, "/positions/:id/pnl", pos.PnL, authen, mid.Cors("*"))
+	app.Handle(http.MethodPut, version, "/positions/:id/trail", pos.SetTrail, authen, mid.Cors("*"))
+	app.Handle(http.MethodDelete, version, "/positions/:id/trail", pos.ClearTrail, authen, mid.Cors("*"))
 
 	// Register order endpoints
 	odr := ordergrp.Handlers{
-		Order:    order.NewCore(cfg.Log, cfg.DB, cfg.Broker),
-		Position: position.NewCore(cfg.Log, cfg.DB),
+		Order:    order.NewCore(cfg.Log, cfg.DB, cfg.Exchange),
+		Position: position.NewCore(cfg.Log, cfg.DB, cfg.Exchange),
 	}
 	app.Handle(http.MethodGet, version, "/orders/:page/:rows", odr.Query, authen, mid.Cors("*"))
 	app.Handle(http.MethodGet, version, "/orders/:id", odr.QueryByID, authen, mid.Cors("*"))
 	app.Handle(http.MethodPost, version, "/orders", odr.Create, authen, mid.Cors("*"))
+	app.Handle(http.MethodDelete, version, "/orders/:id", odr.Cancel, authen, mid.Cors("*"))
+	app.Handle(http.MethodDelete, version, "/orders/symbol/:symbol", odr.CancelBySymbol, authen, mid.Cors("*"))
+	app.Handle(http.MethodDelete, version, "/positions/:id/orders", odr.CancelByPosition, authen, mid.Cors("*"))
 }
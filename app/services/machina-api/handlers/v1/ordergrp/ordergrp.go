@@ -7,9 +7,11 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/lgarciaaco/machina-api/business/core/position"
 
+	"github.com/lgarciaaco/machina-api/business/broker"
 	"github.com/lgarciaaco/machina-api/business/core/order"
 	"github.com/lgarciaaco/machina-api/business/sys/auth"
 	v1Web "github.com/lgarciaaco/machina-api/business/web/v1"
@@ -39,6 +41,11 @@ func (h Handlers) Create(ctx context.Context, w http.ResponseWriter, r *http.Req
 		return fmt.Errorf("unable to decode payload: %w", err)
 	}
 
+	nOdr.IdempotencyKey, err = v1Web.IdempotencyKey(r)
+	if err != nil {
+		return err
+	}
+
 	// If it is not possible to fetch the position referenced in the document
 	// we return 404
 	pos, err := h.Position.QueryByID(ctx, nOdr.PositionID)
@@ -47,6 +54,7 @@ func (h Handlers) Create(ctx context.Context, w http.ResponseWriter, r *http.Req
 	}
 	nOdr.SymbolID = pos.SymbolID
 	nOdr.Symbol = pos.Symbol
+	nOdr.UserID = pos.UserID
 
 	// If you are not an admin and looking to create an order for a position that doesn't belong
 	// to you
@@ -56,6 +64,9 @@ func (h Handlers) Create(ctx context.Context, w http.ResponseWriter, r *http.Req
 
 	sOdr, err := h.Order.Create(ctx, nOdr, v.Now)
 	if err != nil {
+		if reqErr := toRequestError(err); reqErr != nil {
+			return reqErr
+		}
 		return fmt.Errorf("orders[%+v]: %w", &sOdr, err)
 	}
 
@@ -80,16 +91,21 @@ func (h Handlers) Query(ctx context.Context, w http.ResponseWriter, r *http.Requ
 		return v1Web.NewRequestError(fmt.Errorf("invalid rows format, rows[%s]", rows), http.StatusBadRequest)
 	}
 
+	filter, orderBy, err := parseFilter(r)
+	if err != nil {
+		return err
+	}
+
 	var ords []order.Order
 
 	// If you are an admin you get a list with positions for all users.
 	if claims.Authorized(auth.RoleAdmin) {
-		ords, err = h.Order.Query(ctx, pageNumber, rowsPerPage)
+		ords, err = h.Order.Query(ctx, filter, orderBy, pageNumber, rowsPerPage)
 		if err != nil {
 			return fmt.Errorf("unable to query for products: %w", err)
 		}
 	} else {
-		ords, err = h.Order.QueryByUser(ctx, pageNumber, rowsPerPage, claims.Subject)
+		ords, err = h.Order.QueryByUser(ctx, filter, orderBy, pageNumber, rowsPerPage, claims.Subject)
 		if err != nil {
 			return fmt.Errorf("unable to query for products: %w", err)
 		}
@@ -130,3 +146,176 @@ func (h Handlers) QueryByID(ctx context.Context, w http.ResponseWriter, r *http.
 
 	return web.Respond(ctx, w, odr, http.StatusOK)
 }
+
+// Cancel cancels an order that is still active on the exchange.
+func (h Handlers) Cancel(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		return v1Web.NewRequestError(auth.ErrForbidden, http.StatusForbidden)
+	}
+
+	odrID := web.Param(r, "id")
+
+	odr, err := h.Order.QueryByID(ctx, odrID)
+	if err != nil {
+		switch {
+		case errors.Is(err, order.ErrInvalidID):
+			return v1Web.NewRequestError(err, http.StatusBadRequest)
+		case errors.Is(err, order.ErrNotFound):
+			return v1Web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return fmt.Errorf("ID[%s]: %w", odrID, err)
+		}
+	}
+
+	// If you are not an admin and looking to cancel an order of someone other than yourself.
+	pos, err := h.Position.QueryByID(ctx, odr.PositionID)
+	if err != nil {
+		return fmt.Errorf("unable to fetch position[%s]", odr.PositionID)
+	}
+	if !claims.Authorized(auth.RoleAdmin) && claims.Subject != pos.UserID {
+		return v1Web.NewRequestError(auth.ErrForbidden, http.StatusForbidden)
+	}
+
+	odr, err = h.Order.Cancel(ctx, odrID, pos.Symbol)
+	if err != nil {
+		if reqErr := toRequestError(err); reqErr != nil {
+			return reqErr
+		}
+		return fmt.Errorf("ID[%s]: %w", odrID, err)
+	}
+
+	return web.Respond(ctx, w, odr, http.StatusOK)
+}
+
+// CancelByPosition cancels the orders of a position that are still active on
+// the exchange.
+func (h Handlers) CancelByPosition(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		return v1Web.NewRequestError(auth.ErrForbidden, http.StatusForbidden)
+	}
+
+	posID := web.Param(r, "id")
+
+	pos, err := h.Position.QueryByID(ctx, posID)
+	if err != nil {
+		switch {
+		case errors.Is(err, position.ErrInvalidID):
+			return v1Web.NewRequestError(err, http.StatusBadRequest)
+		case errors.Is(err, position.ErrNotFound):
+			return v1Web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return fmt.Errorf("ID[%s]: %w", posID, err)
+		}
+	}
+
+	// If you are not an admin and looking to cancel orders of someone other than yourself.
+	if !claims.Authorized(auth.RoleAdmin) && claims.Subject != pos.UserID {
+		return v1Web.NewRequestError(auth.ErrForbidden, http.StatusForbidden)
+	}
+
+	ords, err := h.Order.CancelByPosition(ctx, posID, pos.Symbol)
+	if err != nil {
+		if reqErr := toRequestError(err); reqErr != nil {
+			return reqErr
+		}
+		return fmt.Errorf("ID[%s]: %w", posID, err)
+	}
+
+	return web.Respond(ctx, w, ords, http.StatusOK)
+}
+
+// CancelBySymbol cancels the orders of a symbol that are still active on the
+// exchange. If an administrator is issuing the request every open order of the
+// symbol is canceled, otherwise only the ones from the logged user.
+func (h Handlers) CancelBySymbol(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		return v1Web.NewRequestError(auth.ErrForbidden, http.StatusForbidden)
+	}
+
+	symbol := strings.ToUpper(web.Param(r, "symbol"))
+
+	var ords []order.Order
+	if claims.Authorized(auth.RoleAdmin) {
+		ords, err = h.Order.CancelBySymbol(ctx, symbol)
+	} else {
+		ords, err = h.Order.CancelByUser(ctx, claims.Subject, symbol)
+	}
+	if err != nil {
+		if reqErr := toRequestError(err); reqErr != nil {
+			return reqErr
+		}
+		return fmt.Errorf("symbol[%s]: %w", symbol, err)
+	}
+
+	return web.Respond(ctx, w, ords, http.StatusOK)
+}
+
+// toRequestError maps the errors of the exchange to the response the client
+// gets. It returns nil for errors that are not caused by the request.
+func toRequestError(err error) error {
+	switch {
+	case errors.Is(err, order.ErrNotOpen):
+		return v1Web.NewRequestError(order.ErrNotOpen, http.StatusConflict)
+	case errors.Is(err, order.ErrIdempotencyConflict):
+		return v1Web.NewRequestError(order.ErrIdempotencyConflict, http.StatusConflict)
+	case errors.Is(err, broker.ErrUnknownOrder):
+		return v1Web.NewRequestError(broker.ErrUnknownOrder, http.StatusConflict)
+	case errors.Is(err, broker.ErrInsufficientBalance):
+		return v1Web.NewRequestError(apiError(err), http.StatusUnprocessableEntity)
+	case errors.Is(err, broker.ErrFilterFailure):
+		return v1Web.NewRequestError(apiError(err), http.StatusBadRequest)
+	case errors.Is(err, broker.ErrUnknownSymbol):
+		return v1Web.NewRequestError(broker.ErrUnknownSymbol, http.StatusBadRequest)
+	case errors.Is(err, broker.ErrUnsupportedOrderType):
+		return v1Web.NewRequestError(broker.ErrUnsupportedOrderType, http.StatusBadRequest)
+	case errors.Is(err, broker.ErrRateLimited):
+		return v1Web.NewRequestError(broker.ErrRateLimited, http.StatusTooManyRequests)
+	case errors.Is(err, broker.ErrIPBanned):
+		return v1Web.NewRequestError(broker.ErrIPBanned, http.StatusTooManyRequests)
+	case errors.Is(err, broker.ErrCircuitOpen):
+		return v1Web.NewRequestError(broker.ErrCircuitOpen, http.StatusServiceUnavailable)
+	}
+	return nil
+}
+
+// apiError returns the error binance answered with, so the client gets its
+// message. Errors that don't come from binance, like the ones of the paper
+// broker, are returned as they are.
+func apiError(err error) error {
+	if ae := broker.GetAPIError(err); ae != nil {
+		return ae
+	}
+	return err
+}
+
+// parseFilter reads the filter and the sorting of a query from the url query
+// parameters: symbol, status, side, position_id, created_after and
+// created_before to filter, sort and direction to sort.
+func parseFilter(r *http.Request) (order.QueryFilter, order.OrderBy, error) {
+	values := r.URL.Query()
+
+	filter := order.QueryFilter{
+		Symbol:     strings.ToUpper(values.Get("symbol")),
+		Status:     strings.ToUpper(values.Get("status")),
+		Side:       strings.ToUpper(values.Get("side")),
+		PositionID: values.Get("position_id"),
+	}
+
+	var err error
+	if filter.CreatedAfter, err = v1Web.QueryTime(r, "created_after"); err != nil {
+		return order.QueryFilter{}, order.OrderBy{}, err
+	}
+	if filter.CreatedBefore, err = v1Web.QueryTime(r, "created_before"); err != nil {
+		return order.QueryFilter{}, order.OrderBy{}, err
+	}
+
+	orderBy := order.OrderBy{
+		Field:     values.Get("sort"),
+		Direction: values.Get("direction"),
+	}
+
+	return filter, orderBy, nil
+}
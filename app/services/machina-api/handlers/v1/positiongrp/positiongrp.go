@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	v1Web "github.com/lgarciaaco/machina-api/business/web/v1"
 
@@ -39,8 +40,16 @@ func (h Handlers) Create(ctx context.Context, w http.ResponseWriter, r *http.Req
 	}
 	nPos.UserID = claims.Subject
 
+	nPos.IdempotencyKey, err = v1Web.IdempotencyKey(r)
+	if err != nil {
+		return err
+	}
+
 	sPos, err := h.Position.Create(ctx, nPos, v.Now)
 	if err != nil {
+		if errors.Is(err, position.ErrIdempotencyConflict) {
+			return v1Web.NewRequestError(err, http.StatusConflict)
+		}
 		return fmt.Errorf("positions[%+v]: %w", &sPos, err)
 	}
 
@@ -67,16 +76,21 @@ func (h Handlers) Query(ctx context.Context, w http.ResponseWriter, r *http.Requ
 		return v1Web.NewRequestError(auth.ErrForbidden, http.StatusForbidden)
 	}
 
+	filter, orderBy, err := parseFilter(r)
+	if err != nil {
+		return err
+	}
+
 	var poss []position.Position
 
 	// If you are an admin you get a list with positions for all users.
 	if claims.Authorized(auth.RoleAdmin) {
-		poss, err = h.Position.Query(ctx, pageNumber, rowsPerPage)
+		poss, err = h.Position.Query(ctx, filter, orderBy, pageNumber, rowsPerPage)
 		if err != nil {
 			return fmt.Errorf("unable to query for products: %w", err)
 		}
 	} else {
-		poss, err = h.Position.QueryByUser(ctx, pageNumber, rowsPerPage, claims.Subject)
+		poss, err = h.Position.QueryByUser(ctx, filter, orderBy, pageNumber, rowsPerPage, claims.Subject)
 		if err != nil {
 			return fmt.Errorf("unable to query for products: %w", err)
 		}
@@ -114,8 +128,14 @@ func (h Handlers) QueryByID(ctx context.Context, w http.ResponseWriter, r *http.
 	return web.Respond(ctx, w, pos, http.StatusOK)
 }
 
-// Close closes a position setting its balance to 0. Positions persist in database.
+// Close closes a position setting its balance to 0, with a market order for
+// the quantity it holds. Positions persist in database.
 func (h Handlers) Close(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
 	claims, err := auth.GetClaims(ctx)
 	if err != nil {
 		return v1Web.NewRequestError(auth.ErrForbidden, http.StatusForbidden)
@@ -140,12 +160,14 @@ func (h Handlers) Close(ctx context.Context, w http.ResponseWriter, r *http.Requ
 		return v1Web.NewRequestError(auth.ErrForbidden, http.StatusForbidden)
 	}
 
-	if err := h.Position.Close(ctx, posID); err != nil {
+	if err := h.Position.Close(ctx, posID, v.Now); err != nil {
 		switch {
 		case errors.Is(err, position.ErrInvalidID):
 			return v1Web.NewRequestError(err, http.StatusBadRequest)
 		case errors.Is(err, position.ErrNotFound):
 			return v1Web.NewRequestError(err, http.StatusNotFound)
+		case errors.Is(err, position.ErrAlreadyClosed), errors.Is(err, position.ErrPendingOrders), errors.Is(err, position.ErrNotFilled):
+			return v1Web.NewRequestError(err, http.StatusConflict)
 		default:
 			return fmt.Errorf("ID[%s]: %w", posID, err)
 		}
@@ -153,3 +175,117 @@ func (h Handlers) Close(ctx context.Context, w http.ResponseWriter, r *http.Requ
 
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
 }
+
+// PnL returns the profit and loss of a position, with the share of each of
+// its orders.
+func (h Handlers) PnL(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	posID := web.Param(r, "id")
+	pos, err := h.authorize(ctx, posID)
+	if err != nil {
+		return err
+	}
+
+	pnl, err := h.Position.PnL(ctx, pos)
+	if err != nil {
+		return fmt.Errorf("ID[%s]: %w", posID, err)
+	}
+
+	return web.Respond(ctx, w, pnl, http.StatusOK)
+}
+
+// SetTrail sets the trailing stop of a position. The position is closed with
+// a market order once the price moves back by the trail distance.
+func (h Handlers) SetTrail(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	posID := web.Param(r, "id")
+	if _, err := h.authorize(ctx, posID); err != nil {
+		return err
+	}
+
+	var nTrl position.NewTrail
+	if err := web.Decode(r, &nTrl); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	pos, err := h.Position.SetTrail(ctx, posID, nTrl)
+	if err != nil {
+		if errors.Is(err, position.ErrAlreadyClosed) {
+			return v1Web.NewRequestError(err, http.StatusConflict)
+		}
+		return fmt.Errorf("ID[%s]: %w", posID, err)
+	}
+
+	return web.Respond(ctx, w, pos, http.StatusOK)
+}
+
+// ClearTrail removes the trailing stop of a position.
+func (h Handlers) ClearTrail(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	posID := web.Param(r, "id")
+	if _, err := h.authorize(ctx, posID); err != nil {
+		return err
+	}
+
+	if err := h.Position.ClearTrail(ctx, posID); err != nil {
+		if errors.Is(err, position.ErrAlreadyClosed) {
+			return v1Web.NewRequestError(err, http.StatusConflict)
+		}
+		return fmt.Errorf("ID[%s]: %w", posID, err)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// authorize checks the position exists and belongs to the user, unless the
+// user is an admin. It returns the position.
+func (h Handlers) authorize(ctx context.Context, posID string) (position.Position, error) {
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		return position.Position{}, v1Web.NewRequestError(auth.ErrForbidden, http.StatusForbidden)
+	}
+
+	pos, err := h.Position.QueryByID(ctx, posID)
+	if err != nil {
+		switch {
+		case errors.Is(err, position.ErrInvalidID):
+			return position.Position{}, v1Web.NewRequestError(err, http.StatusBadRequest)
+		case errors.Is(err, position.ErrNotFound):
+			return position.Position{}, v1Web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return position.Position{}, fmt.Errorf("ID[%s]: %w", posID, err)
+		}
+	}
+
+	if !claims.Authorized(auth.RoleAdmin) && claims.Subject != pos.UserID {
+		return position.Position{}, v1Web.NewRequestError(auth.ErrForbidden, http.StatusForbidden)
+	}
+
+	return pos, nil
+}
+
+// parseFilter reads the filter and the sorting of a query from the url query
+// parameters: symbol, status, side, position_id, created_after and
+// created_before to filter, sort and direction to sort.
+func parseFilter(r *http.Request) (position.QueryFilter, position.OrderBy, error) {
+	values := r.URL.Query()
+
+	filter := position.QueryFilter{
+		Symbol:     strings.ToUpper(values.Get("symbol")),
+		Status:     strings.ToUpper(values.Get("status")),
+		Side:       strings.ToUpper(values.Get("side")),
+		PositionID: values.Get("position_id"),
+	}
+
+	var err error
+	if filter.CreatedAfter, err = v1Web.QueryTime(r, "created_after"); err != nil {
+		return position.QueryFilter{}, position.OrderBy{}, err
+	}
+	if filter.CreatedBefore, err = v1Web.QueryTime(r, "created_before"); err != nil {
+		return position.QueryFilter{}, position.OrderBy{}, err
+	}
+
+	orderBy := position.OrderBy{
+		Field:     values.Get("sort"),
+		Direction: values.Get("direction"),
+	}
+
+	return filter, orderBy, nil
+}
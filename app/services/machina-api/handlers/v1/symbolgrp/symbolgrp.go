@@ -10,6 +10,7 @@ import (
 
 	v1Web "github.com/lgarciaaco/machina-api/business/web/v1"
 
+	"github.com/lgarciaaco/machina-api/business/broker"
 	"github.com/lgarciaaco/machina-api/business/core/symbol"
 	"github.com/lgarciaaco/machina-api/foundation/web"
 )
@@ -31,6 +32,10 @@ func (h Handlers) Create(ctx context.Context, w http.ResponseWriter, r *http.Req
 		switch {
 		case errors.Is(err, symbol.ErrInvalidSymbol):
 			return v1Web.NewRequestError(err, http.StatusBadRequest)
+		case errors.Is(err, broker.ErrRateLimited):
+			return v1Web.NewRequestError(broker.ErrRateLimited, http.StatusTooManyRequests)
+		case errors.Is(err, broker.ErrIPBanned):
+			return v1Web.NewRequestError(broker.ErrIPBanned, http.StatusTooManyRequests)
 		default:
 			return fmt.Errorf("symbol[%+v]: %w", &sSbl, err)
 		}
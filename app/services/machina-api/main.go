@@ -6,6 +6,7 @@ import (
 	"expvar" // Calls init function.
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"runtime"
@@ -16,6 +17,8 @@ import (
 
 	"github.com/lgarciaaco/machina-api/app/services/machina-api/sync"
 	"github.com/lgarciaaco/machina-api/business/core/candle"
+	"github.com/lgarciaaco/machina-api/business/core/order"
+	"github.com/lgarciaaco/machina-api/business/core/position"
 	"github.com/lgarciaaco/machina-api/business/core/symbol"
 
 	"github.com/lgarciaaco/machina-api/business/broker/encode"
@@ -102,8 +105,31 @@ func run(log *zap.SugaredLogger) error {
 			DisableTLS   bool   `conf:"default:true"`
 		}
 		Broker struct {
-			BinanceKey    string `conf:"mask,required"`
-			BinanceSecret string `conf:"mask,required"`
+			BinanceKey       string             `conf:"mask,help:api key required unless the environment is paper"`
+			BinanceSecret    string             `conf:"mask,help:hmac secret required by the hmac signer"`
+			Signer           string             `conf:"default:hmac,help:one of hmac ed25519 rsa"`
+			KeyFile          string             `conf:"help:PEM private key of the ed25519 or rsa signer"`
+			KeyID            string             `conf:"help:id of the rsa private key in the keystore, used when no key file is set"`
+			Environment      string             `conf:"default:testnet,help:one of live testnet dryrun paper"`
+			BaseURL          string             `conf:"help:overrides the api url derived from the environment"`
+			WeightLimit      int                `conf:"default:1200,help:request weight allowed per minute"`
+			OrderLimit       int                `conf:"default:50,help:orders allowed per 10 seconds"`
+			RecvWindow       time.Duration      `conf:"default:5s,help:how long a signed request stays valid"`
+			TimeSync         time.Duration      `conf:"default:10m,help:how often the server time offset is refreshed"`
+			Timeout          time.Duration      `conf:"default:10s,help:timeout of a single request to binance"`
+			MaxConns         int                `conf:"default:10,help:size of the idle connection pool"`
+			Proxy            string             `conf:"help:url of a proxy to route binance requests through"`
+			Stream           bool               `conf:"default:true,help:receive candles from the kline streams instead of polling"`
+			StreamURL        string             `conf:"help:overrides the streams url derived from the environment"`
+			UserStream       bool               `conf:"default:true,help:receive order and balance updates from the user data stream"`
+			PaperFee         float64            `conf:"default:0.001,help:fraction of the quote amount the paper broker charges per fill"`
+			PaperSlippage    float64            `conf:"default:0.0005,help:fraction the paper broker moves the fill price against the order"`
+			PaperBalances    map[string]float64 `conf:"default:USDT:10000,help:initial paper balances as asset:amount;asset:amount"`
+			BreakerThreshold int                `conf:"default:5,help:consecutive exchange failures that open the circuit breaker"`
+			BreakerCooldown  time.Duration      `conf:"default:30s,help:how long the circuit breaker stays open before probing the exchange"`
+			Reconcile        time.Duration      `conf:"default:5m,help:how often orders are reconciled with the exchange"`
+			ReconcileWindow  time.Duration      `conf:"default:24h,help:how old the orders reconciled with the exchange can be"`
+			Trail            time.Duration      `conf:"default:1m,help:how often trailing stops are moved with the last candle"`
 		}
 		Zipkin struct {
 			ReporterURI string  `conf:"default:http://localhost:9411/api/v2/spans"`
@@ -160,11 +186,75 @@ func run(log *zap.SugaredLogger) error {
 
 	// =========================================================================
 	// Binance broker support
-	broker := broker.TestBinance{
-		APIKey: cfg.Broker.BinanceKey,
-		Signer: &encode.Hmac{Key: []byte(cfg.Broker.BinanceSecret)},
+
+	env, err := broker.ParseEnvironment(cfg.Broker.Environment)
+	if err != nil {
+		return fmt.Errorf("parsing broker environment: %w", err)
+	}
+	log.Infow("startup", "status", "initializing broker support", "environment", env)
+
+	var proxy *url.URL
+	if cfg.Broker.Proxy != "" {
+		if proxy, err = url.Parse(cfg.Broker.Proxy); err != nil {
+			return fmt.Errorf("parsing broker proxy: %w", err)
+		}
+	}
+
+	stream := broker.NewStream(broker.StreamConfig{
+		Environment: env,
+		BaseURL:     cfg.Broker.StreamURL,
+		ErrorHandler: func(err error) {
+			log.Errorw("stream", "ERROR", err)
+		},
+	})
+
+	// The paper broker only reads public market data from binance, it needs
+	// neither an api key nor a signer.
+	var signer encode.Signer
+	if env != broker.EnvPaper {
+		if cfg.Broker.BinanceKey == "" {
+			return errors.New("broker requires an api key")
+		}
+
+		switch cfg.Broker.Signer {
+		case encode.TypeHmac:
+			if cfg.Broker.BinanceSecret == "" {
+				return errors.New("broker hmac signer requires a secret")
+			}
+			signer = &encode.Hmac{Key: []byte(cfg.Broker.BinanceSecret)}
+		case encode.TypeEd25519:
+			if signer, err = encode.LoadEd25519(cfg.Broker.KeyFile); err != nil {
+				return fmt.Errorf("loading broker ed25519 key: %w", err)
+			}
+		case encode.TypeRSA:
+			if cfg.Broker.KeyFile != "" {
+				signer, err = encode.LoadRSA(cfg.Broker.KeyFile)
+			} else {
+				signer, err = encode.NewRSAFromKeyStore(ks, cfg.Broker.KeyID)
+			}
+			if err != nil {
+				return fmt.Errorf("loading broker rsa key: %w", err)
+			}
+		default:
+			return fmt.Errorf("unknown broker signer %q", cfg.Broker.Signer)
+		}
+		log.Infow("startup", "status", "initializing broker signer", "signer", cfg.Broker.Signer)
 	}
 
+	binance := broker.NewBinance(broker.Config{
+		APIKey:      cfg.Broker.BinanceKey,
+		Signer:      signer,
+		Environment: env,
+		BaseURL:     cfg.Broker.BaseURL,
+		WeightLimit: cfg.Broker.WeightLimit,
+		OrderLimit:  cfg.Broker.OrderLimit,
+		RecvWindow:  cfg.Broker.RecvWindow,
+		TimeSync:    cfg.Broker.TimeSync,
+		Timeout:     cfg.Broker.Timeout,
+		MaxConns:    cfg.Broker.MaxConns,
+		Proxy:       proxy,
+	})
+
 	// =========================================================================
 	// Database Support
 
@@ -188,15 +278,72 @@ func run(log *zap.SugaredLogger) error {
 		db.Close()
 	}()
 
+	var exchange broker.Exchange = binance
+	if env == broker.EnvPaper {
+		log.Infow("startup", "status", "initializing paper broker", "fee", cfg.Broker.PaperFee, "slippage", cfg.Broker.PaperSlippage)
+		exchange = broker.NewPaper(broker.PaperConfig{
+			Log:      log,
+			DB:       db,
+			Market:   binance,
+			Fee:      cfg.Broker.PaperFee,
+			Slippage: cfg.Broker.PaperSlippage,
+			Balances: cfg.Broker.PaperBalances,
+		})
+	}
+
+	// Fail fast while the exchange is down instead of waiting for every call
+	// to time out.
+	breaker := broker.NewBreaker(exchange, broker.BreakerConfig{
+		Threshold: cfg.Broker.BreakerThreshold,
+		Cooldown:  cfg.Broker.BreakerCooldown,
+		OnStateChange: func(from, to broker.BreakerState) {
+			log.Infow("broker", "status", "circuit breaker state changed", "from", from, "to", to)
+		},
+	})
+	exchange = breaker
+
 	// =========================================================================
 	// Sync support
 	sCtx, sCancel := context.WithCancel(context.Background())
 	synchronizer := sync.CandleSynchronizer{
 		Log:    log,
-		Symbol: symbol.NewCore(log, db, broker),
-		Candle: candle.NewCore(log, db, broker),
+		Symbol: symbol.NewCore(log, db, exchange),
+		Candle: candle.NewCore(log, db, exchange),
+	}
+	if cfg.Broker.Stream {
+		synchronizer.Stream = stream
 	}
 	synchronizer.Run(sCtx)
+
+	// Paper orders are filled when placed and dry-run orders never reach
+	// binance, neither has a user data stream.
+	if cfg.Broker.UserStream && env != broker.EnvPaper && env != broker.EnvDryRun {
+		odrSynchronizer := sync.OrderSynchronizer{
+			Log:    log,
+			Order:  order.NewCore(log, db, exchange),
+			Broker: binance,
+			Stream: stream,
+		}
+		odrSynchronizer.Run(sCtx)
+	}
+
+	reconciler := sync.OrderReconciler{
+		Log:      log,
+		Symbol:   symbol.NewCore(log, db, exchange),
+		Order:    order.NewCore(log, db, exchange),
+		Interval: cfg.Broker.Reconcile,
+		Window:   cfg.Broker.ReconcileWindow,
+	}
+	reconciler.Run(sCtx)
+
+	trailingStopper := sync.TrailingStopper{
+		Log:      log,
+		Position: position.NewCore(log, db, exchange),
+		Candle:   candle.NewCore(log, db, exchange),
+		Interval: cfg.Broker.Trail,
+	}
+	trailingStopper.Run(sCtx)
+
 	defer func() {
 		log.Infow("shutdown", "status", "stopping synchronizer support")
 		defer sCancel()
@@ -226,7 +373,7 @@ func run(log *zap.SugaredLogger) error {
 	// related endpoints. This include the standard library endpoints.
 
 	// Construct the mux for the debug calls.
-	debugMux := handlers.DebugMux(build, log, db)
+	debugMux := handlers.DebugMux(build, log, db, breaker)
 
 	// Start the service listening for debug requests.
 	// Not concerned with shutting this down with load shedding.
@@ -252,7 +399,7 @@ func run(log *zap.SugaredLogger) error {
 		Log:      log,
 		Auth:     auth,
 		DB:       db,
-		Broker:   broker,
+		Exchange: exchange,
 	}, handlers.WithCORS("*"))
 
 	// Construct a server to service the requests against the mux.
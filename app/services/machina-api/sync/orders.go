@@ -0,0 +1,44 @@
+package sync
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lgarciaaco/machina-api/business/broker"
+	"github.com/lgarciaaco/machina-api/business/core/order"
+	"go.uber.org/zap"
+)
+
+// OrderSynchronizer keeps orders and balances up to date with the binance
+// user data stream, so fills that don't happen right away become visible.
+type OrderSynchronizer struct {
+	Log    *zap.SugaredLogger
+	Order  order.Core
+	Broker broker.Broker
+	Stream *broker.Stream
+}
+
+// Run consumes the user data stream until the context is cancelled.
+func (o *OrderSynchronizer) Run(ctx context.Context) {
+	go func() {
+		o.Stream.UserData(ctx, o.Broker, func(evt broker.UserEvent) {
+			switch {
+			case evt.Execution != nil:
+				er := evt.Execution
+				if _, err := o.Order.ApplyExecution(ctx, *er); err != nil {
+					if errors.Is(err, order.ErrNotFound) {
+						o.Log.Infof("ignoring execution report for unknown order %s %d", er.Symbol, er.OrderID)
+						return
+					}
+					o.Log.Errorf("applying execution report for order %s %d: %s", er.Symbol, er.OrderID, err)
+				}
+
+			case evt.Account != nil:
+				if err := o.Order.UpdateBalances(ctx, *evt.Account); err != nil {
+					o.Log.Errorf("updating balances: %s", err)
+				}
+			}
+		})
+		o.Log.Infof("gracefully shutting down order synchronizer")
+	}()
+}
@@ -0,0 +1,76 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lgarciaaco/machina-api/business/core/order"
+	"github.com/lgarciaaco/machina-api/business/core/symbol"
+	"go.uber.org/zap"
+)
+
+// OrderReconciler periodically compares the orders binance reports with the
+// orders table. It catches orders the system lost track of, like orders
+// binance accepted right before a crash.
+type OrderReconciler struct {
+	Log      *zap.SugaredLogger
+	Symbol   symbol.Core
+	Order    order.Core
+	Interval time.Duration // Interval between two reconciliations
+	Window   time.Duration // Window is how old the orders compared can be
+}
+
+// Run reconciles orders right away, then every interval until the context
+// is cancelled.
+func (o *OrderReconciler) Run(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(o.Interval)
+		defer ticker.Stop()
+
+		for {
+			func() {
+				// In case this thread blocks, we want to release it before the next iteration
+				// kicks in
+				ctx, cancel := context.WithTimeout(ctx, o.Interval-o.Interval/10)
+				defer cancel()
+
+				if err := o.reconcile(ctx, time.Now().UTC()); err != nil {
+					o.Log.Errorf("reconcile %s", err)
+				}
+			}()
+
+			select {
+			case <-ctx.Done():
+				o.Log.Infof("gracefully shutting down order reconciler")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// reconcile compares the orders of every symbol.
+func (o OrderReconciler) reconcile(ctx context.Context, now time.Time) error {
+	sbls, err := o.Symbol.Query(ctx, 1, 10)
+	if err != nil {
+		return fmt.Errorf("query symbols %w", err)
+	}
+
+	for _, s := range sbls {
+		rcn, err := o.Order.Reconcile(ctx, s.Symbol, now.Add(-o.Window), now)
+		if err != nil {
+			o.Log.Errorf("reconciling orders for symbol %s: %s", s.Symbol, err)
+			continue
+		}
+
+		if rcn.Updated+rcn.Completed+rcn.Rejected > 0 {
+			o.Log.Infof("reconciled orders for symbol %s: %d updated, %d completed, %d rejected", s.Symbol, rcn.Updated, rcn.Completed, rcn.Rejected)
+		}
+		if rcn.Unknown > 0 {
+			o.Log.Warnf("found %d orders for symbol %s not placed through the system, stored in unknown_orders for review", rcn.Unknown, s.Symbol)
+		}
+	}
+
+	return nil
+}
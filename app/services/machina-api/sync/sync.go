@@ -1,5 +1,7 @@
 // Package sync synchronizes candles from between database and binance API
-// For each symbol, it pulls 100 candles per interval and the last candle afterwards
+// For each symbol, it pulls 100 candles per interval and the last candle afterwards.
+// When a stream is provided, closed candles are received from the binance kline
+// streams instead and the rest api is only used to seed and backfill gaps.
 package sync
 
 import (
@@ -7,6 +9,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/lgarciaaco/machina-api/business/broker"
 	"github.com/lgarciaaco/machina-api/business/core/candle"
 
 	"github.com/lgarciaaco/machina-api/business/core/symbol"
@@ -34,10 +37,18 @@ type CandleSynchronizer struct {
 	Log    *zap.SugaredLogger
 	Symbol symbol.Core
 	Candle candle.Core
+	Stream *broker.Stream // Stream is optional, candles are polled when nil
+
+	resubscribe chan struct{}
 }
 
 // Run pulls candles from binance api and inserts them into the system
 func (b *CandleSynchronizer) Run(ctx context.Context) {
+	if b.Stream != nil {
+		b.resubscribe = make(chan struct{}, 1)
+		go b.stream(ctx)
+	}
+
 	// Start synchronizing for all symbols
 	go func() {
 		ticker := time.NewTicker(intervals[0])
@@ -94,6 +105,18 @@ func (b CandleSynchronizer) sync(ctx context.Context) error {
 				if err := b.Candle.Seed(ctx, nCdl, 101); err != nil {
 					b.Log.Errorf("seeding candles for symbol %s, interval %s, %w", s.Symbol, intervalsString[i], err)
 				}
+
+				// A new pair showed up, the stream has to subscribe to it.
+				select {
+				case b.resubscribe <- struct{}{}:
+				default:
+				}
+				continue
+			}
+
+			// New candles come from the stream, which backfills gaps
+			// by itself.
+			if b.Stream != nil {
 				continue
 			}
 
@@ -114,3 +137,60 @@ func (b CandleSynchronizer) sync(ctx context.Context) error {
 
 	return nil
 }
+
+// stream subscribes to the kline streams of every symbol and interval and
+// inserts closed candles as they arrive. Subscriptions are renewed when new
+// pairs are seeded.
+func (b CandleSynchronizer) stream(ctx context.Context) {
+	for {
+		sbls, err := b.Symbol.Query(ctx, 1, 10)
+		if err != nil {
+			b.Log.Errorf("query symbols %s", err)
+		}
+
+		ids := make(map[string]string, len(sbls))
+		subs := make([]broker.KlineSubscription, 0, len(sbls)*len(intervals))
+		for _, s := range sbls {
+			ids[s.Symbol] = s.ID
+			for _, i := range intervals {
+				subs = append(subs, broker.KlineSubscription{Symbol: s.Symbol, Interval: intervalsString[i]})
+			}
+		}
+
+		sCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if len(subs) == 0 {
+				<-sCtx.Done()
+				return
+			}
+
+			b.Log.Infof("streaming klines for %d symbol / interval pairs", len(subs))
+			b.Stream.Klines(sCtx, subs, func(k broker.Kline) {
+				if !k.Closed {
+					return
+				}
+
+				nCdl := candle.NewCandle{
+					SymbolID: ids[k.Symbol],
+					Symbol:   k.Symbol,
+					Interval: k.Interval,
+				}
+				if _, err := b.Candle.Append(sCtx, nCdl, k); err != nil {
+					b.Log.Errorf("appending candle for symbol %s, interval %s: %s", k.Symbol, k.Interval, err)
+				}
+			})
+		}()
+
+		select {
+		case <-ctx.Done():
+			cancel()
+			<-done
+			return
+		case <-b.resubscribe:
+			cancel()
+			<-done
+		}
+	}
+}
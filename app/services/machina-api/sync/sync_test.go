@@ -33,11 +33,11 @@ func TestSync(t *testing.T) {
 
 	candleSync := CandleSynchronizer{
 		Log:    log,
-		Symbol: symbol.NewCore(log, db, broker.TestBinance{}),
-		Candle: candle.NewCore(log, db, broker.TestBinance{}),
+		Symbol: symbol.NewCore(log, db, broker.NewBinance(broker.Config{})),
+		Candle: candle.NewCore(log, db, broker.NewBinance(broker.Config{})),
 	}
 
-	candleCore := candle.NewCore(log, db, broker.TestBinance{})
+	candleCore := candle.NewCore(log, db, broker.NewBinance(broker.Config{}))
 
 	t.Log("Given the need to sync with Candle.")
 	{
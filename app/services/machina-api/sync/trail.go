@@ -0,0 +1,85 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lgarciaaco/machina-api/business/core/candle"
+	"github.com/lgarciaaco/machina-api/business/core/position"
+	"go.uber.org/zap"
+)
+
+// TrailingStopper periodically moves the trailing stops of the open positions
+// with the close of the last synced candle. A position whose price reached its
+// stop is closed, with a market order for the quantity it holds.
+type TrailingStopper struct {
+	Log      *zap.SugaredLogger
+	Position position.Core
+	Candle   candle.Core
+	Interval time.Duration // Interval between two evaluations
+}
+
+// Run evaluates the trailing stops right away, then every interval until the
+// context is cancelled.
+func (ts *TrailingStopper) Run(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(ts.Interval)
+		defer ticker.Stop()
+
+		for {
+			func() {
+				// In case this thread blocks, we want to release it before the next iteration
+				// kicks in
+				ctx, cancel := context.WithTimeout(ctx, ts.Interval-ts.Interval/10)
+				defer cancel()
+
+				if err := ts.evaluate(ctx, time.Now().UTC()); err != nil {
+					ts.Log.Errorf("trail %s", err)
+				}
+			}()
+
+			select {
+			case <-ctx.Done():
+				ts.Log.Infof("gracefully shutting down trailing stopper")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// evaluate moves the stop of every trailing position and closes the ones
+// that reached it.
+func (ts TrailingStopper) evaluate(ctx context.Context, now time.Time) error {
+	poss, err := ts.Position.QueryTrailing(ctx)
+	if err != nil {
+		return fmt.Errorf("query positions %w", err)
+	}
+
+	for _, pos := range poss {
+		cdls, err := ts.Candle.QueryBySymbolAndInterval(ctx, 1, 1, pos.SymbolID, intervalsString[intervals[0]])
+		if err != nil || len(cdls) == 0 {
+			ts.Log.Errorf("no price for symbol %s of position %s: %v", pos.Symbol, pos.ID, err)
+			continue
+		}
+		price := cdls[0].ClosePrice
+
+		hit, err := ts.Position.Trail(ctx, pos, price)
+		if err != nil {
+			ts.Log.Errorf("trailing position %s: %s", pos.ID, err)
+			continue
+		}
+		if !hit {
+			continue
+		}
+
+		if err := ts.Position.Close(ctx, pos.ID, now); err != nil {
+			ts.Log.Errorf("closing position %s at %f: %s", pos.ID, price, err)
+			continue
+		}
+		ts.Log.Infof("closed position %s, price %f reached the trailing stop", pos.ID, price)
+	}
+
+	return nil
+}
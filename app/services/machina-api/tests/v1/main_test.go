@@ -2,8 +2,12 @@ package tests
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/lgarciaaco/machina-api/business/broker"
+	"github.com/lgarciaaco/machina-api/business/broker/encode"
 	"github.com/lgarciaaco/machina-api/business/data/dbtest"
 	"github.com/lgarciaaco/machina-api/foundation/docker"
 )
@@ -21,3 +25,34 @@ func TestMain(m *testing.M) {
 
 	m.Run()
 }
+
+// cassettes is the folder holding the recorded binance traffic.
+const cassettes = "../../../../../zarf/cassettes"
+
+// exchange returns an exchange replaying the named cassette, requests that
+// were not recorded fail the test. With MACHINA_BROKER_RECORD set, the
+// cassette is recorded against the binance testnet instead, using the key and
+// secret of the environment.
+func exchange(t *testing.T, name string) broker.Exchange {
+	path := filepath.Join(cassettes, name+".json")
+
+	if _, record := os.LookupEnv("MACHINA_BROKER_RECORD"); record {
+		rec := broker.NewRecorder(broker.NewBinance(broker.Config{
+			APIKey:      os.Getenv("MACHINA_BROKER_BINANCE_KEY"),
+			Signer:      &encode.Hmac{Key: []byte(os.Getenv("MACHINA_BROKER_BINANCE_SECRET"))},
+			Environment: broker.EnvTestNet,
+		}), path)
+		t.Cleanup(func() {
+			if err := rec.Save(); err != nil {
+				t.Errorf("saving cassette %s: %v", name, err)
+			}
+		})
+		return broker.NewClient(rec)
+	}
+
+	rep, err := broker.LoadReplayer(path)
+	if err != nil {
+		t.Fatalf("loading cassette %s: %v", name, err)
+	}
+	return broker.NewClient(rep)
+}
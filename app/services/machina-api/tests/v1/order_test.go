@@ -3,6 +3,7 @@ package tests
 import (
 	"bytes"
 	"encoding/json"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -10,8 +11,6 @@ import (
 	"testing"
 
 	"github.com/lgarciaaco/machina-api/business/broker"
-	"github.com/lgarciaaco/machina-api/business/broker/encode"
-
 	"github.com/lgarciaaco/machina-api/business/core/order"
 
 	"github.com/google/go-cmp/cmp"
@@ -34,26 +33,11 @@ type OrderTests struct {
 
 // TestOrders is the entry point for testing order management functions.
 func TestOrders(t *testing.T) {
-	key, present := os.LookupEnv("MACHINA_BROKER_BINANCE_KEY")
-	if !present {
-		t.Skipf("skipping order tests, environment variable MACHINA_BROKER_BINANCE_KEY is required")
-	}
-
-	secret, present := os.LookupEnv("MACHINA_BROKER_BINANCE_SECRET")
-	if !present {
-		t.Skipf("skipping order tests, environment variable MACHINA_BROKER_BINANCE_KEY is required")
-	}
-
 	t.Parallel()
 
 	test := dbtest.NewIntegration(t, c, "inttestorders")
 	t.Cleanup(test.Teardown)
 
-	broker := broker.TestBinance{
-		APIKey: key,
-		Signer: &encode.Hmac{Key: []byte(secret)},
-	}
-
 	shutdown := make(chan os.Signal, 1)
 	tests := OrderTests{
 		app: handlers.APIMux(handlers.APIMuxConfig{
@@ -61,7 +45,7 @@ func TestOrders(t *testing.T) {
 			Log:      test.Log,
 			Auth:     test.Auth,
 			DB:       test.DB,
-			Broker:   broker,
+			Exchange: exchange(t, "orders"),
 		}),
 		userToken:  test.Token("45b5fbd3-755f-4379-8f07-a58d4a30fa2f", "gophers"),
 		adminToken: test.Token("5cf37266-3473-4006-984f-9325122678b7", "gophers"),
@@ -75,9 +59,79 @@ func TestOrders(t *testing.T) {
 	t.Run("getOrder400", tests.getOrder400)
 	t.Run("getOrder403", tests.getOrder403)
 	t.Run("getOrder404", tests.getOrder404)
+	t.Run("deleteOrder403", tests.deleteOrder403)
 	t.Run("crudOrder", tests.crudOrder)
 }
 
+// TestOrdersPaper tests the orders endpoint against the paper broker.
+func TestOrdersPaper(t *testing.T) {
+	t.Parallel()
+
+	test := dbtest.NewIntegration(t, c, "inttestorderspaper")
+	t.Cleanup(test.Teardown)
+
+	shutdown := make(chan os.Signal, 1)
+	tests := OrderTests{
+		app: handlers.APIMux(handlers.APIMuxConfig{
+			Shutdown: shutdown,
+			Log:      test.Log,
+			Auth:     test.Auth,
+			DB:       test.DB,
+			Exchange: broker.NewPaper(broker.PaperConfig{
+				Log:      test.Log,
+				DB:       test.DB,
+				Balances: map[string]float64{"USDT": 100},
+			}),
+		}),
+		userToken: test.Token("45b5fbd3-755f-4379-8f07-a58d4a30fa2f", "gophers"),
+	}
+
+	t.Run("postOrder422", tests.postOrder422)
+}
+
+// postOrder422 validates an order the balance can't pay for is refused with
+// the reason, not failed as an internal error.
+func (ot *OrderTests) postOrder422(t *testing.T) {
+	// The last seeded candle of ETHUSDT closes at 310.50, way over the balance.
+	nOdr := order.NewOrder{
+		PositionID: "891c178b-3dbf-4f99-a8f0-99a86cb578b7",
+		Quantity:   1,
+		Side:       "BUY",
+	}
+
+	body, err := json.Marshal(&nOdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+ot.userToken)
+	ot.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate an order is refused when the balance can't pay for it.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen buying more than the paper balance.", testID)
+		{
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 422 for the response : %v", dbtest.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 422 for the response.", dbtest.Success, testID)
+
+			var got v1Web.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", dbtest.Failed, testID, err)
+			}
+			if !strings.Contains(got.Error, broker.ErrInsufficientBalance.Error()) {
+				t.Fatalf("\t%s\tTest %d:\tShould get the reason in the response : %q", dbtest.Failed, testID, got.Error)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the reason in the response.", dbtest.Success, testID)
+		}
+	}
+}
+
 // postOrder400 validates an order can't be created with the endpoint
 // unless a valid position document is submitted. We provide a valid PositionID
 // because this is validated post document validation. Tests around PositionID are
@@ -250,6 +304,7 @@ func (ot *OrderTests) postOrder201(t *testing.T) order.Order {
 	w := httptest.NewRecorder()
 
 	r.Header.Set("Authorization", "Bearer "+ot.adminToken)
+	r.Header.Set(v1Web.IdempotencyKeyHeader, "crud-order")
 	ot.app.ServeHTTP(w, r)
 
 	// This needs to be returned for other dbtest.
@@ -323,7 +378,92 @@ func (ot *OrderTests) getOrder404(t *testing.T) {
 // crudOrder performs a complete test of CRUD against the api.
 func (ot *OrderTests) crudOrder(t *testing.T) {
 	odr := ot.postOrder201(t)
+	ot.postOrderRetry201(t, odr)
+	ot.postOrder409(t)
 	ot.getOrder200(t, odr.ID)
+	ot.deleteOrder409(t, odr.ID)
+
+	odr = ot.postLimitOrder201(t)
+	ot.deleteOrder200(t, odr.ID)
+	ot.deleteOrder409(t, odr.ID)
+}
+
+// postOrderRetry201 validates a retried order gets the order placed the first
+// time instead of placing a new one.
+func (ot *OrderTests) postOrderRetry201(t *testing.T, odr order.Order) {
+	nOdr := order.NewOrder{
+		PositionID: "75fabb5c-6c22-40c6-9236-0f8017a8e12d",
+		Quantity:   0.1,
+		Side:       "SELL",
+	}
+
+	body, err := json.Marshal(&nOdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+ot.adminToken)
+	r.Header.Set(v1Web.IdempotencyKeyHeader, "crud-order")
+	ot.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to retry the creation of an order.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the idempotency key of the order %s.", testID, odr.ID)
+		{
+			if w.Code != http.StatusCreated {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 201 for the response : %v", dbtest.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 201 for the response.", dbtest.Success, testID)
+
+			var got order.Order
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", dbtest.Failed, testID, err)
+			}
+
+			if got.ID != odr.ID || got.Status != odr.Status || len(got.Fills) != len(odr.Fills) {
+				t.Fatalf("\t%s\tTest %d:\tShould get the order placed the first time : %+v.", dbtest.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the order placed the first time.", dbtest.Success, testID)
+		}
+	}
+}
+
+// postOrder409 validates an idempotency key can't be reused for a different
+// order.
+func (ot *OrderTests) postOrder409(t *testing.T) {
+	nOdr := order.NewOrder{
+		PositionID: "75fabb5c-6c22-40c6-9236-0f8017a8e12d",
+		Quantity:   0.2,
+		Side:       "SELL",
+	}
+
+	body, err := json.Marshal(&nOdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+ot.adminToken)
+	r.Header.Set(v1Web.IdempotencyKeyHeader, "crud-order")
+	ot.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate an idempotency key identifies a single order.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the key for a different quantity.", testID)
+		{
+			if w.Code != http.StatusConflict {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 409 for the response : %v", dbtest.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 409 for the response.", dbtest.Success, testID)
+		}
+	}
 }
 
 // getOrder400 validates a request for a malformed order_id.
@@ -423,6 +563,12 @@ func (ot *OrderTests) getOrder200(t *testing.T, id string) {
 				t.Fatalf("\t%s\tTest %d:\tShould get the expected result. Diff:\n%s", dbtest.Failed, testID, diff)
 			}
 			t.Logf("\t%s\tTest %d:\tShould get the expected result.", dbtest.Success, testID)
+
+			// The cassette fills 0.06 at 385.7 and 0.04 at 385.4.
+			if len(got.Fills) != 2 || got.Fills[0].TradeID != 330176 || math.Abs(got.Price-385.58) > 1e-9 {
+				t.Fatalf("\t%s\tTest %d:\tShould get the fills and their weighted average price : %+v", dbtest.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the fills and their weighted average price.", dbtest.Success, testID)
 		}
 	}
 }
@@ -486,3 +632,152 @@ func (ot *OrderTests) getOrders200(t *testing.T) {
 		}
 	}
 }
+
+// postLimitOrder201 validates a limit order can be created with the endpoint
+// and stays open until it is filled.
+func (ot *OrderTests) postLimitOrder201(t *testing.T) order.Order {
+	nOdr := order.NewOrder{
+		PositionID: "75fabb5c-6c22-40c6-9236-0f8017a8e12d",
+		Quantity:   0.1,
+		Side:       "BUY",
+		Type:       "LIMIT",
+		Price:      300,
+	}
+
+	body, err := json.Marshal(&nOdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+ot.adminToken)
+	ot.app.ServeHTTP(w, r)
+
+	var got order.Order
+
+	t.Log("Given the need to create a new limit order with the orders endpoint.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the declared order value.", testID)
+		{
+			if w.Code != http.StatusCreated {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 201 for the response : %v", dbtest.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 201 for the response.", dbtest.Success, testID)
+
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", dbtest.Failed, testID, err)
+			}
+
+			exp := got
+			exp.Status = "NEW"
+			exp.Type = "LIMIT"
+			exp.LimitPrice = 300
+			exp.TimeInForce = "GTC"
+			exp.ExecutedQuantity = 0
+
+			if diff := cmp.Diff(got, exp); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the expected result. Diff:\n%s", dbtest.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the expected result.", dbtest.Success, testID)
+		}
+	}
+
+	return got
+}
+
+// deleteOrder200 validates an open order can be canceled with the endpoint.
+func (ot *OrderTests) deleteOrder200(t *testing.T, id string) {
+	r := httptest.NewRequest(http.MethodDelete, "/v1/orders/"+id, nil)
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+ot.adminToken)
+	ot.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate canceling an open order.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the order %s.", testID, id)
+		{
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", dbtest.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", dbtest.Success, testID)
+
+			var got order.Order
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", dbtest.Failed, testID, err)
+			}
+
+			if got.ID != id || got.Status != "CANCELED" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the canceled order : %+v", dbtest.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the canceled order.", dbtest.Success, testID)
+		}
+	}
+}
+
+// deleteOrder409 validates an order that is not open can't be canceled.
+func (ot *OrderTests) deleteOrder409(t *testing.T, id string) {
+	r := httptest.NewRequest(http.MethodDelete, "/v1/orders/"+id, nil)
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+ot.adminToken)
+	ot.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate canceling an order that is not open.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the order %s.", testID, id)
+		{
+			if w.Code != http.StatusConflict {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 409 for the response : %v", dbtest.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 409 for the response.", dbtest.Success, testID)
+
+			got := w.Body.String()
+			exp := `{"error":"order is not open"}`
+			if got != exp {
+				t.Logf("\t\tTest %d:\tGot : %v", testID, got)
+				t.Logf("\t\tTest %d:\tExp: %v", testID, exp)
+				t.Fatalf("\t%s\tTest %d:\tShould get the expected result.", dbtest.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the expected result.", dbtest.Success, testID)
+		}
+	}
+}
+
+// deleteOrder403 validates an order of a position that does not belong to the
+// authenticated user can't be canceled.
+func (ot *OrderTests) deleteOrder403(t *testing.T) {
+	id := "8a89e4ec-4b51-44ac-be9f-f15910d93682"
+
+	r := httptest.NewRequest(http.MethodDelete, "/v1/orders/"+id, nil)
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+ot.userToken)
+	ot.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate canceling an order from other user.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the order %s.", testID, id)
+		{
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 403 for the response : %v", dbtest.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 403 for the response.", dbtest.Success, testID)
+
+			got := w.Body.String()
+			exp := `{"error":"attempted action is not allowed"}`
+			if got != exp {
+				t.Logf("\t\tTest %d:\tGot : %v", testID, got)
+				t.Logf("\t\tTest %d:\tExp: %v", testID, exp)
+				t.Fatalf("\t%s\tTest %d:\tShould get the expected result.", dbtest.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the expected result.", dbtest.Success, testID)
+		}
+	}
+}
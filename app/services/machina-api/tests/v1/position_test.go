@@ -51,6 +51,7 @@ func TestPositions(t *testing.T) {
 	t.Run("postPosition400", tests.postPosition400)
 	t.Run("postPosition401", tests.postPosition401)
 	t.Run("getPosition400", tests.getPosition400)
+	t.Run("queryPositions400", tests.queryPositions400)
 	t.Run("getPosition403", tests.getPosition403)
 	t.Run("getPosition404", tests.getPosition404)
 	t.Run("closePosition404", tests.closePosition404)
@@ -170,6 +171,45 @@ func (pt *PositionTests) getPosition400(t *testing.T) {
 	}
 }
 
+// queryPositions400 validates a positions query with a filter or a sort
+// field that is not supported.
+func (pt *PositionTests) queryPositions400(t *testing.T) {
+	tt := []struct {
+		query string
+		exp   string
+	}{
+		{"sort=user_id", `{"error":"data validation error","fields":{"sort":"sort must be one of creation_time side status symbol"}}`},
+		{"side=LONG", `{"error":"data validation error","fields":{"side":"side must be one of [BUY SELL]"}}`},
+		{"created_after=yesterday", `{"error":"invalid created_after format, created_after[yesterday]"}`},
+	}
+
+	t.Log("Given the need to validate querying positions with an unsupported filter.")
+	{
+		for testID, test := range tt {
+			t.Logf("\tTest %d:\tWhen using the query %s.", testID, test.query)
+			{
+				r := httptest.NewRequest(http.MethodGet, "/v1/positions/1/10?"+test.query, nil)
+				w := httptest.NewRecorder()
+
+				r.Header.Set("Authorization", "Bearer "+pt.userToken)
+				pt.app.ServeHTTP(w, r)
+
+				if w.Code != http.StatusBadRequest {
+					t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for the response : %v", dbtest.Failed, testID, w.Code)
+				}
+				t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for the response.", dbtest.Success, testID)
+
+				if got := w.Body.String(); got != test.exp {
+					t.Logf("\t\tTest %d:\tGot : %v", testID, got)
+					t.Logf("\t\tTest %d:\tExp: %v", testID, test.exp)
+					t.Fatalf("\t%s\tTest %d:\tShould get the expected result.", dbtest.Failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get the expected result.", dbtest.Success, testID)
+			}
+		}
+	}
+}
+
 // getPosition403 validates a regular user can't fetch positions from other users.
 func (pt *PositionTests) getPosition403(t *testing.T) {
 	t.Log("Given the need to validate regular users can't fetch other user's positions.")
@@ -334,6 +374,9 @@ func (pt *PositionTests) crudPosition(t *testing.T) {
 	nu := pt.postPosition201(t)
 	defer pt.closePosition204(t, nu.ID)
 
+	pt.postPositionRetry201(t, nu)
+	pt.postPosition409(t)
+
 	pt.getPosition200(t, nu.ID)
 }
 
@@ -353,6 +396,7 @@ func (pt *PositionTests) postPosition201(t *testing.T) position.Position {
 	w := httptest.NewRecorder()
 
 	r.Header.Set("Authorization", "Bearer "+pt.userToken)
+	r.Header.Set(v1Web.IdempotencyKeyHeader, "crud-position")
 	pt.app.ServeHTTP(w, r)
 
 	// This needs to be returned for other dbtest.
@@ -387,6 +431,82 @@ func (pt *PositionTests) postPosition201(t *testing.T) position.Position {
 	return got
 }
 
+// postPositionRetry201 validates a retried position gets the position created
+// the first time instead of creating a new one.
+func (pt *PositionTests) postPositionRetry201(t *testing.T, pos position.Position) {
+	nPos := position.NewPosition{
+		SymbolID: "125240c0-7f7f-4d0f-b30d-939fd93cf027",
+		Side:     "SELL",
+	}
+
+	body, err := json.Marshal(&nPos)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/positions", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+pt.userToken)
+	r.Header.Set(v1Web.IdempotencyKeyHeader, "crud-position")
+	pt.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to retry the creation of a position.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the idempotency key of the position %s.", testID, pos.ID)
+		{
+			if w.Code != http.StatusCreated {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 201 for the response : %v", dbtest.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 201 for the response.", dbtest.Success, testID)
+
+			var got position.Position
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", dbtest.Failed, testID, err)
+			}
+
+			if got.ID != pos.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould get the position created the first time : got %s.", dbtest.Failed, testID, got.ID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the position created the first time.", dbtest.Success, testID)
+		}
+	}
+}
+
+// postPosition409 validates an idempotency key can't be reused for a
+// different position.
+func (pt *PositionTests) postPosition409(t *testing.T) {
+	nPos := position.NewPosition{
+		SymbolID: "125240c0-7f7f-4d0f-b30d-939fd93cf027",
+		Side:     "BUY",
+	}
+
+	body, err := json.Marshal(&nPos)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/positions", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+pt.userToken)
+	r.Header.Set(v1Web.IdempotencyKeyHeader, "crud-position")
+	pt.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate an idempotency key identifies a single position.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the key for a different side.", testID)
+		{
+			if w.Code != http.StatusConflict {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 409 for the response : %v", dbtest.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 409 for the response.", dbtest.Success, testID)
+		}
+	}
+}
+
 // getPosition200 validates a position request for an existing positionID.
 func (pt *PositionTests) getPosition200(t *testing.T, id string) {
 	r := httptest.NewRequest(http.MethodGet, "/v1/positions/"+id, nil)
@@ -15,7 +15,6 @@ import (
 	v1Web "github.com/lgarciaaco/machina-api/business/web/v1"
 
 	"github.com/lgarciaaco/machina-api/app/services/machina-api/handlers"
-	"github.com/lgarciaaco/machina-api/business/broker"
 	"github.com/lgarciaaco/machina-api/business/data/dbtest"
 )
 
@@ -35,8 +34,6 @@ func TestSymbols(t *testing.T) {
 	test := dbtest.NewIntegration(t, c, "inttestsymbols")
 	t.Cleanup(test.Teardown)
 
-	broker := broker.Binance{}
-
 	shutdown := make(chan os.Signal, 1)
 	tests := SymbolTests{
 		app: handlers.APIMux(handlers.APIMuxConfig{
@@ -44,7 +41,7 @@ func TestSymbols(t *testing.T) {
 			Log:      test.Log,
 			Auth:     test.Auth,
 			DB:       test.DB,
-			Broker:   broker,
+			Exchange: exchange(t, "symbols"),
 		}),
 		userToken:  test.Token("45b5fbd3-755f-4379-8f07-a58d4a30fa2f", "gophers"),
 		adminToken: test.Token("5cf37266-3473-4006-984f-9325122678b7", "gophers"),
@@ -10,24 +10,57 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
 	"github.com/lgarciaaco/machina-api/business/broker/encode"
+	"github.com/lgarciaaco/machina-api/business/sys/metrics"
 )
 
 var (
 	ErrBrokerNotFound        = errors.New("not found")
 	ErrBrokerDuplicatedEntry = errors.New("duplicated entry")
+	ErrMissingCredentials    = errors.New("endpoint requires api key and signer")
+	ErrDryRun                = errors.New("request not sent in dry-run mode")
 )
 
+// Set of order types, sides, time in force and statuses supported by binance.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/rest-api.md#enum-definitions
 const (
-	OrderTypeMarket = "MARKET"
-	OrderSideSell   = "SELL"
-	OrderSideBuy    = "BUY"
+	OrderTypeMarket          = "MARKET"
+	OrderTypeLimit           = "LIMIT"
+	OrderTypeLimitMaker      = "LIMIT_MAKER"
+	OrderTypeStopLossLimit   = "STOP_LOSS_LIMIT"
+	OrderTypeTakeProfitLimit = "TAKE_PROFIT_LIMIT"
+
+	OrderSideSell = "SELL"
+	OrderSideBuy  = "BUY"
+
+	TimeInForceGTC = "GTC" // Good til canceled
+	TimeInForceIOC = "IOC" // Immediate or cancel
+	TimeInForceFOK = "FOK" // Fill or kill
+
+	OrderStatusNew             = "NEW"
+	OrderStatusPartiallyFilled = "PARTIALLY_FILLED"
+	OrderStatusFilled          = "FILLED"
+	OrderStatusCanceled        = "CANCELED"
+	OrderStatusRejected        = "REJECTED"
+	OrderStatusExpired         = "EXPIRED"
+)
 
+const (
 	MaxIdleConnections = 10
 	IdleConnTimeout    = 30 * time.Second
+	DefaultTimeout     = 10 * time.Second
+	DialTimeout        = 5 * time.Second
 	TestNet            = "https://testnet.binance.vision/api/v3"
 	APIV3              = "https://api.binance.com/api/v3"
 )
@@ -37,26 +70,129 @@ type Broker interface {
 	Time(ctx context.Context) (int64, error)
 }
 
+// Config holds the settings required to construct a Binance broker.
+type Config struct {
+	APIKey      string              // APIKey is required for calls that need authentication
+	Signer      encode.Signer       // Signer is used to sign calls to SIGNED endpoints
+	Environment Environment         // Environment selects live, testnet or dry-run trading
+	BaseURL     string              // BaseURL overrides the url derived from Environment
+	Security    map[string]Security // Security overrides DefaultSecurity when set
+	WeightLimit int                 // WeightLimit is the request weight allowed per minute
+	OrderLimit  int                 // OrderLimit is the number of orders allowed per 10 seconds
+	Weights     map[string]int      // Weights overrides DefaultWeights when set
+	RecvWindow  time.Duration       // RecvWindow is how long a signed request stays valid
+	TimeSync    time.Duration       // TimeSync is how often the server time offset is refreshed
+	Timeout     time.Duration       // Timeout bounds a whole request, including reading the body
+	MaxConns    int                 // MaxConns is the size of the idle connection pool
+	Proxy       *url.URL            // Proxy routes every request through a proxy when set
+}
+
 // Binance manages calls to binance api v3
 type Binance struct {
-	APIKey string        // APIKey is required for calls that need authentication
-	Signer encode.Signer // Signer is used to encode calls to binance that include sensitive data, like APIKey
+	apiKey   string
+	signer   encode.Signer
+	env      Environment
+	baseURL  string
+	security map[string]Security
+	limiter  *limiter
+	client   *http.Client
+
+	clock      *clock
+	recvWindow time.Duration
+}
+
+// NewBinance constructs a Binance broker for the given configuration. When no
+// environment is provided the broker runs in dry-run mode.
+func NewBinance(cfg Config) *Binance {
+	env := cfg.Environment
+	if env == "" {
+		env = EnvDryRun
+	}
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = env.baseURL()
+	}
+
+	security := cfg.Security
+	if security == nil {
+		security = DefaultSecurity
+	}
+
+	recvWindow := cfg.RecvWindow
+	if recvWindow <= 0 {
+		recvWindow = DefaultRecvWindow
+	}
+
+	return &Binance{
+		apiKey:   cfg.APIKey,
+		signer:   cfg.Signer,
+		env:      env,
+		baseURL:  baseURL,
+		security: security,
+		limiter:  newLimiter(cfg.WeightLimit, cfg.OrderLimit, cfg.Weights),
+		client:   newClient(cfg.Timeout, cfg.MaxConns, cfg.Proxy),
+
+		clock:      newClock(cfg.TimeSync),
+		recvWindow: recvWindow,
+	}
+}
+
+// newClient constructs the http client shared by every request of a broker, so
+// connections to binance are reused. The transport is instrumented with
+// otelhttp to emit a span per request.
+func newClient(timeout time.Duration, maxConns int, proxy *url.URL) *http.Client {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if maxConns <= 0 {
+		maxConns = MaxIdleConnections
+	}
+
+	tr := http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:        maxConns,
+		MaxIdleConnsPerHost: maxConns,
+		IdleConnTimeout:     IdleConnTimeout,
+		TLSHandshakeTimeout: DialTimeout,
+		DisableCompression:  true,
+	}
+	if proxy != nil {
+		tr.Proxy = http.ProxyURL(proxy)
+	}
+
+	return &http.Client{
+		Transport: otelhttp.NewTransport(&tr),
+		Timeout:   timeout,
+	}
+}
+
+// Environment returns the environment the broker is trading on.
+func (as *Binance) Environment() Environment {
+	return as.env
 }
 
 // Request convert a bunch of key-value pairs into an url query, it takes the api endpoint
 // and builds the binance api request. It returns the body of the response
-func (as Binance) Request(ctx context.Context, method, endpoint string, keysAndValues ...string) (rd io.Reader, err error) {
-	if endpoint == "order" {
-		endpoint = endpoint + "/test"
-	}
+func (as *Binance) Request(ctx context.Context, method, endpoint string, keysAndValues ...string) (rd io.Reader, err error) {
+	ctx, span := otel.GetTracerProvider().Tracer("").Start(ctx, "broker.binance.request")
+	span.SetAttributes(attribute.String("endpoint", endpoint), attribute.String("environment", string(as.env)))
+	defer span.End()
 
-	// form the api request url
-	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/%s", APIV3, endpoint), nil)
-	if err != nil {
-		return nil, fmt.Errorf("unable to create request %w", err)
+	// In dry-run mode orders are validated by binance but never reach
+	// the matching engine. Nothing else that changes the state of the
+	// account is sent, only market data and account reads are.
+	if as.env == EnvDryRun && method != http.MethodGet {
+		if endpoint != "order" || method != http.MethodPost {
+			return nil, fmt.Errorf("%s %s: %w", method, endpoint, ErrDryRun)
+		}
+		endpoint = "order/test"
 	}
 
-	q := req.URL.Query()
+	q := make(url.Values)
 	for i := 0; i < len(keysAndValues); {
 		// make sure this isn't a mismatched key
 		if i == len(keysAndValues)-1 {
@@ -69,39 +205,94 @@ func (as Binance) Request(ctx context.Context, method, endpoint string, keysAndV
 		i += 2
 	}
 
-	if endpoint == "order/test" {
-		// If there is an Api key defined we include it in the header
-		if as.APIKey != "" {
-			req.Header.Add("X-MBX-APIKEY", as.APIKey)
+	rd, err = as.send(ctx, method, endpoint, q)
+
+	// If binance rejects the timestamp, our clock drifted more than the
+	// recvWindow since the last sync. Force a resync and try once more.
+	if errors.Is(err, ErrInvalidTimestamp) {
+		if err := as.syncTime(ctx); err != nil {
+			return nil, fmt.Errorf("resync time: %w", err)
 		}
+		rd, err = as.send(ctx, method, endpoint, q)
+	}
+
+	return rd, err
+}
 
-		// Add signature parameter if signature is defined
-		if as.Signer != nil {
-			signature, err := as.Signer.Sign([]byte(q.Encode()))
-			if err != nil {
-				return nil, fmt.Errorf("unable to sign")
-			}
-			q.Add("signature", signature)
+// send issues a single request to the binance api. Signed requests are
+// stamped with the server time and the recvWindow before being signed.
+func (as *Binance) send(ctx context.Context, method, endpoint string, q url.Values) (io.Reader, error) {
+	security := as.security[endpoint]
+
+	// The offset is refreshed lazily, right before a signed request needs it.
+	if security == SecuritySigned && as.clock.stale() {
+		if err := as.syncTime(ctx); err != nil {
+			return nil, fmt.Errorf("sync time: %w", err)
 		}
 	}
 
-	req.URL.RawQuery = q.Encode()
+	// Wait until the request fits within binance limits, so we don't get
+	// the ip banned.
+	isOrder := method == http.MethodPost && (endpoint == "order" || endpoint == "order/oco")
+	if err := as.limiter.wait(ctx, endpoint, isOrder); err != nil {
+		return nil, err
+	}
+
+	// form the api request url
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/%s", as.baseURL, endpoint), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request %w", err)
+	}
+
+	switch security {
+	case SecurityAPIKey:
+		if as.apiKey == "" {
+			return nil, fmt.Errorf("endpoint %s: %w", endpoint, ErrMissingCredentials)
+		}
+		req.Header.Add("X-MBX-APIKEY", as.apiKey)
+		req.URL.RawQuery = q.Encode()
+
+	case SecuritySigned:
+		if as.apiKey == "" || as.signer == nil {
+			return nil, fmt.Errorf("endpoint %s: %w", endpoint, ErrMissingCredentials)
+		}
+		req.Header.Add("X-MBX-APIKEY", as.apiKey)
+
+		sq := make(url.Values, len(q)+2)
+		for k, v := range q {
+			sq[k] = v
+		}
+		sq.Set("recvWindow", strconv.FormatInt(as.recvWindow.Milliseconds(), 10))
+		sq.Set("timestamp", strconv.FormatInt(as.clock.now().UnixMilli(), 10))
+		query := sq.Encode()
+
+		// The signature is computed over the query string and must be
+		// the last parameter of the request.
+		signature, err := as.signer.Sign([]byte(query))
+		if err != nil {
+			return nil, fmt.Errorf("unable to sign: %w", err)
+		}
+		req.URL.RawQuery = query + "&" + url.Values{"signature": {signature}}.Encode()
+
+	default:
+		req.URL.RawQuery = q.Encode()
+	}
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConns:       MaxIdleConnections,
-			IdleConnTimeout:    IdleConnTimeout,
-			DisableCompression: true,
-		}}
-	resp, err := client.Do(req)
+	start := time.Now()
+	resp, err := as.client.Do(req)
+	metrics.AddBrokerLatency(endpoint, time.Since(start))
 	if err != nil {
+		metrics.AddBrokerErrors(endpoint)
 		return nil, fmt.Errorf("failed to issue request, err %w", err)
 	}
 	defer resp.Body.Close()
+	as.limiter.update(resp)
 
-	// we care only about status codes in 2xx range, anything else we can't process
+	// we care only about status codes in 2xx range, anything else is decoded
+	// into a binance error
 	if !(resp.StatusCode >= 200 && resp.StatusCode <= 299) {
-		return nil, fmt.Errorf("status code [%d] out of range, expecting 200 <= status code <= 299", resp.StatusCode)
+		metrics.AddBrokerErrors(endpoint)
+		return nil, fmt.Errorf("endpoint %s: %w", endpoint, newAPIError(resp))
 	}
 
 	// finally, return the reader for the body
@@ -115,45 +306,34 @@ func (as Binance) Request(ctx context.Context, method, endpoint string, keysAndV
 	return r, nil
 }
 
-// Time fetches the api time
-func (as Binance) Time(ctx context.Context) (int64, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/%s", TestNet, "time"), nil)
-	if err != nil {
-		return 0, fmt.Errorf("unable to create request %w", err)
+// Time fetches the api time. The local clock offset is refreshed as a side
+// effect.
+func (as *Binance) Time(ctx context.Context) (int64, error) {
+	if err := as.syncTime(ctx); err != nil {
+		return 0, err
 	}
+	return as.clock.now().UnixMilli(), nil
+}
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConns:       MaxIdleConnections,
-			IdleConnTimeout:    IdleConnTimeout,
-			DisableCompression: true,
-		}}
-	resp, err := client.Do(req)
+// syncTime fetches the server time and refreshes the clock offset.
+func (as *Binance) syncTime(ctx context.Context) error {
+	sent := time.Now()
+	rd, err := as.send(ctx, http.MethodGet, "time", nil)
 	if err != nil {
-		return 0, fmt.Errorf("failed to issue request, err %w", err)
-	}
-	defer resp.Body.Close()
-
-	// we care only about status codes in 2xx range, anything else we can't process
-	if !(resp.StatusCode >= 200 && resp.StatusCode <= 299) {
-		return 0, fmt.Errorf("status code [%d] out of range, expecting 200 <= status code <= 299", resp.StatusCode)
+		return fmt.Errorf("fetching time: %w", err)
 	}
+	received := time.Now()
 
-	type time struct {
-		Time int64 `json:"serverTime"`
+	var st struct {
+		ServerTime int64 `json:"serverTime"`
 	}
-	var t time
 
-	// finally, return the body
-	if b, err := ioutil.ReadAll(resp.Body); err != nil {
-		return 0, fmt.Errorf("unable to read from response")
-	} else {
-		if err = json.Unmarshal(b, &t); err != nil {
-			return 0, fmt.Errorf("unable to unmarshal reposns %s into json", b)
-		}
+	if err := json.NewDecoder(rd).Decode(&st); err != nil {
+		return fmt.Errorf("unable to unmarshal time response: %w", err)
 	}
 
-	return t.Time, nil
+	as.clock.set(time.UnixMilli(st.ServerTime), sent, received)
+	return nil
 }
 
 // ToTime takes a Binance time format (milliseconds) and return
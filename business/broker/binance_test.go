@@ -0,0 +1,486 @@
+package broker_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lgarciaaco/machina-api/business/broker"
+	"github.com/lgarciaaco/machina-api/business/broker/encode"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestBinanceSecurity(t *testing.T) {
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/time") {
+			fmt.Fprintf(w, `{"serverTime":%d}`, time.Now().UnixMilli())
+			return
+		}
+		got = r
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	brk := broker.NewBinance(broker.Config{
+		APIKey:      "key",
+		Signer:      &encode.Hmac{Key: []byte("secret")},
+		Environment: broker.EnvDryRun,
+		BaseURL:     srv.URL,
+	})
+
+	t.Log("Given the need to authenticate calls according to the endpoint security.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen calling a public endpoint.", testID)
+		{
+			if _, err := brk.Request(context.Background(), http.MethodGet, "klines", "symbol", "BNBUSDT"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to request klines: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to request klines.", success, testID)
+
+			if got.Header.Get("X-MBX-APIKEY") != "" || got.URL.Query().Get("signature") != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould not send credentials: %s", failed, testID, got.URL)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not send credentials.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen calling a signed endpoint.", testID)
+		{
+			if _, err := brk.Request(context.Background(), http.MethodGet, "account"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to request account: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to request account.", success, testID)
+
+			if got.Header.Get("X-MBX-APIKEY") != "key" {
+				t.Fatalf("\t%s\tTest %d:\tShould send the api key.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould send the api key.", success, testID)
+
+			raw := got.URL.RawQuery
+			i := strings.LastIndex(raw, "&signature=")
+			if i < 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould sign the query as the last parameter: %s", failed, testID, raw)
+			}
+			sig, _ := (&encode.Hmac{Key: []byte("secret")}).Sign([]byte(raw[:i]))
+			if raw[i+len("&signature="):] != sig {
+				t.Fatalf("\t%s\tTest %d:\tShould sign the query as the last parameter: %s", failed, testID, raw)
+			}
+			t.Logf("\t%s\tTest %d:\tShould sign the query as the last parameter.", success, testID)
+
+			q := got.URL.Query()
+			if q.Get("recvWindow") != "5000" || q.Get("timestamp") == "" {
+				t.Fatalf("\t%s\tTest %d:\tShould stamp timestamp and recvWindow: %s", failed, testID, raw)
+			}
+			t.Logf("\t%s\tTest %d:\tShould stamp timestamp and recvWindow.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen placing an order in dry-run mode.", testID)
+		{
+			if _, err := brk.Request(context.Background(), http.MethodPost, "order"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to place order: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to place order.", success, testID)
+
+			if !strings.HasSuffix(got.URL.Path, "/order/test") {
+				t.Fatalf("\t%s\tTest %d:\tShould route the order to order/test: %s", failed, testID, got.URL.Path)
+			}
+			t.Logf("\t%s\tTest %d:\tShould route the order to order/test.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen calling a signed endpoint without credentials.", testID)
+		{
+			anon := broker.NewBinance(broker.Config{BaseURL: srv.URL})
+			rd, err := anon.Request(context.Background(), http.MethodGet, "myTrades", "symbol", "BNBUSDT")
+			if err == nil {
+				b, _ := ioutil.ReadAll(rd)
+				t.Fatalf("\t%s\tTest %d:\tShould fail without credentials: %s", failed, testID, b)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fail without credentials.", success, testID)
+		}
+	}
+}
+
+func TestBinanceRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-MBX-USED-WEIGHT-1M", "1200")
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	brk := broker.NewBinance(broker.Config{BaseURL: srv.URL})
+
+	t.Log("Given the need to respect binance rate limits.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen binance answers with 429.", testID)
+		{
+			_, err := brk.Request(context.Background(), http.MethodGet, "klines")
+			if !errors.Is(err, broker.ErrRateLimited) {
+				t.Fatalf("\t%s\tTest %d:\tShould get ErrRateLimited: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get ErrRateLimited.", success, testID)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			start := time.Now()
+			_, err = brk.Request(ctx, http.MethodGet, "klines")
+			if !errors.Is(err, broker.ErrRateLimited) || time.Since(start) > 100*time.Millisecond {
+				t.Fatalf("\t%s\tTest %d:\tShould fail fast while Retry-After is pending: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fail fast while Retry-After is pending.", success, testID)
+		}
+	}
+}
+
+func TestBinanceAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":-1013,"msg":"Filter failure: LOT_SIZE"}`))
+	}))
+	defer srv.Close()
+
+	brk := broker.NewBinance(broker.Config{BaseURL: srv.URL})
+
+	t.Log("Given the need to decode binance errors.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen binance rejects a request.", testID)
+		{
+			_, err := brk.Request(context.Background(), http.MethodGet, "klines")
+			if !errors.Is(err, broker.ErrFilterFailure) {
+				t.Fatalf("\t%s\tTest %d:\tShould get ErrFilterFailure: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get ErrFilterFailure.", success, testID)
+
+			ae := broker.GetAPIError(err)
+			if ae == nil || ae.Code != -1013 || ae.Message != "Filter failure: LOT_SIZE" || ae.Status != http.StatusBadRequest {
+				t.Fatalf("\t%s\tTest %d:\tShould get the binance code and message: %+v", failed, testID, ae)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the binance code and message.", success, testID)
+		}
+	}
+}
+
+func TestBinanceTimeResync(t *testing.T) {
+	var syncs, calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/time") {
+			syncs++
+			fmt.Fprintf(w, `{"serverTime":%d}`, time.Now().UnixMilli())
+			return
+		}
+
+		// Reject the first signed call as if the clock had drifted.
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":-1021,"msg":"Timestamp for this request is outside of the recvWindow."}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	brk := broker.NewBinance(broker.Config{
+		APIKey:  "key",
+		Signer:  &encode.Hmac{Key: []byte("secret")},
+		BaseURL: srv.URL,
+	})
+
+	t.Log("Given the need to keep the clock aligned with binance.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen binance rejects the timestamp.", testID)
+		{
+			if _, err := brk.Request(context.Background(), http.MethodGet, "account"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould retry after a resync: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould retry after a resync.", success, testID)
+
+			if syncs != 2 || calls != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould sync twice and call twice, got %d syncs and %d calls.", failed, testID, syncs, calls)
+			}
+			t.Logf("\t%s\tTest %d:\tShould sync twice and call twice.", success, testID)
+		}
+	}
+}
+
+func TestBinanceExchange(t *testing.T) {
+	var limit, quote, oco url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/time"):
+			fmt.Fprintf(w, `{"serverTime":%d}`, time.Now().UnixMilli())
+		case strings.HasSuffix(r.URL.Path, "/klines"):
+			w.Write([]byte(`[[1499040000000,"0.01634790","0.80000000","0.01575800","0.01577100","148976.11427815",1499644799999,"2434.19055334",308,"1756.87402397","28.46694368","17928899.62484339"]]`))
+		case strings.HasSuffix(r.URL.Path, "/exchangeInfo"):
+			w.Write([]byte(`{"symbols":[{"symbol":"BTCUSDT","status":"TRADING","baseAsset":"BTC","quoteAsset":"USDT","filters":[{"filterType":"PRICE_FILTER","minPrice":"0.01000000","maxPrice":"1000000.00000000","tickSize":"0.01000000"},{"filterType":"LOT_SIZE","minQty":"0.00001000","maxQty":"9000.00000000","stepSize":"0.00001000"},{"filterType":"MIN_NOTIONAL","minNotional":"10.00000000","applyToMarket":true,"avgPriceMins":5},{"filterType":"MARKET_LOT_SIZE","minQty":"0.00000000","maxQty":"112.42608000","stepSize":"0.00000000"},{"filterType":"MAX_NUM_ORDERS","maxNumOrders":200}]},{"symbol":"ETHUSDT","status":"TRADING","baseAsset":"ETH","quoteAsset":"USDT","filters":[{"filterType":"NOTIONAL","minNotional":"5.00000000","applyMinToMarket":true,"maxNotional":"9000000.00000000","applyMaxToMarket":false,"avgPriceMins":5}]}]}`))
+		case strings.HasSuffix(r.URL.Path, "/openOrders"):
+			w.Write([]byte(`[{"symbol":"BTCUSDT","origClientOrderId":"E6APeyTJvkMvLMYMqu1KQ4","orderId":11,"orderListId":-1,"clientOrderId":"pXLV6Hz6mprAcVYpVMTGgx","price":"0.089853","origQty":"0.178622","executedQty":"0.000000","cummulativeQuoteQty":"0.000000","status":"CANCELED","timeInForce":"GTC","type":"LIMIT","side":"BUY"},{"orderListId":1929,"contingencyType":"OCO","listStatusType":"ALL_DONE","listOrderStatus":"ALL_DONE","listClientOrderId":"2inzWQdDvZLHbbAmAozX2N","transactionTime":1585230948299,"symbol":"BTCUSDT","orders":[]}]`))
+		case strings.HasSuffix(r.URL.Path, "/order/oco"):
+			r.ParseForm()
+			oco = r.Form
+			w.Write([]byte(`{"orderListId":0,"contingencyType":"OCO","listStatusType":"EXEC_STARTED","listOrderStatus":"EXECUTING","listClientOrderId":"JYVpp3F0f5CAG15DhtrqLp","transactionTime":1563417480525,"symbol":"BTCUSDT","orders":[{"symbol":"BTCUSDT","orderId":2,"clientOrderId":"Kk7sqHb9J6mJWTMDVW7Vos"},{"symbol":"BTCUSDT","orderId":3,"clientOrderId":"xTXKaGYd4bluPVp78IVRvl"}],"orderReports":[{"symbol":"BTCUSDT","orderId":2,"orderListId":0,"clientOrderId":"Kk7sqHb9J6mJWTMDVW7Vos","transactTime":1563417480525,"price":"3500.00000000","origQty":"0.62400000","executedQty":"0.00000000","cummulativeQuoteQty":"0.00000000","status":"NEW","timeInForce":"GTC","type":"STOP_LOSS_LIMIT","side":"SELL","stopPrice":"3550.00000000"},{"symbol":"BTCUSDT","orderId":3,"orderListId":0,"clientOrderId":"xTXKaGYd4bluPVp78IVRvl","transactTime":1563417480525,"price":"4500.00000000","origQty":"0.62400000","executedQty":"0.00000000","cummulativeQuoteQty":"0.00000000","status":"NEW","timeInForce":"GTC","type":"LIMIT_MAKER","side":"SELL"}]}`))
+		case strings.HasSuffix(r.URL.Path, "/order") && r.FormValue("quoteOrderQty") != "":
+			quote = r.Form
+			w.Write([]byte(`{"symbol":"BTCUSDT","orderId":30,"orderListId":-1,"clientOrderId":"6gCrw2kRUAF9CvJDGP16IR","transactTime":1507725176595,"price":"0.00000000","origQty":"0.02500000","executedQty":"0.02500000","cummulativeQuoteQty":"100.00000000","status":"FILLED","timeInForce":"GTC","type":"MARKET","side":"BUY","fills":[{"price":"4000.00000000","qty":"0.02500000","commission":"0.00002500","commissionAsset":"BTC","tradeId":57}]}`))
+		case strings.HasSuffix(r.URL.Path, "/order") && r.FormValue("type") == broker.OrderTypeLimit:
+			limit = r.Form
+			w.Write([]byte(`{"symbol":"BTCUSDT","orderId":29,"orderListId":-1,"clientOrderId":"6gCrw2kRUAF9CvJDGP16IQ","transactTime":1507725176595,"price":"3900.00000000","origQty":"10.00000000","executedQty":"0.00000000","cummulativeQuoteQty":"0.00000000","status":"NEW","timeInForce":"IOC","type":"LIMIT","side":"SELL","fills":[]}`))
+		case strings.HasSuffix(r.URL.Path, "/order"):
+			w.Write([]byte(`{"symbol":"BTCUSDT","orderId":28,"orderListId":-1,"clientOrderId":"6gCrw2kRUAF9CvJDGP16IP","transactTime":1507725176595,"price":"0.00000000","origQty":"10.00000000","executedQty":"10.00000000","cummulativeQuoteQty":"10.00000000","status":"FILLED","timeInForce":"GTC","type":"MARKET","side":"SELL","fills":[{"price":"4000.00000000","qty":"1.00000000","commission":"4.00000000","commissionAsset":"USDT","tradeId":56}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	var exg broker.Exchange = broker.NewBinance(broker.Config{
+		APIKey:      "key",
+		Signer:      &encode.Hmac{Key: []byte("secret")},
+		Environment: broker.EnvTestNet,
+		BaseURL:     srv.URL,
+	})
+
+	t.Log("Given the need to use binance through the typed exchange api.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen fetching klines.", testID)
+		{
+			ks, err := exg.Klines(context.Background(), broker.KlineQuery{Symbol: "BTCUSDT", Interval: "1h", Limit: 1})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to fetch klines: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to fetch klines.", success, testID)
+
+			if len(ks) != 1 || ks[0].OpenPrice != 0.0163479 || ks[0].Volume != 148976.11427815 || !ks[0].Closed || ks[0].Symbol != "BTCUSDT" {
+				t.Fatalf("\t%s\tTest %d:\tShould decode the kline: %+v", failed, testID, ks)
+			}
+			t.Logf("\t%s\tTest %d:\tShould decode the kline.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen fetching the trading rules.", testID)
+		{
+			sis, err := exg.ExchangeInfo(context.Background(), "BTCUSDT", "ETHUSDT")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to fetch the trading rules: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to fetch the trading rules.", success, testID)
+
+			exp := broker.SymbolInfo{
+				Symbol:           "BTCUSDT",
+				Status:           "TRADING",
+				BaseAsset:        "BTC",
+				QuoteAsset:       "USDT",
+				MinPrice:         0.01,
+				MaxPrice:         1000000,
+				TickSize:         0.01,
+				MinQty:           0.00001,
+				MaxQty:           9000,
+				StepSize:         0.00001,
+				MinNotional:      10,
+				ApplyMinToMarket: true,
+				MarketMaxQty:     112.42608,
+			}
+			notional := broker.SymbolInfo{
+				Symbol:           "ETHUSDT",
+				Status:           "TRADING",
+				BaseAsset:        "ETH",
+				QuoteAsset:       "USDT",
+				MinNotional:      5,
+				MaxNotional:      9000000,
+				ApplyMinToMarket: true,
+			}
+			if len(sis) != 2 || sis[0] != exp || sis[1] != notional {
+				t.Fatalf("\t%s\tTest %d:\tShould decode the filters: %+v", failed, testID, sis)
+			}
+			t.Logf("\t%s\tTest %d:\tShould decode the filters.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen placing an order.", testID)
+		{
+			or, err := exg.PlaceOrder(context.Background(), broker.OrderRequest{Symbol: "BTCUSDT", Side: broker.OrderSideSell, Type: broker.OrderTypeMarket, Quantity: 10})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to place the order: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to place the order.", success, testID)
+
+			if or.OrderID != 28 || or.Status != "FILLED" || or.ExecutedQuantity != 10 || len(or.Fills) != 1 || or.Fills[0].Price != 4000 || or.Fills[0].TradeID != 56 {
+				t.Fatalf("\t%s\tTest %d:\tShould decode the order: %+v", failed, testID, or)
+			}
+			t.Logf("\t%s\tTest %d:\tShould decode the order.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen placing an order for a quote quantity.", testID)
+		{
+			or, err := exg.PlaceOrder(context.Background(), broker.OrderRequest{Symbol: "BTCUSDT", Side: broker.OrderSideBuy, Type: broker.OrderTypeMarket, QuoteQuantity: 100})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to place the order: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to place the order.", success, testID)
+
+			if quote.Get("quoteOrderQty") != "100" || quote.Get("quantity") != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould send the quote quantity only: %v", failed, testID, quote)
+			}
+			t.Logf("\t%s\tTest %d:\tShould send the quote quantity only.", success, testID)
+
+			if or.ExecutedQuantity != 0.025 || or.CumulativeQuote != 100 {
+				t.Fatalf("\t%s\tTest %d:\tShould decode the executed and quote quantities: %+v", failed, testID, or)
+			}
+			t.Logf("\t%s\tTest %d:\tShould decode the executed and quote quantities.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen placing a limit order.", testID)
+		{
+			or, err := exg.PlaceOrder(context.Background(), broker.OrderRequest{Symbol: "BTCUSDT", Side: broker.OrderSideSell, Type: broker.OrderTypeLimit, Quantity: 10, Price: 3900, TimeInForce: broker.TimeInForceIOC})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to place the order: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to place the order.", success, testID)
+
+			if limit.Get("price") != "3900" || limit.Get("timeInForce") != "IOC" || limit.Get("stopPrice") != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould send the price and time in force: %v", failed, testID, limit)
+			}
+			t.Logf("\t%s\tTest %d:\tShould send the price and time in force.", success, testID)
+
+			if or.OrderID != 29 || or.Status != broker.OrderStatusNew || or.ExecutedQuantity != 0 || len(or.Fills) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould decode the open order: %+v", failed, testID, or)
+			}
+			t.Logf("\t%s\tTest %d:\tShould decode the open order.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen placing an OCO order list.", testID)
+		{
+			res, err := exg.PlaceOCO(context.Background(), broker.OCORequest{Symbol: "BTCUSDT", Side: broker.OrderSideSell, Quantity: 0.624, Price: 4500, StopPrice: 3550, StopLimitPrice: 3500, StopLimitTimeInForce: broker.TimeInForceGTC, LimitClientOrderID: "xTXKaGYd4bluPVp78IVRvl"})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to place the order list: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to place the order list.", success, testID)
+
+			if oco.Get("price") != "4500" || oco.Get("stopPrice") != "3550" || oco.Get("stopLimitPrice") != "3500" || oco.Get("stopLimitTimeInForce") != "GTC" ||
+				oco.Get("limitClientOrderId") != "xTXKaGYd4bluPVp78IVRvl" || oco.Get("stopClientOrderId") != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould send the prices of both legs: %v", failed, testID, oco)
+			}
+			t.Logf("\t%s\tTest %d:\tShould send the prices of both legs.", success, testID)
+
+			if res.OrderListID != 0 || res.ListOrderStatus != "EXECUTING" || len(res.Orders) != 2 || res.Orders[0].Type != broker.OrderTypeStopLossLimit ||
+				res.Orders[0].Price != 3500 || res.Orders[1].OrderID != 3 || res.Orders[1].ClientOrderID != "xTXKaGYd4bluPVp78IVRvl" {
+				t.Fatalf("\t%s\tTest %d:\tShould decode both legs: %+v", failed, testID, res)
+			}
+			t.Logf("\t%s\tTest %d:\tShould decode both legs.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen canceling the open orders of a symbol.", testID)
+		{
+			ors, err := exg.CancelOpenOrders(context.Background(), "BTCUSDT")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to cancel the orders: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to cancel the orders.", success, testID)
+
+			if len(ors) != 1 || ors[0].OrderID != 11 || ors[0].Status != broker.OrderStatusCanceled {
+				t.Fatalf("\t%s\tTest %d:\tShould decode the canceled orders only: %+v", failed, testID, ors)
+			}
+			t.Logf("\t%s\tTest %d:\tShould decode the canceled orders only.", success, testID)
+		}
+	}
+}
+
+func TestBinanceDryRun(t *testing.T) {
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/time") {
+			fmt.Fprintf(w, `{"serverTime":%d}`, time.Now().UnixMilli())
+			return
+		}
+		path = r.URL.Path
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	var exg broker.Exchange = broker.NewBinance(broker.Config{
+		APIKey:      "key",
+		Signer:      &encode.Hmac{Key: []byte("secret")},
+		Environment: broker.EnvDryRun,
+		BaseURL:     srv.URL,
+	})
+
+	t.Log("Given the need to place orders without trading.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen placing an order in dry-run mode.", testID)
+		{
+			or, err := exg.PlaceOrder(context.Background(), broker.OrderRequest{
+				Symbol:        "BTCUSDT",
+				Side:          broker.OrderSideBuy,
+				Type:          broker.OrderTypeMarket,
+				Quantity:      0.5,
+				ClientOrderID: "dryrun",
+			})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to place the order: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to place the order.", success, testID)
+
+			if !strings.HasSuffix(path, "/order/test") {
+				t.Fatalf("\t%s\tTest %d:\tShould send the order to order/test: %s", failed, testID, path)
+			}
+			t.Logf("\t%s\tTest %d:\tShould send the order to order/test.", success, testID)
+
+			if or.Status != broker.OrderStatusNew || or.Symbol != "BTCUSDT" || or.ClientOrderID != "dryrun" || or.OrigQuantity != 0.5 {
+				t.Fatalf("\t%s\tTest %d:\tShould report the order NEW: %+v", failed, testID, or)
+			}
+			t.Logf("\t%s\tTest %d:\tShould report the order NEW.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen changing the account in dry-run mode.", testID)
+		{
+			path = ""
+			or, err := exg.CancelOrder(context.Background(), "BTCUSDT", 0)
+			if err != nil || or.Status != broker.OrderStatusCanceled || path != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould cancel the order without calling binance: %v %+v %s", failed, testID, err, or, path)
+			}
+			t.Logf("\t%s\tTest %d:\tShould cancel the order without calling binance.", success, testID)
+
+			if ors, err := exg.CancelOpenOrders(context.Background(), "BTCUSDT"); err != nil || len(ors) != 0 || path != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould cancel nothing on binance: %v %s", failed, testID, err, path)
+			}
+			t.Logf("\t%s\tTest %d:\tShould cancel nothing on binance.", success, testID)
+
+			_, err = exg.PlaceOCO(context.Background(), broker.OCORequest{Symbol: "BTCUSDT", Side: broker.OrderSideSell, Quantity: 0.5, Price: 4500, StopPrice: 3550})
+			if !errors.Is(err, broker.ErrDryRun) || !broker.IsRejected(err) || path != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse the order list: %v %s", failed, testID, err, path)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse the order list.", success, testID)
+
+			brk := exg.(*broker.Binance)
+			if _, err := brk.Request(context.Background(), http.MethodPost, "userDataStream"); !errors.Is(err, broker.ErrDryRun) || path != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse to create a listen key: %v %s", failed, testID, err, path)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse to create a listen key.", success, testID)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by the Breaker while the exchange is considered
+// unavailable, without calling it.
+var ErrCircuitOpen = errors.New("exchange unavailable, circuit breaker is open")
+
+// Default settings of the circuit breaker.
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// circuit publishes the state of the circuit breaker in the broker expvar map.
+var circuit = new(expvar.String)
+
+func init() {
+	circuit.Set(BreakerClosed.String())
+	usage.Set("circuit", circuit)
+}
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+// Set of circuit breaker states.
+const (
+	// BreakerClosed lets every call through.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen fails every call with ErrCircuitOpen until the cooldown
+	// is over.
+	BreakerOpen
+
+	// BreakerHalfOpen lets a single call through to probe the exchange, the
+	// others fail with ErrCircuitOpen until the probe returns.
+	BreakerHalfOpen
+)
+
+// String implements the fmt.Stringer interface.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// BreakerConfig holds the settings required to construct a Breaker.
+type BreakerConfig struct {
+	Threshold     int                         // Threshold is the number of consecutive failures that open the circuit
+	Cooldown      time.Duration               // Cooldown is how long the circuit stays open before probing
+	OnStateChange func(from, to BreakerState) // OnStateChange is called on every transition, it must not call the breaker
+}
+
+// Breaker is an Exchange that stops calling the exchange it wraps after
+// consecutive failures, so callers fail fast during an outage instead of
+// waiting for every request to time out.
+//
+// Only transport failures count: network errors, 5xx responses and the 429
+// and 418 answers binance sends once it throttles the client. Rejected
+// orders, missing credentials, requests refused in dry-run mode, cancelled
+// calls and errors of the paper broker are not failures of the exchange.
+//
+// The Breaker only wraps the REST calls of the Exchange. The kline and user
+// data streams dial their websockets on their own and keep redialing while
+// the circuit is open.
+type Breaker struct {
+	exchange      Exchange
+	threshold     int
+	cooldown      time.Duration
+	onStateChange func(from, to BreakerState)
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+}
+
+// NewBreaker constructs a Breaker around the exchange.
+func NewBreaker(exg Exchange, cfg BreakerConfig) *Breaker {
+	threshold := cfg.Threshold
+	if threshold <= 0 {
+		threshold = DefaultBreakerThreshold
+	}
+
+	cooldown := cfg.Cooldown
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+
+	return &Breaker{
+		exchange:      exg,
+		threshold:     threshold,
+		cooldown:      cooldown,
+		onStateChange: cfg.OnStateChange,
+	}
+}
+
+// State returns the current state of the circuit. An open circuit whose
+// cooldown is over is reported as half-open, the next call probes it.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Klines implements Exchange.
+func (b *Breaker) Klines(ctx context.Context, kq KlineQuery) (ks []Kline, err error) {
+	err = b.do(ctx, func() error {
+		ks, err = b.exchange.Klines(ctx, kq)
+		return err
+	})
+	return ks, err
+}
+
+// ExchangeInfo implements Exchange.
+func (b *Breaker) ExchangeInfo(ctx context.Context, symbols ...string) (sis []SymbolInfo, err error) {
+	err = b.do(ctx, func() error {
+		sis, err = b.exchange.ExchangeInfo(ctx, symbols...)
+		return err
+	})
+	return sis, err
+}
+
+// PlaceOrder implements Exchange.
+func (b *Breaker) PlaceOrder(ctx context.Context, or OrderRequest) (res OrderResult, err error) {
+	err = b.do(ctx, func() error {
+		res, err = b.exchange.PlaceOrder(ctx, or)
+		return err
+	})
+	return res, err
+}
+
+// PlaceOCO implements Exchange.
+func (b *Breaker) PlaceOCO(ctx context.Context, oco OCORequest) (res OCOResult, err error) {
+	err = b.do(ctx, func() error {
+		res, err = b.exchange.PlaceOCO(ctx, oco)
+		return err
+	})
+	return res, err
+}
+
+// CancelOrder implements Exchange.
+func (b *Breaker) CancelOrder(ctx context.Context, symbol string, orderID int64) (res OrderResult, err error) {
+	err = b.do(ctx, func() error {
+		res, err = b.exchange.CancelOrder(ctx, symbol, orderID)
+		return err
+	})
+	return res, err
+}
+
+// CancelOpenOrders implements Exchange.
+func (b *Breaker) CancelOpenOrders(ctx context.Context, symbol string) (ors []OrderResult, err error) {
+	err = b.do(ctx, func() error {
+		ors, err = b.exchange.CancelOpenOrders(ctx, symbol)
+		return err
+	})
+	return ors, err
+}
+
+// QueryOrder implements Exchange.
+func (b *Breaker) QueryOrder(ctx context.Context, symbol string, orderID int64) (res OrderResult, err error) {
+	err = b.do(ctx, func() error {
+		res, err = b.exchange.QueryOrder(ctx, symbol, orderID)
+		return err
+	})
+	return res, err
+}
+
+// OpenOrders implements Exchange.
+func (b *Breaker) OpenOrders(ctx context.Context, symbol string) (ors []OrderResult, err error) {
+	err = b.do(ctx, func() error {
+		ors, err = b.exchange.OpenOrders(ctx, symbol)
+		return err
+	})
+	return ors, err
+}
+
+// AllOrders implements Exchange.
+func (b *Breaker) AllOrders(ctx context.Context, symbol string, start time.Time) (ors []OrderResult, err error) {
+	err = b.do(ctx, func() error {
+		ors, err = b.exchange.AllOrders(ctx, symbol, start)
+		return err
+	})
+	return ors, err
+}
+
+// Account implements Exchange.
+func (b *Breaker) Account(ctx context.Context) (acc Account, err error) {
+	err = b.do(ctx, func() error {
+		acc, err = b.exchange.Account(ctx)
+		return err
+	})
+	return acc, err
+}
+
+// ServerTime implements Exchange.
+func (b *Breaker) ServerTime(ctx context.Context) (t time.Time, err error) {
+	err = b.do(ctx, func() error {
+		t, err = b.exchange.ServerTime(ctx)
+		return err
+	})
+	return t, err
+}
+
+// do runs the call unless the circuit is open, and records its outcome.
+func (b *Breaker) do(ctx context.Context, call func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+
+	err := call()
+	b.record(ctx, err)
+
+	return err
+}
+
+// allow reports whether a call can go through. The first call after the
+// cooldown moves the circuit to half-open and probes the exchange.
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		return nil
+
+	case BreakerHalfOpen:
+		return fmt.Errorf("probe in progress: %w", ErrCircuitOpen)
+	}
+
+	return nil
+}
+
+// record updates the circuit with the outcome of a call.
+func (b *Breaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// A call cancelled by the caller says nothing about the exchange. A probe
+	// that didn't finish leaves the circuit open for another one.
+	if err != nil && ctx.Err() != nil {
+		if b.state == BreakerHalfOpen {
+			b.open()
+		}
+		return
+	}
+
+	if !isOutage(err) {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.setState(BreakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.open()
+	}
+}
+
+// open opens the circuit, restarting the cooldown.
+func (b *Breaker) open() {
+	b.openedAt = time.Now()
+	if b.state != BreakerOpen {
+		b.setState(BreakerOpen)
+	}
+}
+
+// setState moves the circuit to a new state and publishes it.
+func (b *Breaker) setState(state BreakerState) {
+	from := b.state
+	b.state = state
+	circuit.Set(state.String())
+
+	if b.onStateChange != nil {
+		b.onStateChange(from, state)
+	}
+}
+
+// isOutage reports whether the error is a transport failure, telling the
+// exchange is unhealthy or throttling the client.
+func isOutage(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if ae := GetAPIError(err); ae != nil {
+		switch {
+		case ae.Status >= http.StatusInternalServerError,
+			ae.Status == http.StatusTooManyRequests,
+			ae.Status == http.StatusTeapot:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,76 @@
+package broker_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lgarciaaco/machina-api/business/broker"
+)
+
+func TestBreaker(t *testing.T) {
+	timeout := broker.Interaction{Method: "GET", Endpoint: "klines", Params: []string{"symbol", "BTCUSDT", "interval", "1h"}, Message: "dial tcp: i/o timeout", Network: true}
+	throttled := timeout
+	throttled.Message, throttled.Network, throttled.Status, throttled.Error = "", false, 429, &broker.APIError{Code: -1003, Message: "Too many requests."}
+	ok := timeout
+	ok.Message, ok.Network, ok.Response = "", false, []byte(`[]`)
+	unknown := broker.Interaction{Method: "GET", Endpoint: "exchangeInfo", Params: []string{"symbol", "NOPE"}, Status: 400, Error: &broker.APIError{Code: -1121, Message: "Invalid symbol."}}
+	local := broker.Interaction{Method: "GET", Endpoint: "exchangeInfo", Params: []string{"symbol", "ETHUSDT"}, Message: "no candles synced"}
+
+	rep := broker.NewReplayer(broker.Cassette{Interactions: []broker.Interaction{throttled, timeout, timeout, ok, unknown, local}})
+	brk := broker.NewBreaker(broker.NewClient(rep), broker.BreakerConfig{Threshold: 2, Cooldown: 50 * time.Millisecond})
+
+	ctx := context.Background()
+	kq := broker.KlineQuery{Symbol: "BTCUSDT", Interval: "1h"}
+
+	t.Log("Given the need to fail fast while the exchange is down.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the exchange keeps failing.", testID)
+		{
+			if _, err := brk.ExchangeInfo(ctx, "NOPE"); !errors.Is(err, broker.ErrUnknownSymbol) || brk.State() != broker.BreakerClosed {
+				t.Fatalf("\t%s\tTest %d:\tShould not count rejected requests: %v %s", failed, testID, err, brk.State())
+			}
+			t.Logf("\t%s\tTest %d:\tShould not count rejected requests.", success, testID)
+
+			if _, err := brk.ExchangeInfo(ctx, "ETHUSDT"); err == nil || brk.State() != broker.BreakerClosed {
+				t.Fatalf("\t%s\tTest %d:\tShould not count errors other than transport errors: %v %s", failed, testID, err, brk.State())
+			}
+			t.Logf("\t%s\tTest %d:\tShould not count errors other than transport errors.", success, testID)
+
+			brk.Klines(ctx, kq)
+			brk.Klines(ctx, kq)
+			if brk.State() != broker.BreakerOpen {
+				t.Fatalf("\t%s\tTest %d:\tShould open after a throttled answer and a timeout: %s", failed, testID, brk.State())
+			}
+			t.Logf("\t%s\tTest %d:\tShould open after a throttled answer and a timeout.", success, testID)
+
+			if _, err := brk.Klines(ctx, kq); !errors.Is(err, broker.ErrCircuitOpen) {
+				t.Fatalf("\t%s\tTest %d:\tShould fail fast while open: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fail fast while open.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the cooldown is over.", testID)
+		{
+			time.Sleep(60 * time.Millisecond)
+			if brk.State() != broker.BreakerHalfOpen {
+				t.Fatalf("\t%s\tTest %d:\tShould be half-open: %s", failed, testID, brk.State())
+			}
+			t.Logf("\t%s\tTest %d:\tShould be half-open.", success, testID)
+
+			if _, err := brk.Klines(ctx, kq); err == nil || errors.Is(err, broker.ErrCircuitOpen) || brk.State() != broker.BreakerOpen {
+				t.Fatalf("\t%s\tTest %d:\tShould probe and open again on failure: %v %s", failed, testID, err, brk.State())
+			}
+			t.Logf("\t%s\tTest %d:\tShould probe and open again on failure.", success, testID)
+
+			time.Sleep(60 * time.Millisecond)
+			if _, err := brk.Klines(ctx, kq); err != nil || brk.State() != broker.BreakerClosed {
+				t.Fatalf("\t%s\tTest %d:\tShould close once a probe succeeds: %v %s", failed, testID, err, brk.State())
+			}
+			t.Logf("\t%s\tTest %d:\tShould close once a probe succeeds.", success, testID)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package broker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrUnmatchedRequest is returned by the Replayer for requests that are not
+// in the cassette.
+var ErrUnmatchedRequest = errors.New("request not recorded in cassette")
+
+// Interaction is a request sent to the broker and the response it got.
+type Interaction struct {
+	Method   string          `json:"method"`
+	Endpoint string          `json:"endpoint"`
+	Params   []string        `json:"params,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Status   int             `json:"status,omitempty"` // Status is the http status of binance errors
+	Error    *APIError       `json:"error,omitempty"`
+	Message  string          `json:"message,omitempty"` // Message holds errors that are not binance errors
+	Network  bool            `json:"network,omitempty"` // Network tells the message is a network error
+}
+
+// volatileParams are the parameters whose values change on every run, only
+// their keys have to match.
+var volatileParams = map[string]bool{
+	"newClientOrderId": true,
+	"startTime":        true,
+}
+
+// matches reports whether the interaction was recorded for the request.
+func (in Interaction) matches(method, endpoint string, kv []string) bool {
+	if in.Method != method || in.Endpoint != endpoint || len(in.Params) != len(kv) {
+		return false
+	}
+	for i := range kv {
+		if i%2 == 1 && volatileParams[kv[i-1]] {
+			continue
+		}
+		if in.Params[i] != kv[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Cassette is the set of interactions recorded against a broker, and the
+// server time it reported.
+type Cassette struct {
+	ServerTime   int64         `json:"server_time,omitempty"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// LoadCassette reads a cassette from disk.
+func LoadCassette(path string) (Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Cassette{}, fmt.Errorf("reading cassette: %w", err)
+	}
+
+	var cst Cassette
+	if err := json.Unmarshal(data, &cst); err != nil {
+		return Cassette{}, fmt.Errorf("decoding cassette %s: %w", path, err)
+	}
+
+	return cst, nil
+}
+
+// Save writes the cassette to disk, creating the directory if needed.
+func (cst Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(cst, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding cassette: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating cassette directory: %w", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("writing cassette: %w", err)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// Recorder is a Broker that forwards every request to another broker and
+// records the interactions in a cassette.
+type Recorder struct {
+	brk  Broker
+	path string
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder constructs a Recorder over the broker. The cassette is written
+// to path when calling Save.
+func NewRecorder(brk Broker, path string) *Recorder {
+	return &Recorder{
+		brk:  brk,
+		path: path,
+	}
+}
+
+// Request forwards the request and records the response, or the error
+// returned by the broker.
+func (r *Recorder) Request(ctx context.Context, method, endpoint string, keysAndValues ...string) (io.Reader, error) {
+	in := Interaction{
+		Method:   method,
+		Endpoint: endpoint,
+		Params:   keysAndValues,
+	}
+
+	rd, err := r.brk.Request(ctx, method, endpoint, keysAndValues...)
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			in.Status = apiErr.Status
+			in.Error = apiErr
+		} else {
+			var netErr net.Error
+			in.Message = err.Error()
+			in.Network = errors.As(err, &netErr)
+		}
+		r.record(in)
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return nil, fmt.Errorf("reading response of %s: %w", endpoint, err)
+	}
+	in.Response = body
+
+	r.record(in)
+	return bytes.NewReader(body), nil
+}
+
+// Time forwards the call and records the server time.
+func (r *Recorder) Time(ctx context.Context) (int64, error) {
+	t, err := r.brk.Time(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	r.cassette.ServerTime = t
+	r.mu.Unlock()
+
+	return t, nil
+}
+
+// Save writes the recorded interactions to the cassette file.
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cassette.Save(r.path)
+}
+
+// record appends an interaction to the cassette.
+func (r *Recorder) record(in Interaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cassette.Interactions = append(r.cassette.Interactions, in)
+}
+
+// =============================================================================
+
+// Replayer is a Broker that answers requests with the interactions of a
+// cassette and never reaches the network.
+type Replayer struct {
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// NewReplayer constructs a Replayer for the cassette.
+func NewReplayer(cst Cassette) *Replayer {
+	return &Replayer{
+		cassette: cst,
+		used:     make([]bool, len(cst.Interactions)),
+	}
+}
+
+// LoadReplayer constructs a Replayer for the cassette stored in path.
+func LoadReplayer(path string) (*Replayer, error) {
+	cst, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(cst), nil
+}
+
+// Request answers with the first interaction recorded for the same method,
+// endpoint and parameters that was not replayed yet. Once every match was
+// replayed the last one is repeated, so polling keeps working. It fails with
+// ErrUnmatchedRequest when nothing was recorded for the request.
+func (r *Replayer) Request(ctx context.Context, method, endpoint string, keysAndValues ...string) (io.Reader, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	match := -1
+	for i, in := range r.cassette.Interactions {
+		if !in.matches(method, endpoint, keysAndValues) {
+			continue
+		}
+		match = i
+		if !r.used[i] {
+			break
+		}
+	}
+	if match == -1 {
+		return nil, fmt.Errorf("%s %s %v: %w", method, endpoint, keysAndValues, ErrUnmatchedRequest)
+	}
+	r.used[match] = true
+
+	in := r.cassette.Interactions[match]
+	switch {
+	case in.Error != nil:
+		apiErr := *in.Error
+		apiErr.Status = in.Status
+		return nil, &apiErr
+	case in.Network:
+		return nil, &net.OpError{Op: "replay", Net: "tcp", Err: errors.New(in.Message)}
+	case in.Message != "":
+		return nil, errors.New(in.Message)
+	}
+
+	return bytes.NewReader(in.Response), nil
+}
+
+// Time returns the recorded server time.
+func (r *Replayer) Time(ctx context.Context) (int64, error) {
+	return r.cassette.ServerTime, nil
+}
+
+// Unused returns the interactions that were never replayed, a test can
+// check them to make sure every recorded request was sent.
+func (r *Replayer) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ins []Interaction
+	for i, in := range r.cassette.Interactions {
+		if !r.used[i] {
+			ins = append(ins, in)
+		}
+	}
+	return ins
+}
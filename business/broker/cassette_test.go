@@ -0,0 +1,105 @@
+package broker_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lgarciaaco/machina-api/business/broker"
+)
+
+func TestCassette(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("symbol") != "BTCUSDT" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":-1121,"msg":"Invalid symbol."}`))
+			return
+		}
+		w.Write([]byte(`[[1499040000000,"0.01634790","0.80000000","0.01575800","0.01577100","148976.11427815",1499644799999,"2434.19055334",308,"1756.87402397","28.46694368","17928899.62484339"]]`))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "cassettes", "klines.json")
+	kq := broker.KlineQuery{Symbol: "BTCUSDT", Interval: "1h", Limit: 1}
+
+	t.Log("Given the need to replay binance traffic offline.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen recording the traffic.", testID)
+		{
+			rec := broker.NewRecorder(broker.NewBinance(broker.Config{BaseURL: srv.URL}), path)
+			exg := broker.NewClient(rec)
+
+			if _, err := exg.Klines(context.Background(), kq); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to fetch klines: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to fetch klines.", success, testID)
+
+			if _, err := exg.ExchangeInfo(context.Background(), "NOPE"); !errors.Is(err, broker.ErrUnknownSymbol) {
+				t.Fatalf("\t%s\tTest %d:\tShould get an unknown symbol error: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get an unknown symbol error.", success, testID)
+
+			if err := rec.Save(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to save the cassette: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to save the cassette.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen replaying the traffic.", testID)
+		{
+			rep, err := broker.LoadReplayer(path)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to load the cassette: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to load the cassette.", success, testID)
+			exg := broker.NewClient(rep)
+
+			ks, err := exg.Klines(context.Background(), kq)
+			if err != nil || len(ks) != 1 || ks[0].OpenPrice != 0.0163479 {
+				t.Fatalf("\t%s\tTest %d:\tShould replay the klines: %+v %v", failed, testID, ks, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould replay the klines.", success, testID)
+
+			if _, err := exg.ExchangeInfo(context.Background(), "NOPE"); !errors.Is(err, broker.ErrUnknownSymbol) {
+				t.Fatalf("\t%s\tTest %d:\tShould replay the unknown symbol error: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould replay the unknown symbol error.", success, testID)
+
+			if len(rep.Unused()) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould replay every interaction: %+v", failed, testID, rep.Unused())
+			}
+			t.Logf("\t%s\tTest %d:\tShould replay every interaction.", success, testID)
+
+			kq.Interval = "4h"
+			if _, err := exg.Klines(context.Background(), kq); !errors.Is(err, broker.ErrUnmatchedRequest) {
+				t.Fatalf("\t%s\tTest %d:\tShould fail on unmatched requests: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fail on unmatched requests.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen replaying requests with values that change on every run.", testID)
+		{
+			exg := broker.NewClient(broker.NewReplayer(broker.Cassette{
+				Interactions: []broker.Interaction{{
+					Method:   http.MethodGet,
+					Endpoint: "allOrders",
+					Params:   []string{"symbol", "BTCUSDT", "startTime", "1499040000000", "limit", "1000"},
+					Response: []byte(`[{"symbol":"BTCUSDT","orderId":1,"clientOrderId":"abc","price":"0","origQty":"1","executedQty":"1","cummulativeQuoteQty":"1","status":"FILLED","type":"MARKET","side":"BUY","time":1499040000000}]`),
+				}},
+			}))
+
+			ors, err := exg.AllOrders(context.Background(), "BTCUSDT", time.Now())
+			if err != nil || len(ors) != 1 || ors[0].OrderID != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould match ignoring the start time: %+v %v", failed, testID, ors, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould match ignoring the start time.", success, testID)
+		}
+	}
+}
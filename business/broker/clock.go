@@ -0,0 +1,60 @@
+package broker
+
+import (
+	"sync"
+	"time"
+)
+
+// Default settings used to keep the local clock aligned with binance.
+const (
+	DefaultRecvWindow       = 5 * time.Second
+	DefaultTimeSyncInterval = 10 * time.Minute
+)
+
+// clock keeps the offset between the local clock and the binance server
+// clock. Signed requests are stamped with the server time, so a drift on the
+// local clock doesn't get them rejected.
+type clock struct {
+	mu       sync.RWMutex
+	offset   time.Duration // server time - local time
+	syncedAt time.Time     // last time the offset was refreshed
+	interval time.Duration // how long an offset is trusted
+}
+
+// newClock constructs a clock that needs to be synchronized before use.
+func newClock(interval time.Duration) *clock {
+	if interval <= 0 {
+		interval = DefaultTimeSyncInterval
+	}
+	return &clock{interval: interval}
+}
+
+// now returns the current time in the binance server clock.
+func (c *clock) now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return time.Now().Add(c.offset)
+}
+
+// stale reports whether the offset needs to be refreshed.
+func (c *clock) stale() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.syncedAt.IsZero() || time.Since(c.syncedAt) > c.interval
+}
+
+// set records the offset from a server time fetched between sent and
+// received. Network latency is assumed to be symmetric.
+func (c *clock) set(server time.Time, sent time.Time, received time.Time) {
+	local := sent.Add(received.Sub(sent) / 2)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.offset = server.Sub(local)
+	c.syncedAt = received
+
+	usage.Set("clock_offset_ms", intVar(int(c.offset.Milliseconds())))
+}
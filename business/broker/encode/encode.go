@@ -1,10 +1,31 @@
-// Package encode signs HMAC SHA25 for binance request
+// Package encode signs requests for binance. HMAC SHA256, Ed25519 and RSA
+// api keys are supported.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/rest-api.md#signed-trade-user_data-and-margin-endpoint-security
 package encode
 
 import (
+	"crypto"
+	"crypto/ed25519"
 	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Set of signer types.
+const (
+	TypeHmac    = "hmac"
+	TypeEd25519 = "ed25519"
+	TypeRSA     = "rsa"
 )
 
 // Signer signs provided payloads.
@@ -27,3 +48,145 @@ func (hs *Hmac) Sign(payload []byte) (s string, err error) {
 	}
 	return hex.EncodeToString(mac.Sum(nil)), nil
 }
+
+// Ed25519 uses an Ed25519 private key for signing payloads.
+type Ed25519 struct {
+	Key ed25519.PrivateKey
+}
+
+// LoadEd25519 constructs an Ed25519 signer from a PEM encoded PKCS #8
+// private key file.
+func LoadEd25519(path string) (*Ed25519, error) {
+	privatePEM, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ParseEd25519PrivateKeyFromPEM(privatePEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ed25519{Key: key}, nil
+}
+
+// Sign signs provided payload and returns the base64 encoded signature.
+func (es *Ed25519) Sign(payload []byte) (string, error) {
+	if len(es.Key) != ed25519.PrivateKeySize {
+		return "", errors.New("invalid ed25519 private key")
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(es.Key, payload)), nil
+}
+
+// RSA uses an RSA private key for signing payloads with RSASSA-PKCS1-v1_5
+// and SHA256.
+type RSA struct {
+	Key *rsa.PrivateKey
+}
+
+// KeyStore declares the behavior required to look up RSA private keys, it is
+// implemented by the foundation keystore.
+type KeyStore interface {
+	PrivateKey(kid string) (*rsa.PrivateKey, error)
+}
+
+// LoadRSA constructs an RSA signer from a PEM encoded PKCS #1 or PKCS #8
+// private key file.
+func LoadRSA(path string) (*RSA, error) {
+	privatePEM, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ParseRSAPrivateKeyFromPEM(privatePEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RSA{Key: key}, nil
+}
+
+// NewRSAFromKeyStore constructs an RSA signer from the private key stored
+// under kid.
+func NewRSAFromKeyStore(ks KeyStore, kid string) (*RSA, error) {
+	key, err := ks.PrivateKey(kid)
+	if err != nil {
+		return nil, fmt.Errorf("looking up key %q: %w", kid, err)
+	}
+
+	return &RSA{Key: key}, nil
+}
+
+// Sign signs provided payload and returns the base64 encoded signature.
+func (rs *RSA) Sign(payload []byte) (string, error) {
+	if rs.Key == nil {
+		return "", errors.New("invalid rsa private key")
+	}
+
+	sum := sha256.Sum256(payload)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, rs.Key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", fmt.Errorf("signing payload: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// ParseEd25519PrivateKeyFromPEM parses a PEM encoded PKCS #8 Ed25519
+// private key.
+func ParseEd25519PrivateKeyFromPEM(privatePEM []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(privatePEM)
+	if block == nil {
+		return nil, errors.New("key must be PEM encoded")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key: %w", err)
+	}
+
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is not an ed25519 private key")
+	}
+	return key, nil
+}
+
+// ParseRSAPrivateKeyFromPEM parses a PEM encoded PKCS #1 or PKCS #8 RSA
+// private key.
+func ParseRSAPrivateKeyFromPEM(privatePEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(privatePEM)
+	if block == nil {
+		return nil, errors.New("key must be PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key: %w", err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is not an rsa private key")
+	}
+	return key, nil
+}
+
+// readPEM reads a private key file. The file size is limited to 1 megabyte,
+// more than enough for any PEM file.
+func readPEM(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening key file: %w", err)
+	}
+	defer file.Close()
+
+	privatePEM, err := io.ReadAll(io.LimitReader(file, 1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("reading private key: %w", err)
+	}
+	return privatePEM, nil
+}
@@ -0,0 +1,136 @@
+package encode_test
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lgarciaaco/machina-api/business/broker/encode"
+	"github.com/lgarciaaco/machina-api/foundation/keystore"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+// payload is the query string binance uses in its signing examples.
+var payload = []byte("symbol=BTCUSDT&side=SELL&type=LIMIT&timeInForce=GTC&quantity=1&price=0.2&timestamp=1668481559918&recvWindow=5000")
+
+func TestEd25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	path := writeKey(t, priv)
+
+	t.Log("Given the need to sign requests with an Ed25519 api key.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen loading the key from disk.", testID)
+		{
+			signer, err := encode.LoadEd25519(path)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to load the key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to load the key.", success, testID)
+
+			s, err := signer.Sign(payload)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sign: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to sign.", success, testID)
+
+			sig, err := base64.StdEncoding.DecodeString(s)
+			if err != nil || !ed25519.Verify(pub, payload, sig) {
+				t.Fatalf("\t%s\tTest %d:\tShould produce a valid base64 signature: %s", failed, testID, s)
+			}
+			t.Logf("\t%s\tTest %d:\tShould produce a valid base64 signature.", success, testID)
+
+			if _, err := encode.LoadRSA(path); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not load the key as RSA.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not load the key as RSA.", success, testID)
+		}
+	}
+}
+
+func TestRSA(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	path := writeKey(t, priv)
+
+	t.Log("Given the need to sign requests with an RSA api key.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen loading the key from disk.", testID)
+		{
+			signer, err := encode.LoadRSA(path)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to load the key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to load the key.", success, testID)
+
+			verifyRSA(t, testID, signer, &priv.PublicKey)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen loading the key from the keystore.", testID)
+		{
+			ks := keystore.NewMap(map[string]*rsa.PrivateKey{"binance": priv})
+			signer, err := encode.NewRSAFromKeyStore(ks, "binance")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to load the key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to load the key.", success, testID)
+
+			verifyRSA(t, testID, signer, &priv.PublicKey)
+
+			if _, err := encode.NewRSAFromKeyStore(ks, "unknown"); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould fail with an unknown key id.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fail with an unknown key id.", success, testID)
+		}
+	}
+}
+
+// verifyRSA signs the payload and checks the signature against the public key.
+func verifyRSA(t *testing.T, testID int, signer encode.Signer, pub *rsa.PublicKey) {
+	s, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatalf("\t%s\tTest %d:\tShould be able to sign: %v", failed, testID, err)
+	}
+	t.Logf("\t%s\tTest %d:\tShould be able to sign.", success, testID)
+
+	sig, err := base64.StdEncoding.DecodeString(s)
+	sum := sha256.Sum256(payload)
+	if err != nil || rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) != nil {
+		t.Fatalf("\t%s\tTest %d:\tShould produce a valid base64 signature: %s", failed, testID, s)
+	}
+	t.Logf("\t%s\tTest %d:\tShould produce a valid base64 signature.", success, testID)
+}
+
+// writeKey stores the private key as a PKCS #8 PEM file and returns its path.
+func writeKey(t *testing.T, key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshaling key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("writing key: %v", err)
+	}
+	return path
+}
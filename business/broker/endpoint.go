@@ -0,0 +1,99 @@
+package broker
+
+import "fmt"
+
+// Environment defines which binance deployment the broker talks to.
+type Environment string
+
+// Set of environments supported by the broker.
+const (
+	// EnvLive sends every request to the production api, orders are real.
+	EnvLive Environment = "live"
+
+	// EnvTestNet sends every request to the binance spot test network. Orders
+	// are matched but funds are not real.
+	EnvTestNet Environment = "testnet"
+
+	// EnvDryRun reads market data from the production api but routes order
+	// creation to order/test, which validates the order without sending it
+	// to the matching engine. Orders are reported NEW and never fill, they
+	// are canceled without calling binance. Every other request that changes
+	// the account, OCO order lists and listen keys included, fails with
+	// ErrDryRun.
+	EnvDryRun Environment = "dryrun"
+
+	// EnvPaper reads market data from the production api but fills orders
+	// with the Paper broker, nothing is sent to the matching engine.
+	EnvPaper Environment = "paper"
+)
+
+// ParseEnvironment converts a string into an Environment. It fails if the
+// string is not a known environment.
+func ParseEnvironment(env string) (Environment, error) {
+	switch e := Environment(env); e {
+	case EnvLive, EnvTestNet, EnvDryRun, EnvPaper:
+		return e, nil
+	}
+	return "", fmt.Errorf("unknown broker environment %q", env)
+}
+
+// baseURL returns the api base url for the environment.
+func (e Environment) baseURL() string {
+	if e == EnvTestNet {
+		return TestNet
+	}
+	return APIV3
+}
+
+// streamURL returns the websocket streams base url for the environment.
+func (e Environment) streamURL() string {
+	if e == EnvTestNet {
+		return StreamTestNet
+	}
+	return StreamNet
+}
+
+// Security defines the authentication an endpoint requires.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/rest-api.md#endpoint-security-type
+type Security int
+
+// Set of security types supported by binance.
+const (
+	// SecurityNone endpoints can be freely accessed.
+	SecurityNone Security = iota
+
+	// SecurityAPIKey endpoints require a valid api key in the X-MBX-APIKEY header.
+	SecurityAPIKey
+
+	// SecuritySigned endpoints require a valid api key and a signature
+	// computed over the query string.
+	SecuritySigned
+)
+
+// DefaultSecurity maps each api v3 endpoint to the security it requires.
+// Endpoints that are not listed are treated as SecurityNone.
+var DefaultSecurity = map[string]Security{
+	"ping":              SecurityNone,
+	"time":              SecurityNone,
+	"exchangeInfo":      SecurityNone,
+	"depth":             SecurityNone,
+	"trades":            SecurityNone,
+	"klines":            SecurityNone,
+	"avgPrice":          SecurityNone,
+	"ticker/24hr":       SecurityNone,
+	"ticker/price":      SecurityNone,
+	"ticker/bookTicker": SecurityNone,
+	"historicalTrades":  SecurityAPIKey,
+	"userDataStream":    SecurityAPIKey,
+	"order":             SecuritySigned,
+	"order/test":        SecuritySigned,
+	"order/oco":         SecuritySigned,
+	"orderList":         SecuritySigned,
+	"allOrderList":      SecuritySigned,
+	"openOrderList":     SecuritySigned,
+	"openOrders":        SecuritySigned,
+	"allOrders":         SecuritySigned,
+	"account":           SecuritySigned,
+	"myTrades":          SecuritySigned,
+}
@@ -0,0 +1,125 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Set of errors mapped from binance error codes. Use errors.Is to check
+// an error returned by the broker against them.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/errors.md
+var (
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrFilterFailure       = errors.New("order rejected by symbol filter")
+	ErrUnknownSymbol       = errors.New("unknown symbol")
+	ErrUnknownOrder        = errors.New("unknown order")
+	ErrInvalidTimestamp    = errors.New("timestamp outside of recvWindow")
+	ErrInvalidCredentials  = errors.New("invalid api key or signature")
+)
+
+// Set of binance error codes the broker knows about.
+const (
+	codeTooManyRequests  = -1003
+	codeInvalidTimestamp = -1021
+	codeInvalidSignature = -1022
+	codeFilterFailure    = -1013
+	codeInvalidSymbol    = -1121
+	codeNewOrderRejected = -2010
+	codeCancelRejected   = -2011
+	codeNoSuchOrder      = -2013
+	codeInvalidAPIKeyIP  = -2014
+	codeRejectedMBXKey   = -2015
+
+	msgInsufficientBalance = "insufficient balance"
+	msgUnknownOrder        = "unknown order"
+)
+
+// APIError is the error binance returns in the body of a failed request.
+type APIError struct {
+	Status  int    `json:"-"`    // HTTP status code of the response
+	Code    int    `json:"code"` // Binance error code
+	Message string `json:"msg"`  // Binance error message
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	if e.Code == 0 {
+		return fmt.Sprintf("binance status [%d]: %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("binance error [%d]: %s", e.Code, e.Message)
+}
+
+// Is reports whether the error matches one of the sentinel errors of
+// this package.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrInsufficientBalance:
+		return e.Code == codeNewOrderRejected && strings.Contains(strings.ToLower(e.Message), msgInsufficientBalance)
+	case ErrFilterFailure:
+		return e.Code == codeFilterFailure
+	case ErrUnknownSymbol:
+		return e.Code == codeInvalidSymbol
+	case ErrUnknownOrder:
+		return e.Code == codeNoSuchOrder || (e.Code == codeCancelRejected && strings.Contains(strings.ToLower(e.Message), msgUnknownOrder))
+	case ErrInvalidTimestamp:
+		return e.Code == codeInvalidTimestamp
+	case ErrInvalidCredentials:
+		return e.Code == codeInvalidSignature || e.Code == codeInvalidAPIKeyIP || e.Code == codeRejectedMBXKey
+	case ErrRateLimited:
+		return e.Status == http.StatusTooManyRequests || e.Code == codeTooManyRequests
+	case ErrIPBanned:
+		return e.Status == http.StatusTeapot
+	}
+	return false
+}
+
+// IsRejected reports whether the error proves an order never reached the
+// exchange. Other errors, like timeouts and 5xx responses, leave the outcome
+// of the order unknown.
+func IsRejected(err error) bool {
+	switch {
+	case errors.Is(err, ErrCircuitOpen),
+		errors.Is(err, ErrUnsupportedOrderType),
+		errors.Is(err, ErrInsufficientBalance),
+		errors.Is(err, ErrUnknownSymbol),
+		errors.Is(err, ErrDryRun):
+		return true
+	}
+
+	ae := GetAPIError(err)
+	return ae != nil && ae.Status < http.StatusInternalServerError
+}
+
+// IsAPIError checks if an error of type APIError exists.
+func IsAPIError(err error) bool {
+	var ae *APIError
+	return errors.As(err, &ae)
+}
+
+// GetAPIError returns a copy of the APIError pointer.
+func GetAPIError(err error) *APIError {
+	var ae *APIError
+	if !errors.As(err, &ae) {
+		return nil
+	}
+	return ae
+}
+
+// newAPIError decodes the body of a failed response. When the body is not
+// a binance error document, the status text is used as message.
+func newAPIError(resp *http.Response) *APIError {
+	ae := APIError{Status: resp.StatusCode}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil || json.Unmarshal(b, &ae) != nil || ae.Message == "" {
+		ae.Code = 0
+		ae.Message = http.StatusText(resp.StatusCode)
+	}
+
+	return &ae
+}
@@ -0,0 +1,760 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Exchange is the typed api of a trading venue. The core packages only depend
+// on this interface, supporting a new venue means writing a new adapter.
+type Exchange interface {
+	Klines(ctx context.Context, kq KlineQuery) ([]Kline, error)
+	ExchangeInfo(ctx context.Context, symbols ...string) ([]SymbolInfo, error)
+	PlaceOrder(ctx context.Context, or OrderRequest) (OrderResult, error)
+	PlaceOCO(ctx context.Context, oco OCORequest) (OCOResult, error)
+	CancelOrder(ctx context.Context, symbol string, orderID int64) (OrderResult, error)
+	CancelOpenOrders(ctx context.Context, symbol string) ([]OrderResult, error)
+	QueryOrder(ctx context.Context, symbol string, orderID int64) (OrderResult, error)
+	OpenOrders(ctx context.Context, symbol string) ([]OrderResult, error)
+	AllOrders(ctx context.Context, symbol string, start time.Time) ([]OrderResult, error)
+	Account(ctx context.Context) (Account, error)
+	ServerTime(ctx context.Context) (time.Time, error)
+}
+
+// KlineQuery selects the klines of a symbol and interval. Zero Start and End
+// return the most recent klines.
+type KlineQuery struct {
+	Symbol   string
+	Interval string
+	Start    time.Time
+	End      time.Time
+	Limit    int
+}
+
+// SymbolInfo holds the trading rules of a symbol. The filters the symbol
+// doesn't have are left as zero.
+type SymbolInfo struct {
+	Symbol                     string
+	Status                     string
+	BaseAsset                  string
+	BaseAssetPrecision         int
+	QuoteAsset                 string
+	QuotePrecision             int
+	BaseCommissionPrecision    int
+	QuoteCommissionPrecision   int
+	IcebergAllowed             bool
+	OcoAllowed                 bool
+	QuoteOrderQtyMarketAllowed bool
+	IsSpotTradingAllowed       bool
+	IsMarginTradingAllowed     bool
+	MinPrice                   float64 // PRICE_FILTER
+	MaxPrice                   float64
+	TickSize                   float64
+	MinQty                     float64 // LOT_SIZE
+	MaxQty                     float64
+	StepSize                   float64
+	MinNotional                float64 // MIN_NOTIONAL or NOTIONAL
+	MaxNotional                float64 // NOTIONAL
+	ApplyMinToMarket           bool    // MinNotional applies to MARKET orders
+	ApplyMaxToMarket           bool    // MaxNotional applies to MARKET orders
+	MarketMinQty               float64 // MARKET_LOT_SIZE
+	MarketMaxQty               float64
+	MarketStepSize             float64
+}
+
+// OrderRequest holds the parameters of a new order. Price is the limit price
+// of every type but MARKET, StopPrice triggers STOP_LOSS_LIMIT and
+// TAKE_PROFIT_LIMIT orders. MARKET orders can set QuoteQuantity instead of
+// Quantity, to spend or receive an amount of the quote asset. ClientOrderID is
+// optional, the exchange generates one when empty.
+type OrderRequest struct {
+	Symbol        string
+	Side          string
+	Type          string
+	Quantity      float64
+	QuoteQuantity float64
+	Price         float64
+	StopPrice     float64
+	TimeInForce   string
+	ClientOrderID string
+}
+
+// OCORequest holds the parameters of a one-cancels-the-other order list. The
+// list has a LIMIT_MAKER leg at Price and a STOP_LOSS_LIMIT leg triggered at
+// StopPrice, which sells or buys at StopLimitPrice. When a leg executes the
+// exchange cancels the other. The client order ids are optional.
+type OCORequest struct {
+	Symbol               string
+	Side                 string
+	Quantity             float64
+	Price                float64
+	StopPrice            float64
+	StopLimitPrice       float64
+	StopLimitTimeInForce string
+	ListClientOrderID    string
+	LimitClientOrderID   string
+	StopClientOrderID    string
+}
+
+// OCOResult is the state of an order list as reported by the exchange. Orders
+// holds the LIMIT_MAKER and STOP_LOSS_LIMIT legs.
+type OCOResult struct {
+	Symbol            string
+	OrderListID       int64
+	ListClientOrderID string
+	ListOrderStatus   string
+	TransactTime      time.Time
+	Orders            []OrderResult
+}
+
+// OrderFill is a partial execution of an order.
+type OrderFill struct {
+	TradeID         int64
+	Price           float64
+	Quantity        float64
+	Commission      float64
+	CommissionAsset string
+}
+
+// OrderResult is the state of an order as reported by the exchange.
+type OrderResult struct {
+	Symbol           string
+	OrderID          int64
+	ClientOrderID    string
+	TransactTime     time.Time
+	Price            float64
+	OrigQuantity     float64
+	ExecutedQuantity float64
+	CumulativeQuote  float64
+	Status           string
+	TimeInForce      string
+	Type             string
+	Side             string
+	Fills            []OrderFill
+}
+
+// Account holds the balances of the account.
+type Account struct {
+	CanTrade   bool
+	UpdateTime time.Time
+	Balances   []AccountBalance
+}
+
+// =============================================================================
+
+// Client implements Exchange on top of the raw binance api of a Broker. It
+// lets the typed api run over brokers that record or replay the traffic.
+type Client struct {
+	Broker
+}
+
+// NewClient constructs a Client over the broker.
+func NewClient(brk Broker) Client {
+	return Client{Broker: brk}
+}
+
+// Klines fetches the klines of a symbol and interval, oldest first. Binance
+// includes the ongoing kline, which is the only one not Closed.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/rest-api.md#klinecandlestick-data
+func (c Client) Klines(ctx context.Context, kq KlineQuery) ([]Kline, error) {
+	kv := []string{"symbol", kq.Symbol, "interval", kq.Interval}
+	if !kq.Start.IsZero() {
+		kv = append(kv, "startTime", strconv.FormatInt(kq.Start.UnixMilli(), 10))
+	}
+	if !kq.End.IsZero() {
+		kv = append(kv, "endTime", strconv.FormatInt(kq.End.UnixMilli(), 10))
+	}
+	if kq.Limit > 0 {
+		kv = append(kv, "limit", strconv.Itoa(kq.Limit))
+	}
+
+	rd, err := c.Request(ctx, http.MethodGet, "klines", kv...)
+	if err != nil {
+		return nil, fmt.Errorf("fetching klines: %w", err)
+	}
+
+	return toKlines(rd, kq.Symbol, kq.Interval)
+}
+
+// ExchangeInfo fetches the trading rules of the symbols, or of every symbol
+// when none is provided.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/rest-api.md#exchange-information
+func (c Client) ExchangeInfo(ctx context.Context, symbols ...string) ([]SymbolInfo, error) {
+	var kv []string
+	switch len(symbols) {
+	case 0:
+	case 1:
+		kv = []string{"symbol", symbols[0]}
+	default:
+		kv = []string{"symbols", `["` + strings.Join(symbols, `","`) + `"]`}
+	}
+
+	rd, err := c.Request(ctx, http.MethodGet, "exchangeInfo", kv...)
+	if err != nil {
+		return nil, fmt.Errorf("fetching exchange info: %w", err)
+	}
+
+	var ei struct {
+		Symbols []struct {
+			Symbol                     string `json:"symbol"`
+			Status                     string `json:"status"`
+			BaseAsset                  string `json:"baseAsset"`
+			BaseAssetPrecision         int    `json:"baseAssetPrecision"`
+			QuoteAsset                 string `json:"quoteAsset"`
+			QuotePrecision             int    `json:"quotePrecision"`
+			BaseCommissionPrecision    int    `json:"baseCommissionPrecision"`
+			QuoteCommissionPrecision   int    `json:"quoteCommissionPrecision"`
+			IcebergAllowed             bool   `json:"icebergAllowed"`
+			OcoAllowed                 bool   `json:"ocoAllowed"`
+			QuoteOrderQtyMarketAllowed bool   `json:"quoteOrderQtyMarketAllowed"`
+			IsSpotTradingAllowed       bool   `json:"isSpotTradingAllowed"`
+			IsMarginTradingAllowed     bool   `json:"isMarginTradingAllowed"`
+			Filters                    []struct {
+				FilterType       string `json:"filterType"`
+				MinPrice         string `json:"minPrice"`
+				MaxPrice         string `json:"maxPrice"`
+				TickSize         string `json:"tickSize"`
+				MinQty           string `json:"minQty"`
+				MaxQty           string `json:"maxQty"`
+				StepSize         string `json:"stepSize"`
+				MinNotional      string `json:"minNotional"`
+				MaxNotional      string `json:"maxNotional"`
+				ApplyToMarket    bool   `json:"applyToMarket"`
+				ApplyMinToMarket bool   `json:"applyMinToMarket"`
+				ApplyMaxToMarket bool   `json:"applyMaxToMarket"`
+			} `json:"filters"`
+		} `json:"symbols"`
+	}
+	if err := json.NewDecoder(rd).Decode(&ei); err != nil {
+		return nil, fmt.Errorf("decoding exchange info: %w", err)
+	}
+
+	// Binance answers with an error when a symbol is unknown, but we don't
+	// want to panic if the list comes back empty.
+	if len(symbols) > 0 && len(ei.Symbols) == 0 {
+		return nil, fmt.Errorf("symbols %v: %w", symbols, ErrUnknownSymbol)
+	}
+
+	sis := make([]SymbolInfo, len(ei.Symbols))
+	for i, s := range ei.Symbols {
+		si := SymbolInfo{
+			Symbol:                     s.Symbol,
+			Status:                     s.Status,
+			BaseAsset:                  s.BaseAsset,
+			BaseAssetPrecision:         s.BaseAssetPrecision,
+			QuoteAsset:                 s.QuoteAsset,
+			QuotePrecision:             s.QuotePrecision,
+			BaseCommissionPrecision:    s.BaseCommissionPrecision,
+			QuoteCommissionPrecision:   s.QuoteCommissionPrecision,
+			IcebergAllowed:             s.IcebergAllowed,
+			OcoAllowed:                 s.OcoAllowed,
+			QuoteOrderQtyMarketAllowed: s.QuoteOrderQtyMarketAllowed,
+			IsSpotTradingAllowed:       s.IsSpotTradingAllowed,
+			IsMarginTradingAllowed:     s.IsMarginTradingAllowed,
+		}
+
+		for _, f := range s.Filters {
+			var fields map[*float64]string
+			switch f.FilterType {
+			case "PRICE_FILTER":
+				fields = map[*float64]string{&si.MinPrice: f.MinPrice, &si.MaxPrice: f.MaxPrice, &si.TickSize: f.TickSize}
+			case "LOT_SIZE":
+				fields = map[*float64]string{&si.MinQty: f.MinQty, &si.MaxQty: f.MaxQty, &si.StepSize: f.StepSize}
+			case "MIN_NOTIONAL":
+				fields = map[*float64]string{&si.MinNotional: f.MinNotional}
+				si.ApplyMinToMarket = f.ApplyToMarket
+			case "NOTIONAL":
+				fields = map[*float64]string{&si.MinNotional: f.MinNotional, &si.MaxNotional: f.MaxNotional}
+				si.ApplyMinToMarket = f.ApplyMinToMarket
+				si.ApplyMaxToMarket = f.ApplyMaxToMarket
+			case "MARKET_LOT_SIZE":
+				fields = map[*float64]string{&si.MarketMinQty: f.MinQty, &si.MarketMaxQty: f.MaxQty, &si.MarketStepSize: f.StepSize}
+			}
+			if err := parseFloats(fields); err != nil {
+				return nil, fmt.Errorf("decoding %s filter of %s: %w", f.FilterType, s.Symbol, err)
+			}
+		}
+
+		sis[i] = si
+	}
+
+	return sis, nil
+}
+
+// PlaceOrder sends a new order. The response is requested in FULL, so the
+// fills of orders executed right away are included. Orders that don't fill
+// right away are returned as NEW or PARTIALLY_FILLED.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/rest-api.md#new-order--trade
+func (c Client) PlaceOrder(ctx context.Context, or OrderRequest) (OrderResult, error) {
+	kv := []string{
+		"symbol", or.Symbol,
+		"side", or.Side,
+		"type", or.Type,
+	}
+	if or.QuoteQuantity > 0 {
+		kv = append(kv, "quoteOrderQty", strconv.FormatFloat(or.QuoteQuantity, 'f', -1, 64))
+	} else {
+		kv = append(kv, "quantity", strconv.FormatFloat(or.Quantity, 'f', -1, 64))
+	}
+	if or.Price > 0 {
+		kv = append(kv, "price", strconv.FormatFloat(or.Price, 'f', -1, 64))
+	}
+	if or.StopPrice > 0 {
+		kv = append(kv, "stopPrice", strconv.FormatFloat(or.StopPrice, 'f', -1, 64))
+	}
+	if or.TimeInForce != "" {
+		kv = append(kv, "timeInForce", or.TimeInForce)
+	}
+	if or.ClientOrderID != "" {
+		kv = append(kv, "newClientOrderId", or.ClientOrderID)
+	}
+	kv = append(kv, "newOrderRespType", "FULL")
+
+	rd, err := c.Request(ctx, http.MethodPost, "order", kv...)
+	if err != nil {
+		return OrderResult{}, fmt.Errorf("placing order: %w", err)
+	}
+
+	return toOrderResult(rd)
+}
+
+// PlaceOCO sends a new one-cancels-the-other order list.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/rest-api.md#new-oco-trade
+func (c Client) PlaceOCO(ctx context.Context, oco OCORequest) (OCOResult, error) {
+	kv := []string{
+		"symbol", oco.Symbol,
+		"side", oco.Side,
+		"quantity", strconv.FormatFloat(oco.Quantity, 'f', -1, 64),
+		"price", strconv.FormatFloat(oco.Price, 'f', -1, 64),
+		"stopPrice", strconv.FormatFloat(oco.StopPrice, 'f', -1, 64),
+		"stopLimitPrice", strconv.FormatFloat(oco.StopLimitPrice, 'f', -1, 64),
+		"stopLimitTimeInForce", oco.StopLimitTimeInForce,
+	}
+	if oco.ListClientOrderID != "" {
+		kv = append(kv, "listClientOrderId", oco.ListClientOrderID)
+	}
+	if oco.LimitClientOrderID != "" {
+		kv = append(kv, "limitClientOrderId", oco.LimitClientOrderID)
+	}
+	if oco.StopClientOrderID != "" {
+		kv = append(kv, "stopClientOrderId", oco.StopClientOrderID)
+	}
+	kv = append(kv, "newOrderRespType", "FULL")
+
+	rd, err := c.Request(ctx, http.MethodPost, "order/oco", kv...)
+	if err != nil {
+		return OCOResult{}, fmt.Errorf("placing oco: %w", err)
+	}
+
+	var m struct {
+		Symbol            string          `json:"symbol"`
+		OrderListID       int64           `json:"orderListId"`
+		ListClientOrderID string          `json:"listClientOrderId"`
+		ListOrderStatus   string          `json:"listOrderStatus"`
+		TransactionTime   int64           `json:"transactionTime"`
+		OrderReports      []orderResponse `json:"orderReports"`
+	}
+	if err := json.NewDecoder(rd).Decode(&m); err != nil {
+		return OCOResult{}, fmt.Errorf("decoding oco response: %w", err)
+	}
+
+	res := OCOResult{
+		Symbol:            m.Symbol,
+		OrderListID:       m.OrderListID,
+		ListClientOrderID: m.ListClientOrderID,
+		ListOrderStatus:   m.ListOrderStatus,
+		TransactTime:      ToTime(float64(m.TransactionTime)),
+		Orders:            make([]OrderResult, len(m.OrderReports)),
+	}
+	for i, r := range m.OrderReports {
+		or, err := r.toOrderResult()
+		if err != nil {
+			return OCOResult{}, err
+		}
+		res.Orders[i] = or
+	}
+
+	return res, nil
+}
+
+// CancelOrder cancels an active order.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/rest-api.md#cancel-order-trade
+func (c Client) CancelOrder(ctx context.Context, symbol string, orderID int64) (OrderResult, error) {
+	rd, err := c.Request(ctx, http.MethodDelete, "order",
+		"symbol", symbol,
+		"orderId", strconv.FormatInt(orderID, 10))
+	if err != nil {
+		return OrderResult{}, fmt.Errorf("canceling order %d: %w", orderID, err)
+	}
+
+	return toOrderResult(rd)
+}
+
+// CancelOpenOrders cancels every active order of a symbol. It returns the
+// canceled orders.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/rest-api.md#cancel-all-open-orders-on-a-symbol-trade
+func (c Client) CancelOpenOrders(ctx context.Context, symbol string) ([]OrderResult, error) {
+	rd, err := c.Request(ctx, http.MethodDelete, "openOrders", "symbol", symbol)
+	if err != nil {
+		return nil, fmt.Errorf("canceling open orders of %s: %w", symbol, err)
+	}
+
+	return toOrderResults(rd)
+}
+
+// QueryOrder fetches the current state of an order.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/rest-api.md#query-order-user_data
+func (c Client) QueryOrder(ctx context.Context, symbol string, orderID int64) (OrderResult, error) {
+	rd, err := c.Request(ctx, http.MethodGet, "order",
+		"symbol", symbol,
+		"orderId", strconv.FormatInt(orderID, 10))
+	if err != nil {
+		return OrderResult{}, fmt.Errorf("querying order %d: %w", orderID, err)
+	}
+
+	return toOrderResult(rd)
+}
+
+// OpenOrders fetches the active orders of a symbol.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/rest-api.md#current-open-orders-user_data
+func (c Client) OpenOrders(ctx context.Context, symbol string) ([]OrderResult, error) {
+	rd, err := c.Request(ctx, http.MethodGet, "openOrders", "symbol", symbol)
+	if err != nil {
+		return nil, fmt.Errorf("fetching open orders of %s: %w", symbol, err)
+	}
+
+	return toOrderResults(rd)
+}
+
+// AllOrders fetches the orders of a symbol created since start, whatever
+// their status. Binance returns 1000 orders at most.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/rest-api.md#all-orders-user_data
+func (c Client) AllOrders(ctx context.Context, symbol string, start time.Time) ([]OrderResult, error) {
+	rd, err := c.Request(ctx, http.MethodGet, "allOrders",
+		"symbol", symbol,
+		"startTime", strconv.FormatInt(start.UnixMilli(), 10),
+		"limit", "1000")
+	if err != nil {
+		return nil, fmt.Errorf("fetching orders of %s: %w", symbol, err)
+	}
+
+	return toOrderResults(rd)
+}
+
+// Account fetches the balances of the account.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/rest-api.md#account-information-user_data
+func (c Client) Account(ctx context.Context) (Account, error) {
+	rd, err := c.Request(ctx, http.MethodGet, "account")
+	if err != nil {
+		return Account{}, fmt.Errorf("fetching account: %w", err)
+	}
+
+	var m struct {
+		CanTrade   bool  `json:"canTrade"`
+		UpdateTime int64 `json:"updateTime"`
+		Balances   []struct {
+			Asset  string `json:"asset"`
+			Free   string `json:"free"`
+			Locked string `json:"locked"`
+		} `json:"balances"`
+	}
+	if err := json.NewDecoder(rd).Decode(&m); err != nil {
+		return Account{}, fmt.Errorf("decoding account: %w", err)
+	}
+
+	acc := Account{
+		CanTrade:   m.CanTrade,
+		UpdateTime: ToTime(float64(m.UpdateTime)),
+		Balances:   make([]AccountBalance, len(m.Balances)),
+	}
+	for i, b := range m.Balances {
+		acc.Balances[i].Asset = b.Asset
+		if err := parseFloats(map[*float64]string{
+			&acc.Balances[i].Free:   b.Free,
+			&acc.Balances[i].Locked: b.Locked,
+		}); err != nil {
+			return Account{}, fmt.Errorf("balance of %s: %w", b.Asset, err)
+		}
+	}
+
+	return acc, nil
+}
+
+// ServerTime fetches the binance server time.
+func (c Client) ServerTime(ctx context.Context) (time.Time, error) {
+	ms, err := c.Time(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// =============================================================================
+
+// Klines implements Exchange, see Client.Klines.
+func (as *Binance) Klines(ctx context.Context, kq KlineQuery) ([]Kline, error) {
+	return Client{as}.Klines(ctx, kq)
+}
+
+// ExchangeInfo implements Exchange, see Client.ExchangeInfo.
+func (as *Binance) ExchangeInfo(ctx context.Context, symbols ...string) ([]SymbolInfo, error) {
+	return Client{as}.ExchangeInfo(ctx, symbols...)
+}
+
+// PlaceOrder implements Exchange, see Client.PlaceOrder. In dry-run mode
+// binance validates the order through order/test, which answers with an
+// empty object. The order is reported NEW as binance accepted it, nothing
+// ever fills it.
+func (as *Binance) PlaceOrder(ctx context.Context, or OrderRequest) (OrderResult, error) {
+	res, err := Client{as}.PlaceOrder(ctx, or)
+	if err != nil || as.env != EnvDryRun {
+		return res, err
+	}
+
+	return OrderResult{
+		Symbol:        or.Symbol,
+		ClientOrderID: or.ClientOrderID,
+		TransactTime:  time.Now(),
+		Price:         or.Price,
+		OrigQuantity:  or.Quantity,
+		Status:        OrderStatusNew,
+		TimeInForce:   or.TimeInForce,
+		Type:          or.Type,
+		Side:          or.Side,
+	}, nil
+}
+
+// PlaceOCO implements Exchange, see Client.PlaceOCO.
+func (as *Binance) PlaceOCO(ctx context.Context, oco OCORequest) (OCOResult, error) {
+	return Client{as}.PlaceOCO(ctx, oco)
+}
+
+// CancelOrder implements Exchange, see Client.CancelOrder. In dry-run mode
+// orders never reached binance, so they are reported CANCELED without
+// sending anything.
+func (as *Binance) CancelOrder(ctx context.Context, symbol string, orderID int64) (OrderResult, error) {
+	if as.env == EnvDryRun {
+		return OrderResult{Symbol: symbol, OrderID: orderID, TransactTime: time.Now(), Status: OrderStatusCanceled}, nil
+	}
+	return Client{as}.CancelOrder(ctx, symbol, orderID)
+}
+
+// CancelOpenOrders implements Exchange, see Client.CancelOpenOrders. In
+// dry-run mode it cancels nothing, none of the orders reached binance.
+func (as *Binance) CancelOpenOrders(ctx context.Context, symbol string) ([]OrderResult, error) {
+	if as.env == EnvDryRun {
+		return nil, nil
+	}
+	return Client{as}.CancelOpenOrders(ctx, symbol)
+}
+
+// QueryOrder implements Exchange, see Client.QueryOrder.
+func (as *Binance) QueryOrder(ctx context.Context, symbol string, orderID int64) (OrderResult, error) {
+	return Client{as}.QueryOrder(ctx, symbol, orderID)
+}
+
+// OpenOrders implements Exchange, see Client.OpenOrders.
+func (as *Binance) OpenOrders(ctx context.Context, symbol string) ([]OrderResult, error) {
+	return Client{as}.OpenOrders(ctx, symbol)
+}
+
+// AllOrders implements Exchange, see Client.AllOrders.
+func (as *Binance) AllOrders(ctx context.Context, symbol string, start time.Time) ([]OrderResult, error) {
+	return Client{as}.AllOrders(ctx, symbol, start)
+}
+
+// Account implements Exchange, see Client.Account.
+func (as *Binance) Account(ctx context.Context) (Account, error) {
+	return Client{as}.Account(ctx)
+}
+
+// ServerTime implements Exchange, see Client.ServerTime.
+func (as *Binance) ServerTime(ctx context.Context) (time.Time, error) {
+	return Client{as}.ServerTime(ctx)
+}
+
+// =============================================================================
+
+// toKlines decodes the body of a klines response.
+func toKlines(rd io.Reader, symbol, interval string) ([]Kline, error) {
+	/*
+		We expect a response like:
+		[
+		  [
+			1499040000000,      // open time
+			"0.01634790",       // open
+			"0.80000000",       // High
+			"0.01575800",       // Low
+			"0.01577100",       // close
+			"148976.11427815",  // Volume
+			1499644799999,      // close time
+			"2434.19055334",    // Quote asset volume
+			308,                // Number of trades
+			"1756.87402397",    // Taker buy base asset volume
+			"28.46694368",      // Taker buy quote asset volume
+			"17928899.62484339" // Ignore.
+		  ]
+		]
+	*/
+	var bks [][]interface{}
+	if err := json.NewDecoder(rd).Decode(&bks); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal binance response, err %w", err)
+	}
+
+	now := time.Now()
+	ks := make([]Kline, 0, len(bks))
+	for _, bk := range bks {
+		// The response from binance should have exactly 12 fields, having anything different than 12
+		// is an indication that api might have changed
+		if len(bk) != 12 {
+			return nil, fmt.Errorf("binance response wrong formated")
+		}
+
+		openTime, ok1 := bk[0].(float64)
+		closeTime, ok2 := bk[6].(float64)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("unable to parse kline times out of binance response")
+		}
+
+		k := Kline{
+			Symbol:    symbol,
+			Interval:  interval,
+			OpenTime:  ToTime(openTime),
+			CloseTime: ToTime(closeTime),
+		}
+		k.Closed = k.CloseTime.Before(now)
+
+		fields := make(map[*float64]string, 5)
+		for dst, i := range map[*float64]int{&k.OpenPrice: 1, &k.High: 2, &k.Low: 3, &k.ClosePrice: 4, &k.Volume: 5} {
+			s, ok := bk[i].(string)
+			if !ok {
+				return nil, fmt.Errorf("unable to parse kline field %d out of binance response", i)
+			}
+			fields[dst] = s
+		}
+		if err := parseFloats(fields); err != nil {
+			return nil, fmt.Errorf("unable to parse kline out of binance response: %w", err)
+		}
+
+		ks = append(ks, k)
+	}
+
+	return ks, nil
+}
+
+// orderResponse is an order as binance encodes it.
+type orderResponse struct {
+	Symbol              string `json:"symbol"`
+	OrderID             int64  `json:"orderId"`
+	ClientOrderID       string `json:"clientOrderId"`
+	TransactTime        int64  `json:"transactTime"`
+	Time                int64  `json:"time"`
+	Price               string `json:"price"`
+	OrigQty             string `json:"origQty"`
+	ExecutedQty         string `json:"executedQty"`
+	CummulativeQuoteQty string `json:"cummulativeQuoteQty"`
+	Status              string `json:"status"`
+	TimeInForce         string `json:"timeInForce"`
+	Type                string `json:"type"`
+	Side                string `json:"side"`
+	Fills               []struct {
+		Price           string `json:"price"`
+		Qty             string `json:"qty"`
+		Commission      string `json:"commission"`
+		CommissionAsset string `json:"commissionAsset"`
+		TradeID         int64  `json:"tradeId"`
+	} `json:"fills"`
+}
+
+// toOrderResult decodes the body of an order response.
+func toOrderResult(rd io.Reader) (OrderResult, error) {
+	var m orderResponse
+	if err := json.NewDecoder(rd).Decode(&m); err != nil {
+		return OrderResult{}, fmt.Errorf("decoding order response: %w", err)
+	}
+
+	return m.toOrderResult()
+}
+
+// toOrderResults decodes the body of a response listing orders. Order lists,
+// which binance reports without an order id, are left out.
+func toOrderResults(rd io.Reader) ([]OrderResult, error) {
+	var ms []orderResponse
+	if err := json.NewDecoder(rd).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("decoding orders response: %w", err)
+	}
+
+	ors := make([]OrderResult, 0, len(ms))
+	for _, m := range ms {
+		if m.OrderID == 0 {
+			continue
+		}
+
+		or, err := m.toOrderResult()
+		if err != nil {
+			return nil, err
+		}
+		ors = append(ors, or)
+	}
+
+	return ors, nil
+}
+
+// toOrderResult converts the order binance reported.
+func (m orderResponse) toOrderResult() (OrderResult, error) {
+	// Query order responses report the creation time instead.
+	transactTime := m.TransactTime
+	if transactTime == 0 {
+		transactTime = m.Time
+	}
+
+	or := OrderResult{
+		Symbol:        m.Symbol,
+		OrderID:       m.OrderID,
+		ClientOrderID: m.ClientOrderID,
+		TransactTime:  ToTime(float64(transactTime)),
+		Status:        m.Status,
+		TimeInForce:   m.TimeInForce,
+		Type:          m.Type,
+		Side:          m.Side,
+		Fills:         make([]OrderFill, len(m.Fills)),
+	}
+	if err := parseFloats(map[*float64]string{
+		&or.Price:            m.Price,
+		&or.OrigQuantity:     m.OrigQty,
+		&or.ExecutedQuantity: m.ExecutedQty,
+		&or.CumulativeQuote:  m.CummulativeQuoteQty,
+	}); err != nil {
+		return OrderResult{}, fmt.Errorf("order %d: %w", m.OrderID, err)
+	}
+
+	for i, f := range m.Fills {
+		or.Fills[i].TradeID = f.TradeID
+		or.Fills[i].CommissionAsset = f.CommissionAsset
+		if err := parseFloats(map[*float64]string{
+			&or.Fills[i].Price:      f.Price,
+			&or.Fills[i].Quantity:   f.Qty,
+			&or.Fills[i].Commission: f.Commission,
+		}); err != nil {
+			return OrderResult{}, fmt.Errorf("fill of order %d: %w", m.OrderID, err)
+		}
+	}
+
+	return or, nil
+}
@@ -0,0 +1,612 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lgarciaaco/machina-api/business/sys/database"
+	"go.uber.org/zap"
+)
+
+// ErrUnsupportedOrderType is returned by the paper broker for orders it
+// can't simulate.
+var ErrUnsupportedOrderType = errors.New("unsupported order type")
+
+// PaperConfig holds the settings required to construct a Paper broker.
+type PaperConfig struct {
+	Log      *zap.SugaredLogger
+	DB       *sqlx.DB
+	Market   Exchange           // Market serves klines and exchange info, the stored ones are used when nil
+	Fee      float64            // Fee is the fraction of the quote amount charged per fill, 0.001 is 0.1%
+	Slippage float64            // Slippage is the fraction the fill price moves against the order
+	Balances map[string]float64 // Balances funds the assets that have no simulated balance yet
+}
+
+// Paper is an Exchange that never sends orders to binance. MARKET orders are
+// filled at the close of the latest synced candle of the symbol, and the
+// balances they move are simulated in the database.
+type Paper struct {
+	log      *zap.SugaredLogger
+	db       *sqlx.DB
+	market   Exchange
+	fee      float64
+	slippage float64
+	balances map[string]float64
+}
+
+// NewPaper constructs a Paper broker for the given configuration.
+func NewPaper(cfg PaperConfig) *Paper {
+	return &Paper{
+		log:      cfg.Log,
+		db:       cfg.DB,
+		market:   cfg.Market,
+		fee:      cfg.Fee,
+		slippage: cfg.Slippage,
+		balances: cfg.Balances,
+	}
+}
+
+// =============================================================================
+
+// paperSymbol is a symbol as stored in the symbols table.
+type paperSymbol struct {
+	Symbol                     string  `db:"symbol"`
+	Status                     string  `db:"status"`
+	BaseAsset                  string  `db:"base_asset"`
+	BaseAssetPrecision         int     `db:"base_asset_precision"`
+	QuoteAsset                 string  `db:"quote_asset"`
+	QuotePrecision             int     `db:"quote_precision"`
+	BaseCommissionPrecision    int     `db:"base_commission_precision"`
+	QuoteCommissionPrecision   int     `db:"quote_commission_precision"`
+	IcebergAllowed             bool    `db:"iceberg_allowed"`
+	OcoAllowed                 bool    `db:"oco_allowed"`
+	QuoteOrderQtyMarketAllowed bool    `db:"quote_order_qty_market_allowed"`
+	IsSpotTradingAllowed       bool    `db:"is_spot_trading_allowed"`
+	IsMarginTradingAllowed     bool    `db:"is_margin_trading_allowed"`
+	MinPrice                   float64 `db:"min_price"`
+	MaxPrice                   float64 `db:"max_price"`
+	TickSize                   float64 `db:"tick_size"`
+	MinQty                     float64 `db:"min_qty"`
+	MaxQty                     float64 `db:"max_qty"`
+	StepSize                   float64 `db:"step_size"`
+	MinNotional                float64 `db:"min_notional"`
+	MaxNotional                float64 `db:"max_notional"`
+	ApplyMinToMarket           bool    `db:"apply_min_to_market"`
+	ApplyMaxToMarket           bool    `db:"apply_max_to_market"`
+	MarketMinQty               float64 `db:"market_min_qty"`
+	MarketMaxQty               float64 `db:"market_max_qty"`
+	MarketStepSize             float64 `db:"market_step_size"`
+}
+
+// paperCandle is a candle as stored in the candles table.
+type paperCandle struct {
+	OpenTime   time.Time `db:"open_time"`
+	OpenPrice  float64   `db:"open_price"`
+	CloseTime  time.Time `db:"close_time"`
+	ClosePrice float64   `db:"close_price"`
+	High       float64   `db:"high"`
+	Low        float64   `db:"low"`
+	Volume     float64   `db:"volume"`
+}
+
+// paperOrder is a simulated order as stored in the paper_orders table.
+type paperOrder struct {
+	OrderID          int64     `db:"order_id"`
+	Symbol           string    `db:"symbol"`
+	Side             string    `db:"side"`
+	Type             string    `db:"type"`
+	Quantity         float64   `db:"quantity"`
+	Price            float64   `db:"price"`
+	ExecutedQuantity float64   `db:"executed_quantity"`
+	CumulativeQuote  float64   `db:"cumulative_quote"`
+	Commission       float64   `db:"commission"`
+	CommissionAsset  string    `db:"commission_asset"`
+	Status           string    `db:"status"`
+	TransactTime     time.Time `db:"transact_time"`
+	ClientOrderID    string    `db:"client_order_id"`
+}
+
+// paperBalance is a simulated balance as stored in the paper_balances table.
+type paperBalance struct {
+	Asset      string    `db:"asset"`
+	Free       float64   `db:"free"`
+	UpdateTime time.Time `db:"update_time"`
+}
+
+// toOrderResult converts a stored paper order. A filled order has a single
+// fill at the order price, identified by the order id.
+func (po paperOrder) toOrderResult() OrderResult {
+	or := OrderResult{
+		Symbol:           po.Symbol,
+		OrderID:          po.OrderID,
+		ClientOrderID:    po.ClientOrderID,
+		TransactTime:     po.TransactTime,
+		Price:            po.Price,
+		OrigQuantity:     po.Quantity,
+		ExecutedQuantity: po.ExecutedQuantity,
+		CumulativeQuote:  po.CumulativeQuote,
+		Status:           po.Status,
+		TimeInForce:      "GTC",
+		Type:             po.Type,
+		Side:             po.Side,
+	}
+	if po.ExecutedQuantity > 0 {
+		or.Fills = []OrderFill{{
+			TradeID:         po.OrderID,
+			Price:           po.Price,
+			Quantity:        po.ExecutedQuantity,
+			Commission:      po.Commission,
+			CommissionAsset: po.CommissionAsset,
+		}}
+	}
+	return or
+}
+
+// =============================================================================
+
+// Klines returns the klines of the market, or the stored candles of the
+// symbol and interval when the broker has no market.
+func (p *Paper) Klines(ctx context.Context, kq KlineQuery) ([]Kline, error) {
+	if p.market != nil {
+		return p.market.Klines(ctx, kq)
+	}
+
+	data := struct {
+		Symbol   string    `db:"symbol"`
+		Interval string    `db:"interval"`
+		Start    time.Time `db:"start"`
+		End      time.Time `db:"end"`
+		Limit    int       `db:"limit"`
+	}{
+		Symbol:   kq.Symbol,
+		Interval: kq.Interval,
+		Start:    kq.Start,
+		End:      kq.End,
+		Limit:    kq.Limit,
+	}
+	if data.End.IsZero() {
+		data.End = time.Now()
+	}
+	if data.Limit <= 0 {
+		data.Limit = 500
+	}
+
+	// Without a start the most recent candles are wanted, they are fetched
+	// newest first and reversed below.
+	order := "ASC"
+	if data.Start.IsZero() {
+		order = "DESC"
+	}
+
+	q := `
+	SELECT
+		c.open_time, c.open_price, c.close_time, c.close_price, c.high, c.low, c.volume
+	FROM
+		candles AS c
+	JOIN
+		symbols AS s ON s.symbol_id = c.symbol_id
+	WHERE
+		s.symbol = :symbol AND c.interval = :interval AND c.open_time >= :start AND c.open_time <= :end
+	ORDER BY
+		c.open_time ` + order + `
+	LIMIT :limit`
+
+	var cdls []paperCandle
+	if err := database.NamedQuerySlice(ctx, p.log, p.db, q, data, &cdls); err != nil {
+		return nil, fmt.Errorf("selecting candles: %w", err)
+	}
+
+	now := time.Now()
+	ks := make([]Kline, len(cdls))
+	for i, c := range cdls {
+		j := i
+		if order == "DESC" {
+			j = len(cdls) - 1 - i
+		}
+		ks[j] = Kline{
+			Symbol:     kq.Symbol,
+			Interval:   kq.Interval,
+			OpenTime:   c.OpenTime,
+			CloseTime:  c.CloseTime,
+			OpenPrice:  c.OpenPrice,
+			ClosePrice: c.ClosePrice,
+			Low:        c.Low,
+			High:       c.High,
+			Volume:     c.Volume,
+			Closed:     c.CloseTime.Before(now),
+		}
+	}
+
+	return ks, nil
+}
+
+// ExchangeInfo returns the symbols of the market, or the stored symbols
+// when the broker has no market.
+func (p *Paper) ExchangeInfo(ctx context.Context, symbols ...string) ([]SymbolInfo, error) {
+	if p.market != nil {
+		return p.market.ExchangeInfo(ctx, symbols...)
+	}
+
+	const q = `
+	SELECT
+		symbol, status, base_asset, base_asset_precision, quote_asset, quote_precision,
+		base_commission_precision, quote_commission_precision, iceberg_allowed, oco_allowed,
+		quote_order_qty_market_allowed, is_spot_trading_allowed, is_margin_trading_allowed,
+		min_price, max_price, tick_size, min_qty, max_qty, step_size, min_notional,
+		max_notional, apply_min_to_market, apply_max_to_market, market_min_qty, market_max_qty, market_step_size
+	FROM
+		symbols
+	ORDER BY
+		symbol`
+
+	var sbls []paperSymbol
+	if err := database.NamedQuerySlice(ctx, p.log, p.db, q, struct{}{}, &sbls); err != nil {
+		return nil, fmt.Errorf("selecting symbols: %w", err)
+	}
+
+	want := make(map[string]bool, len(symbols))
+	for _, s := range symbols {
+		want[s] = true
+	}
+
+	var sis []SymbolInfo
+	for _, s := range sbls {
+		if len(want) == 0 || want[s.Symbol] {
+			sis = append(sis, SymbolInfo(s))
+		}
+	}
+	if len(symbols) > 0 && len(sis) != len(want) {
+		return nil, fmt.Errorf("symbols %v: %w", symbols, ErrUnknownSymbol)
+	}
+
+	return sis, nil
+}
+
+// PlaceOrder fills a MARKET order at the close of the latest candle of the
+// symbol, moved against the order by the slippage. The fee is charged in the
+// quote asset. Orders with a quote quantity fill the base quantity it is
+// worth at that price. The order fails with ErrInsufficientBalance when the
+// balance it spends can't cover it.
+func (p *Paper) PlaceOrder(ctx context.Context, or OrderRequest) (OrderResult, error) {
+	if or.Type != OrderTypeMarket {
+		return OrderResult{}, fmt.Errorf("paper order type %s: %w", or.Type, ErrUnsupportedOrderType)
+	}
+	if or.Side != OrderSideBuy && or.Side != OrderSideSell {
+		return OrderResult{}, fmt.Errorf("paper order side %q is not valid", or.Side)
+	}
+	if or.Quantity <= 0 && or.QuoteQuantity <= 0 {
+		return OrderResult{}, fmt.Errorf("paper order quantity %v is not valid", or.Quantity)
+	}
+
+	var po paperOrder
+	err := database.WithinTran(ctx, p.log, p.db, func(tx sqlx.ExtContext) error {
+		sbl, err := p.querySymbol(ctx, tx, or.Symbol)
+		if err != nil {
+			return err
+		}
+
+		price, err := p.lastPrice(ctx, tx, or.Symbol)
+		if err != nil {
+			return err
+		}
+
+		if err := p.fund(ctx, tx); err != nil {
+			return err
+		}
+
+		// The order pays the slippage, buys get a higher price and sells a
+		// lower one.
+		if or.Side == OrderSideBuy {
+			price *= 1 + p.slippage
+		} else {
+			price *= 1 - p.slippage
+		}
+		qty, quote := or.Quantity, price*or.Quantity
+		if or.QuoteQuantity > 0 {
+			qty, quote = or.QuoteQuantity/price, or.QuoteQuantity
+		}
+		fee := quote * p.fee
+
+		// A buy spends quote asset to get base asset, a sell the opposite.
+		spend, spent, get, got := sbl.QuoteAsset, quote+fee, sbl.BaseAsset, qty
+		if or.Side == OrderSideSell {
+			spend, spent, get, got = sbl.BaseAsset, qty, sbl.QuoteAsset, quote-fee
+		}
+
+		now := time.Now().UTC()
+		if err := p.move(ctx, tx, spend, -spent, now); err != nil {
+			return err
+		}
+		if err := p.move(ctx, tx, get, got, now); err != nil {
+			return err
+		}
+
+		po = paperOrder{
+			Symbol:           or.Symbol,
+			Side:             or.Side,
+			Type:             or.Type,
+			Quantity:         qty,
+			Price:            price,
+			ExecutedQuantity: qty,
+			CumulativeQuote:  quote,
+			Commission:       fee,
+			CommissionAsset:  sbl.QuoteAsset,
+			Status:           OrderStatusFilled,
+			TransactTime:     now,
+			ClientOrderID:    or.ClientOrderID,
+		}
+
+		const q = `
+		INSERT INTO paper_orders
+			(symbol, side, type, quantity, price, executed_quantity, cumulative_quote, commission, commission_asset, status, transact_time, client_order_id)
+		VALUES
+			(:symbol, :side, :type, :quantity, :price, :executed_quantity, :cumulative_quote, :commission, :commission_asset, :status, :transact_time, :client_order_id)
+		RETURNING
+			order_id`
+
+		var id struct {
+			OrderID int64 `db:"order_id"`
+		}
+		if err := database.NamedQueryStruct(ctx, p.log, tx, q, po, &id); err != nil {
+			return fmt.Errorf("inserting paper order: %w", err)
+		}
+		po.OrderID = id.OrderID
+
+		return nil
+	})
+	if err != nil {
+		return OrderResult{}, fmt.Errorf("placing paper order: %w", err)
+	}
+
+	return po.toOrderResult(), nil
+}
+
+// PlaceOCO fails for every order list, paper orders can't wait for a price.
+func (p *Paper) PlaceOCO(ctx context.Context, oco OCORequest) (OCOResult, error) {
+	return OCOResult{}, fmt.Errorf("paper order list: %w", ErrUnsupportedOrderType)
+}
+
+// CancelOrder fails for every order. Paper orders are filled when placed,
+// so there is never an active order to cancel.
+func (p *Paper) CancelOrder(ctx context.Context, symbol string, orderID int64) (OrderResult, error) {
+	if _, err := p.QueryOrder(ctx, symbol, orderID); err != nil {
+		return OrderResult{}, err
+	}
+	return OrderResult{}, fmt.Errorf("canceling paper order %d: %w", orderID, ErrUnknownOrder)
+}
+
+// CancelOpenOrders cancels nothing, paper orders are never left active.
+func (p *Paper) CancelOpenOrders(ctx context.Context, symbol string) ([]OrderResult, error) {
+	return nil, nil
+}
+
+// QueryOrder fetches a paper order.
+func (p *Paper) QueryOrder(ctx context.Context, symbol string, orderID int64) (OrderResult, error) {
+	data := struct {
+		Symbol  string `db:"symbol"`
+		OrderID int64  `db:"order_id"`
+	}{
+		Symbol:  symbol,
+		OrderID: orderID,
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		paper_orders
+	WHERE
+		order_id = :order_id AND symbol = :symbol`
+
+	var po paperOrder
+	if err := database.NamedQueryStruct(ctx, p.log, p.db, q, data, &po); err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return OrderResult{}, fmt.Errorf("querying paper order %d: %w", orderID, ErrUnknownOrder)
+		}
+		return OrderResult{}, fmt.Errorf("querying paper order %d: %w", orderID, err)
+	}
+
+	return po.toOrderResult(), nil
+}
+
+// OpenOrders returns no order, paper orders are never left active.
+func (p *Paper) OpenOrders(ctx context.Context, symbol string) ([]OrderResult, error) {
+	return nil, nil
+}
+
+// AllOrders fetches the paper orders of a symbol placed since start.
+func (p *Paper) AllOrders(ctx context.Context, symbol string, start time.Time) ([]OrderResult, error) {
+	data := struct {
+		Symbol string    `db:"symbol"`
+		Start  time.Time `db:"start"`
+	}{
+		Symbol: symbol,
+		Start:  start.UTC(),
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		paper_orders
+	WHERE
+		symbol = :symbol AND transact_time >= :start
+	ORDER BY
+		order_id`
+
+	var pos []paperOrder
+	if err := database.NamedQuerySlice(ctx, p.log, p.db, q, data, &pos); err != nil {
+		return nil, fmt.Errorf("selecting paper orders of %s: %w", symbol, err)
+	}
+
+	ors := make([]OrderResult, len(pos))
+	for i, po := range pos {
+		ors[i] = po.toOrderResult()
+	}
+
+	return ors, nil
+}
+
+// Account returns the simulated balances.
+func (p *Paper) Account(ctx context.Context) (Account, error) {
+	var bls []paperBalance
+	err := database.WithinTran(ctx, p.log, p.db, func(tx sqlx.ExtContext) error {
+		if err := p.fund(ctx, tx); err != nil {
+			return err
+		}
+
+		const q = `
+		SELECT
+			*
+		FROM
+			paper_balances
+		ORDER BY
+			asset`
+
+		if err := database.NamedQuerySlice(ctx, p.log, tx, q, struct{}{}, &bls); err != nil {
+			return fmt.Errorf("selecting paper balances: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return Account{}, fmt.Errorf("fetching paper account: %w", err)
+	}
+
+	acc := Account{
+		CanTrade: true,
+		Balances: make([]AccountBalance, len(bls)),
+	}
+	for i, b := range bls {
+		acc.Balances[i] = AccountBalance{Asset: b.Asset, Free: b.Free}
+		if b.UpdateTime.After(acc.UpdateTime) {
+			acc.UpdateTime = b.UpdateTime
+		}
+	}
+
+	return acc, nil
+}
+
+// ServerTime returns the local time, there is no server to ask.
+func (p *Paper) ServerTime(ctx context.Context) (time.Time, error) {
+	return time.Now(), nil
+}
+
+// =============================================================================
+
+// querySymbol fetches the assets of a stored symbol.
+func (p *Paper) querySymbol(ctx context.Context, tx sqlx.ExtContext, symbol string) (paperSymbol, error) {
+	data := struct {
+		Symbol string `db:"symbol"`
+	}{
+		Symbol: symbol,
+	}
+
+	const q = `
+	SELECT
+		symbol, status, base_asset, base_asset_precision, quote_asset, quote_precision,
+		base_commission_precision, quote_commission_precision, iceberg_allowed, oco_allowed,
+		quote_order_qty_market_allowed, is_spot_trading_allowed, is_margin_trading_allowed
+	FROM
+		symbols
+	WHERE
+		symbol = :symbol`
+
+	var sbl paperSymbol
+	if err := database.NamedQueryStruct(ctx, p.log, tx, q, data, &sbl); err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return paperSymbol{}, fmt.Errorf("symbol %s: %w", symbol, ErrUnknownSymbol)
+		}
+		return paperSymbol{}, fmt.Errorf("selecting symbol %s: %w", symbol, err)
+	}
+
+	return sbl, nil
+}
+
+// lastPrice returns the close price of the latest synced candle of the
+// symbol, of any interval.
+func (p *Paper) lastPrice(ctx context.Context, tx sqlx.ExtContext, symbol string) (float64, error) {
+	data := struct {
+		Symbol string `db:"symbol"`
+	}{
+		Symbol: symbol,
+	}
+
+	const q = `
+	SELECT
+		c.open_time, c.open_price, c.close_time, c.close_price, c.high, c.low, c.volume
+	FROM
+		candles AS c
+	JOIN
+		symbols AS s ON s.symbol_id = c.symbol_id
+	WHERE
+		s.symbol = :symbol
+	ORDER BY
+		c.close_time DESC
+	LIMIT 1`
+
+	var cdl paperCandle
+	if err := database.NamedQueryStruct(ctx, p.log, tx, q, data, &cdl); err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return 0, fmt.Errorf("no candles synced for symbol %s", symbol)
+		}
+		return 0, fmt.Errorf("selecting last candle of %s: %w", symbol, err)
+	}
+
+	return cdl.ClosePrice, nil
+}
+
+// fund creates the configured balances of the assets that don't have a
+// simulated balance yet.
+func (p *Paper) fund(ctx context.Context, tx sqlx.ExtContext) error {
+	const q = `
+	INSERT INTO paper_balances
+		(asset, free, update_time)
+	VALUES
+		(:asset, :free, :update_time)
+	ON CONFLICT (asset) DO NOTHING`
+
+	now := time.Now().UTC()
+	for asset, free := range p.balances {
+		if err := database.NamedExecContext(ctx, p.log, tx, q, paperBalance{Asset: asset, Free: free, UpdateTime: now}); err != nil {
+			return fmt.Errorf("funding paper balance of %s: %w", asset, err)
+		}
+	}
+
+	return nil
+}
+
+// move adds the amount to the simulated balance of the asset. It fails with
+// ErrInsufficientBalance when the balance would become negative.
+func (p *Paper) move(ctx context.Context, tx sqlx.ExtContext, asset string, amount float64, now time.Time) error {
+	data := paperBalance{
+		Asset:      asset,
+		Free:       amount,
+		UpdateTime: now,
+	}
+
+	// The row is locked by the update, concurrent orders on the same asset
+	// wait for this transaction to finish.
+	const q = `
+	INSERT INTO paper_balances
+		(asset, free, update_time)
+	VALUES
+		(:asset, :free, :update_time)
+	ON CONFLICT (asset) DO UPDATE SET
+		free = paper_balances.free + EXCLUDED.free,
+		update_time = EXCLUDED.update_time
+	RETURNING
+		*`
+
+	var bl paperBalance
+	if err := database.NamedQueryStruct(ctx, p.log, tx, q, data, &bl); err != nil {
+		return fmt.Errorf("updating paper balance of %s: %w", asset, err)
+	}
+	if bl.Free < 0 {
+		return fmt.Errorf("paper balance of %s is %v, needs %v more: %w", asset, bl.Free-amount, -bl.Free, ErrInsufficientBalance)
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Set of errors returned when binance limits are reached.
+var (
+	ErrRateLimited = errors.New("request rate limit exceeded")
+	ErrIPBanned    = errors.New("ip banned for exceeding rate limits")
+)
+
+// Default limits applied by binance to the spot api.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/rest-api.md#limits
+const (
+	DefaultWeightLimit = 1200
+	DefaultOrderLimit  = 50
+
+	weightWindow = time.Minute
+	orderWindow  = 10 * time.Second
+)
+
+// DefaultWeights maps each api v3 endpoint to the request weight binance
+// charges for it. Endpoints that are not listed weight 1.
+var DefaultWeights = map[string]int{
+	"exchangeInfo":     10,
+	"depth":            5,
+	"historicalTrades": 5,
+	"ticker/24hr":      40,
+	"ticker/price":     2,
+	"openOrders":       40,
+	"allOrders":        10,
+	"allOrderList":     10,
+	"openOrderList":    3,
+	"account":          10,
+	"myTrades":         10,
+}
+
+// usage publishes the current broker usage through expvar. The expvar package
+// registers values as singletons, so the map is shared by every broker in the
+// process.
+var usage = expvar.NewMap("broker")
+
+// limiter keeps track of the request weight and order count consumed in the
+// current binance windows. Binance reports the authoritative values in the
+// response headers, which are used to correct the local accounting.
+type limiter struct {
+	mu          sync.Mutex
+	weightLimit int
+	orderLimit  int
+	weights     map[string]int
+
+	weightStart  time.Time // start of the current 1m weight window
+	weightUsed   int
+	orderStart   time.Time // start of the current 10s order window
+	orderCount   int
+	orderCount1D int
+	retryAt      time.Time // no request is sent before this time
+}
+
+// newLimiter constructs a limiter, zero limits fallback to binance defaults.
+func newLimiter(weightLimit, orderLimit int, weights map[string]int) *limiter {
+	if weightLimit <= 0 {
+		weightLimit = DefaultWeightLimit
+	}
+	if orderLimit <= 0 {
+		orderLimit = DefaultOrderLimit
+	}
+	if weights == nil {
+		weights = DefaultWeights
+	}
+
+	usage.Set("weight_limit_1m", intVar(weightLimit))
+	usage.Set("order_limit_10s", intVar(orderLimit))
+
+	return &limiter{
+		weightLimit: weightLimit,
+		orderLimit:  orderLimit,
+		weights:     weights,
+	}
+}
+
+// wait blocks until the endpoint can be called without exceeding any limit.
+// If the required delay goes past the context deadline it fails immediately
+// instead of sleeping.
+func (l *limiter) wait(ctx context.Context, endpoint string, isOrder bool) error {
+	for {
+		d, err := l.reserve(endpoint, isOrder)
+		if err != nil {
+			return err
+		}
+		if d == 0 {
+			return nil
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(d).After(deadline) {
+			return fmt.Errorf("endpoint %s needs to wait %s: %w", endpoint, d, ErrRateLimited)
+		}
+
+		usage.Add("throttled", 1)
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// reserve accounts the endpoint weight in the current window. It returns how
+// long to wait when the request can't be sent yet.
+func (l *limiter) reserve(endpoint string, isOrder bool) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.retryAt) {
+		return l.retryAt.Sub(now), nil
+	}
+	l.roll(now)
+
+	weight := l.weight(endpoint)
+	if l.weightUsed > 0 && l.weightUsed+weight > l.weightLimit {
+		return l.weightStart.Add(weightWindow).Sub(now), nil
+	}
+	if weight > l.weightLimit {
+		return 0, fmt.Errorf("endpoint %s weight %d is above the limit %d: %w", endpoint, weight, l.weightLimit, ErrRateLimited)
+	}
+	if isOrder && l.orderCount+1 > l.orderLimit {
+		return l.orderStart.Add(orderWindow).Sub(now), nil
+	}
+
+	l.weightUsed += weight
+	if isOrder {
+		l.orderCount++
+	}
+	l.publish()
+
+	return 0, nil
+}
+
+// update corrects the local accounting using the usage binance reports in
+// the response headers, and honors Retry-After when a limit was hit.
+func (l *limiter) update(resp *http.Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.roll(now)
+
+	if v, err := strconv.Atoi(resp.Header.Get("X-MBX-USED-WEIGHT-1M")); err == nil {
+		l.weightUsed = v
+	}
+	if v, err := strconv.Atoi(resp.Header.Get("X-MBX-ORDER-COUNT-10S")); err == nil {
+		l.orderCount = v
+	}
+	if v, err := strconv.Atoi(resp.Header.Get("X-MBX-ORDER-COUNT-1D")); err == nil {
+		l.orderCount1D = v
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusTeapot {
+		retryAt := l.weightStart.Add(weightWindow)
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAt = now.Add(time.Duration(secs) * time.Second)
+		}
+		if retryAt.After(l.retryAt) {
+			l.retryAt = retryAt
+		}
+	}
+
+	l.publish()
+}
+
+// weight returns the weight of an endpoint.
+func (l *limiter) weight(endpoint string) int {
+	if w, ok := l.weights[endpoint]; ok {
+		return w
+	}
+	return 1
+}
+
+// roll starts new windows once the current ones expired. Binance windows are
+// aligned to the clock, a 1m window starts at second 0.
+func (l *limiter) roll(now time.Time) {
+	if ws := now.Truncate(weightWindow); ws.After(l.weightStart) {
+		l.weightStart = ws
+		l.weightUsed = 0
+	}
+	if ows := now.Truncate(orderWindow); ows.After(l.orderStart) {
+		l.orderStart = ows
+		l.orderCount = 0
+	}
+}
+
+// publish exposes the current usage through expvar.
+func (l *limiter) publish() {
+	usage.Set("weight_used_1m", intVar(l.weightUsed))
+	usage.Set("order_count_10s", intVar(l.orderCount))
+	usage.Set("order_count_1d", intVar(l.orderCount1D))
+
+	var retryAfter int
+	if !l.retryAt.IsZero() {
+		retryAfter = int(l.retryAt.Unix())
+	}
+	usage.Set("retry_after", intVar(retryAfter))
+}
+
+// intVar wraps an int into an expvar value.
+func intVar(v int) *expvar.Int {
+	i := new(expvar.Int)
+	i.Set(int64(v))
+	return i
+}
@@ -0,0 +1,277 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Set of binance websocket market stream endpoints.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/web-socket-streams.md
+const (
+	StreamNet     = "wss://stream.binance.com:9443"
+	StreamTestNet = "wss://testnet.binance.vision"
+
+	// DefaultStreamLifetime is how long a connection is kept before
+	// reconnecting. Binance drops every connection after 24h.
+	DefaultStreamLifetime = 23 * time.Hour
+
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = time.Minute
+
+	// streamReadTimeout bounds the time without any frame from the server.
+	// Binance pings every 3 minutes, so a silent connection is dead.
+	streamReadTimeout = 10 * time.Minute
+)
+
+// StreamConfig holds the settings required to construct a Stream.
+type StreamConfig struct {
+	Environment  Environment     // Environment selects the live or testnet streams
+	BaseURL      string          // BaseURL overrides the url derived from Environment
+	MinBackoff   time.Duration   // MinBackoff is the first delay before reconnecting
+	MaxBackoff   time.Duration   // MaxBackoff caps the delay between reconnections
+	Lifetime     time.Duration   // Lifetime is how long a connection is kept before reconnecting
+	ErrorHandler func(err error) // ErrorHandler is called with errors that don't stop the stream
+}
+
+// Stream consumes binance websocket streams. Connections are reestablished
+// with an exponential backoff when they fail.
+type Stream struct {
+	baseURL    string
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	lifetime   time.Duration
+	onError    func(err error)
+}
+
+// NewStream constructs a Stream for the given configuration.
+func NewStream(cfg StreamConfig) *Stream {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = cfg.Environment.streamURL()
+	}
+
+	minBackoff := cfg.MinBackoff
+	if minBackoff <= 0 {
+		minBackoff = DefaultMinBackoff
+	}
+
+	maxBackoff := cfg.MaxBackoff
+	if maxBackoff < minBackoff {
+		maxBackoff = DefaultMaxBackoff
+	}
+
+	lifetime := cfg.Lifetime
+	if lifetime <= 0 {
+		lifetime = DefaultStreamLifetime
+	}
+
+	onError := cfg.ErrorHandler
+	if onError == nil {
+		onError = func(error) {}
+	}
+
+	return &Stream{
+		baseURL:    baseURL,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		lifetime:   lifetime,
+		onError:    onError,
+	}
+}
+
+// KlineSubscription identifies the kline stream of a symbol and interval.
+type KlineSubscription struct {
+	Symbol   string
+	Interval string
+}
+
+// name returns the binance stream name, <symbol>@kline_<interval>.
+func (ks KlineSubscription) name() string {
+	return strings.ToLower(ks.Symbol) + "@kline_" + ks.Interval
+}
+
+// Kline is a candle pushed by the kline stream. Binance pushes updates of the
+// ongoing candle every two seconds, Closed is set on the last update.
+type Kline struct {
+	Symbol     string
+	Interval   string
+	OpenTime   time.Time
+	CloseTime  time.Time
+	OpenPrice  float64
+	ClosePrice float64
+	Low        float64
+	High       float64
+	Volume     float64
+	Closed     bool
+}
+
+// Klines subscribes to the combined kline streams and calls fn for every
+// kline received. It blocks until the context is cancelled.
+func (s *Stream) Klines(ctx context.Context, subs []KlineSubscription, fn func(Kline)) error {
+	if len(subs) == 0 {
+		return fmt.Errorf("no kline subscriptions")
+	}
+
+	names := make([]string, len(subs))
+	for i, sub := range subs {
+		names[i] = sub.name()
+	}
+	url := fmt.Sprintf("%s/stream?streams=%s", s.baseURL, strings.Join(names, "/"))
+
+	dial := func(ctx context.Context) (string, error) {
+		return url, nil
+	}
+
+	handle := func(msg []byte) error {
+		k, ok, err := toKline(msg)
+		if err != nil {
+			return err
+		}
+		if ok {
+			fn(k)
+		}
+		return nil
+	}
+
+	s.run(ctx, dial, handle)
+	return nil
+}
+
+// run keeps a connection open until the context is cancelled. The dial
+// function returns the url to connect to, so it can change between
+// connections.
+func (s *Stream) run(ctx context.Context, dial func(ctx context.Context) (string, error), handle func(msg []byte) error) {
+	backoff := s.minBackoff
+	for {
+		received, err := s.session(ctx, dial, handle)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// The connection reached its lifetime, reconnect right away.
+		if err == nil {
+			backoff = s.minBackoff
+			continue
+		}
+		s.onError(err)
+
+		if received {
+			backoff = s.minBackoff
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+
+		if backoff *= 2; backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+// session consumes a single connection. It reports whether any message was
+// received, and returns a nil error when the connection reached its lifetime.
+func (s *Stream) session(ctx context.Context, dial func(ctx context.Context) (string, error), handle func(msg []byte) error) (received bool, err error) {
+	url, err := dial(ctx)
+	if err != nil {
+		return false, fmt.Errorf("resolving stream url: %w", err)
+	}
+
+	conn, err := dialWS(ctx, url)
+	if err != nil {
+		return false, fmt.Errorf("connecting to stream: %w", err)
+	}
+	defer conn.Close()
+
+	// Closing the connection is the only way to unblock a pending read.
+	lctx, cancel := context.WithTimeout(ctx, s.lifetime)
+	defer cancel()
+	go func() {
+		<-lctx.Done()
+		conn.Close()
+	}()
+
+	for {
+		msg, err := conn.read(streamReadTimeout)
+		if err != nil {
+			if lctx.Err() != nil {
+				return received, nil
+			}
+			return received, fmt.Errorf("reading stream: %w", err)
+		}
+		received = true
+
+		if err := handle(msg); err != nil {
+			s.onError(err)
+		}
+	}
+}
+
+// toKline decodes a combined stream message. It reports false when the
+// message is not a kline event.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/web-socket-streams.md#klinecandlestick-streams
+func toKline(msg []byte) (Kline, bool, error) {
+	// Binance uses keys that only differ in case, which encoding/json would
+	// match case insensitively. Those keys are declared even if not used.
+	var m struct {
+		Stream string `json:"stream"`
+		Data   struct {
+			Event     string `json:"e"`
+			EventTime int64  `json:"E"`
+			Kline     struct {
+				OpenTime  int64  `json:"t"`
+				CloseTime int64  `json:"T"`
+				Symbol    string `json:"s"`
+				Interval  string `json:"i"`
+				Open      string `json:"o"`
+				Close     string `json:"c"`
+				High      string `json:"h"`
+				Low       string `json:"l"`
+				Volume    string `json:"v"`
+				Closed    bool   `json:"x"`
+
+				LastTradeID      int64  `json:"L"`
+				TakerBuyVolume   string `json:"V"`
+				QuoteVolume      string `json:"q"`
+				TakerQuoteVolume string `json:"Q"`
+			} `json:"k"`
+		} `json:"data"`
+	}
+
+	if err := json.Unmarshal(msg, &m); err != nil {
+		return Kline{}, false, fmt.Errorf("unable to unmarshal stream message: %w", err)
+	}
+	if m.Data.Event != "kline" {
+		return Kline{}, false, nil
+	}
+
+	bk := m.Data.Kline
+	k := Kline{
+		Symbol:    bk.Symbol,
+		Interval:  bk.Interval,
+		OpenTime:  ToTime(float64(bk.OpenTime)),
+		CloseTime: ToTime(float64(bk.CloseTime)),
+		Closed:    bk.Closed,
+	}
+
+	if err := parseFloats(map[*float64]string{
+		&k.OpenPrice:  bk.Open,
+		&k.ClosePrice: bk.Close,
+		&k.High:       bk.High,
+		&k.Low:        bk.Low,
+		&k.Volume:     bk.Volume,
+	}); err != nil {
+		return Kline{}, false, fmt.Errorf("unable to parse kline %s: %w", m.Stream, err)
+	}
+
+	return k, true, nil
+}
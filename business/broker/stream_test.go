@@ -0,0 +1,237 @@
+package broker_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lgarciaaco/machina-api/business/broker"
+)
+
+// wsServer is a websocket stand-in for the binance streams. Every connection
+// gets a ping followed by the messages, then it is closed by the server.
+type wsServer struct {
+	mu    sync.Mutex
+	conns int
+	paths []string
+	pongs []string
+	msgs  []string
+}
+
+func (s *wsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.conns++
+	s.paths = append(s.paths, r.URL.RequestURI())
+	s.mu.Unlock()
+
+	h := sha1.New()
+	h.Write([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(h.Sum(nil)))
+
+	writeFrame(rw, 0x9, "ping")
+	rw.Flush()
+	if pong, err := readFrame(rw.Reader); err == nil {
+		s.mu.Lock()
+		s.pongs = append(s.pongs, pong)
+		s.mu.Unlock()
+	}
+
+	for _, msg := range s.msgs {
+		writeFrame(rw, 0x1, msg)
+	}
+	writeFrame(rw, 0x8, "")
+	rw.Flush()
+	readFrame(rw.Reader)
+}
+
+// writeFrame writes an unmasked server frame.
+func writeFrame(w io.Writer, op byte, payload string) {
+	hdr := []byte{0x80 | op}
+	if n := len(payload); n < 126 {
+		hdr = append(hdr, byte(n))
+	} else {
+		hdr = append(hdr, 126, byte(n>>8), byte(n))
+	}
+	w.Write(hdr)
+	io.WriteString(w, payload)
+}
+
+// readFrame reads a masked client frame with a small payload.
+func readFrame(rd *bufio.Reader) (string, error) {
+	hdr := make([]byte, 6)
+	if _, err := io.ReadFull(rd, hdr); err != nil {
+		return "", err
+	}
+	payload := make([]byte, hdr[1]&0x7F)
+	if _, err := io.ReadFull(rd, payload); err != nil {
+		return "", err
+	}
+	for i := range payload {
+		payload[i] ^= hdr[2+i%4]
+	}
+	return string(payload), nil
+}
+
+func TestStreamKlines(t *testing.T) {
+	srv := wsServer{
+		msgs: []string{
+			`{"stream":"bnbusdt@kline_1m","data":{"e":"kline","E":123456789,"s":"BNBUSDT","k":{"t":1640995200000,"T":1640995259999,"s":"BNBUSDT","i":"1m","o":"511.1","c":"512.2","h":"513.3","l":"510.0","v":"1000","n":100,"x":false,"q":"1.0000","V":"500","Q":"0.500","L":200,"f":100,"B":"0"}}}`,
+			`{"stream":"bnbusdt@kline_1m","data":{"e":"kline","E":123456789,"s":"BNBUSDT","k":{"t":1640995200000,"T":1640995259999,"s":"BNBUSDT","i":"1m","o":"511.1","c":"512.5","h":"513.3","l":"510.0","v":"1200","n":100,"x":true,"q":"1.0000","V":"500","Q":"0.500","L":200,"f":100,"B":"0"}}}`,
+		},
+	}
+	ts := httptest.NewServer(&srv)
+	defer ts.Close()
+
+	stream := broker.NewStream(broker.StreamConfig{
+		BaseURL:    "ws" + strings.TrimPrefix(ts.URL, "http"),
+		MinBackoff: 10 * time.Millisecond,
+	})
+
+	t.Log("Given the need to receive klines from the binance streams.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen subscribing to the kline streams.", testID)
+		{
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			var klines []broker.Kline
+			subs := []broker.KlineSubscription{{Symbol: "BNBUSDT", Interval: "1m"}, {Symbol: "ETHUSDT", Interval: "4h"}}
+			err := stream.Klines(ctx, subs, func(k broker.Kline) {
+				klines = append(klines, k)
+				if len(klines) == 4 {
+					cancel()
+				}
+			})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to subscribe: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to subscribe.", success, testID)
+
+			if len(klines) != 4 {
+				t.Fatalf("\t%s\tTest %d:\tShould reconnect and get 4 klines, got %d.", failed, testID, len(klines))
+			}
+			t.Logf("\t%s\tTest %d:\tShould reconnect and get 4 klines.", success, testID)
+
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+
+			if srv.paths[0] != "/stream?streams=bnbusdt@kline_1m/ethusdt@kline_4h" {
+				t.Fatalf("\t%s\tTest %d:\tShould request the combined streams: %s", failed, testID, srv.paths[0])
+			}
+			t.Logf("\t%s\tTest %d:\tShould request the combined streams.", success, testID)
+
+			if len(srv.pongs) == 0 || srv.pongs[0] != "ping" {
+				t.Fatalf("\t%s\tTest %d:\tShould answer pings with pongs: %v", failed, testID, srv.pongs)
+			}
+			t.Logf("\t%s\tTest %d:\tShould answer pings with pongs.", success, testID)
+
+			k := klines[1]
+			if !k.Closed || k.Symbol != "BNBUSDT" || k.Interval != "1m" || k.ClosePrice != 512.5 || k.Volume != 1200 || k.OpenTime.UnixMilli() != 1640995200000 {
+				t.Fatalf("\t%s\tTest %d:\tShould decode the closed kline: %+v", failed, testID, k)
+			}
+			t.Logf("\t%s\tTest %d:\tShould decode the closed kline.", success, testID)
+		}
+	}
+}
+
+func TestStreamUserData(t *testing.T) {
+	srv := wsServer{
+		msgs: []string{
+			`{"e":"executionReport","E":1499405658658,"s":"ETHBTC","c":"mUvoqJxFIILMdfAW5iGSOW","S":"BUY","o":"LIMIT","f":"GTC","q":"1.00000000","p":"0.10264410","P":"0.00000000","F":"0.00000000","g":-1,"C":"","x":"TRADE","X":"PARTIALLY_FILLED","r":"NONE","i":4293153,"l":"0.40000000","z":"0.40000000","L":"0.10264400","n":"0.00040000","N":"ETH","T":1499405658657,"t":10,"I":8641984,"w":false,"m":false,"M":true,"O":1499405658657,"Z":"0.04105760","Y":"0.04105760","Q":"0.00000000"}`,
+			`{"e":"outboundAccountPosition","E":1564034571105,"u":1564034571073,"B":[{"a":"ETH","f":"10000.000000","l":"0.000000"}]}`,
+			`{"e":"balanceUpdate","E":1573200697110,"a":"BTC","d":"100.00000000","T":1573200697068}`,
+		},
+	}
+
+	var deleted string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/userDataStream", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			w.Write([]byte(`{"listenKey":"pqia91ma19a5s61cv6a81va65sdf19v8a65a1a5s61cv6a81va65sdf19v8a65a1"}`))
+		case http.MethodDelete:
+			deleted = r.URL.Query().Get("listenKey")
+			w.Write([]byte(`{}`))
+		}
+	})
+	mux.Handle("/", &srv)
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	brk := broker.NewBinance(broker.Config{APIKey: "key", Environment: broker.EnvLive, BaseURL: ts.URL})
+	stream := broker.NewStream(broker.StreamConfig{
+		BaseURL:    "ws" + strings.TrimPrefix(ts.URL, "http"),
+		MinBackoff: 10 * time.Millisecond,
+	})
+
+	t.Log("Given the need to receive order and balance updates.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen consuming the user data stream.", testID)
+		{
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			var evts []broker.UserEvent
+			err := stream.UserData(ctx, brk, func(evt broker.UserEvent) {
+				evts = append(evts, evt)
+				if len(evts) == 2 {
+					cancel()
+				}
+			})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to consume the stream: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to consume the stream.", success, testID)
+
+			if len(evts) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould get 2 events, got %d.", failed, testID, len(evts))
+			}
+			t.Logf("\t%s\tTest %d:\tShould get 2 events.", success, testID)
+
+			srv.mu.Lock()
+			path := srv.paths[0]
+			srv.mu.Unlock()
+			if path != "/ws/pqia91ma19a5s61cv6a81va65sdf19v8a65a1a5s61cv6a81va65sdf19v8a65a1" {
+				t.Fatalf("\t%s\tTest %d:\tShould connect with the listen key: %s", failed, testID, path)
+			}
+			t.Logf("\t%s\tTest %d:\tShould connect with the listen key.", success, testID)
+
+			er := evts[0].Execution
+			if er == nil || er.OrderID != 4293153 || er.Status != "PARTIALLY_FILLED" || er.Side != "BUY" || er.CumulativeQuantity != 0.4 || er.LastPrice != 0.102644 || er.ClientOrderID != "mUvoqJxFIILMdfAW5iGSOW" {
+				t.Fatalf("\t%s\tTest %d:\tShould decode the execution report: %+v", failed, testID, er)
+			}
+			t.Logf("\t%s\tTest %d:\tShould decode the execution report.", success, testID)
+
+			ap := evts[1].Account
+			if ap == nil || len(ap.Balances) != 1 || ap.Balances[0].Asset != "ETH" || ap.Balances[0].Free != 10000 {
+				t.Fatalf("\t%s\tTest %d:\tShould decode the account position: %+v", failed, testID, ap)
+			}
+			t.Logf("\t%s\tTest %d:\tShould decode the account position.", success, testID)
+
+			if deleted == "" {
+				t.Fatalf("\t%s\tTest %d:\tShould close the listen key.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould close the listen key.", success, testID)
+		}
+	}
+}
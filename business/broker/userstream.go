@@ -0,0 +1,323 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// KeepAliveInterval is how often the listen key is extended. Binance expires
+// a listen key 60 minutes after the last keepalive.
+const KeepAliveInterval = 30 * time.Minute
+
+// Set of user data stream event types.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/user-data-stream.md
+const (
+	EventExecutionReport = "executionReport"
+	EventAccountPosition = "outboundAccountPosition"
+)
+
+// ExecutionTypeTrade is the execution type of the reports holding a fill.
+const ExecutionTypeTrade = "TRADE"
+
+// ExecutionReport is pushed by binance every time an order changes, when it
+// is accepted, filled, cancelled or expires.
+type ExecutionReport struct {
+	Symbol             string
+	OrderID            int64
+	ClientOrderID      string
+	Side               string
+	Type               string
+	TimeInForce        string
+	Quantity           float64
+	Price              float64
+	StopPrice          float64
+	ExecutionType      string // NEW, CANCELED, REPLACED, REJECTED, TRADE, EXPIRED
+	Status             string // Current status of the order
+	RejectReason       string
+	LastQuantity       float64 // Quantity of the last fill
+	LastPrice          float64 // Price of the last fill
+	CumulativeQuantity float64 // Quantity filled so far
+	CumulativeQuote    float64 // Quote asset transacted so far
+	Commission         float64 // Commission of the last fill
+	CommissionAsset    string
+	TradeID            int64
+	TransactionTime    time.Time
+}
+
+// AccountBalance is the balance of a single asset.
+type AccountBalance struct {
+	Asset  string
+	Free   float64
+	Locked float64
+}
+
+// AccountPosition is pushed by binance every time the balance of an asset
+// changes, it holds only the changed assets.
+type AccountPosition struct {
+	UpdateTime time.Time
+	Balances   []AccountBalance
+}
+
+// UserEvent is an event received from the user data stream. Only the field
+// matching the event type is set.
+type UserEvent struct {
+	Type      string
+	Execution *ExecutionReport
+	Account   *AccountPosition
+}
+
+// UserData manages a user data stream and calls fn for every execution report
+// and account update received. The listen key is created through the broker
+// before connecting and kept alive until the context is cancelled.
+func (s *Stream) UserData(ctx context.Context, brk Broker, fn func(UserEvent)) error {
+	var (
+		mu        sync.Mutex
+		listenKey string
+	)
+
+	dial := func(ctx context.Context) (string, error) {
+		key, err := createListenKey(ctx, brk)
+		if err != nil {
+			return "", err
+		}
+
+		mu.Lock()
+		listenKey = key
+		mu.Unlock()
+
+		return fmt.Sprintf("%s/ws/%s", s.baseURL, key), nil
+	}
+
+	handle := func(msg []byte) error {
+		evt, ok, err := toUserEvent(msg)
+		if err != nil {
+			return err
+		}
+		if ok {
+			fn(evt)
+		}
+		return nil
+	}
+
+	// Keep the listen key alive while the stream runs. A key that expires
+	// anyway makes binance close the connection, and the next dial creates
+	// a new one.
+	kaCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(KeepAliveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-kaCtx.Done():
+				return
+			case <-ticker.C:
+				mu.Lock()
+				key := listenKey
+				mu.Unlock()
+
+				if key == "" {
+					continue
+				}
+				if _, err := brk.Request(kaCtx, http.MethodPut, "userDataStream", "listenKey", key); err != nil {
+					s.onError(fmt.Errorf("keepalive listen key: %w", err))
+				}
+			}
+		}
+	}()
+
+	s.run(ctx, dial, handle)
+
+	// The context is done, use a fresh one to close the listen key.
+	mu.Lock()
+	key := listenKey
+	mu.Unlock()
+	if key != "" {
+		dCtx, dCancel := context.WithTimeout(context.Background(), DialTimeout)
+		defer dCancel()
+		brk.Request(dCtx, http.MethodDelete, "userDataStream", "listenKey", key)
+	}
+
+	return nil
+}
+
+// createListenKey starts a new user data stream. Binance returns the current
+// key when the stream is still active.
+func createListenKey(ctx context.Context, brk Broker) (string, error) {
+	rd, err := brk.Request(ctx, http.MethodPost, "userDataStream")
+	if err != nil {
+		return "", fmt.Errorf("creating listen key: %w", err)
+	}
+
+	var lk struct {
+		ListenKey string `json:"listenKey"`
+	}
+	if err := json.NewDecoder(rd).Decode(&lk); err != nil {
+		return "", fmt.Errorf("unable to unmarshal listen key: %w", err)
+	}
+
+	return lk.ListenKey, nil
+}
+
+// toUserEvent decodes a user data stream message. It reports false when the
+// event type is not handled.
+//
+// https://github.com/binance/binance-spot-api-docs/blob/master/user-data-stream.md
+func toUserEvent(msg []byte) (UserEvent, bool, error) {
+	var evt struct {
+		Event     string `json:"e"`
+		EventTime int64  `json:"E"`
+	}
+	if err := json.Unmarshal(msg, &evt); err != nil {
+		return UserEvent{}, false, fmt.Errorf("unable to unmarshal user event: %w", err)
+	}
+
+	switch evt.Event {
+	case EventExecutionReport:
+		er, err := toExecutionReport(msg)
+		if err != nil {
+			return UserEvent{}, false, err
+		}
+		return UserEvent{Type: evt.Event, Execution: &er}, true, nil
+
+	case EventAccountPosition:
+		ap, err := toAccountPosition(msg)
+		if err != nil {
+			return UserEvent{}, false, err
+		}
+		return UserEvent{Type: evt.Event, Account: &ap}, true, nil
+	}
+
+	return UserEvent{}, false, nil
+}
+
+// toExecutionReport decodes an executionReport event.
+func toExecutionReport(msg []byte) (ExecutionReport, error) {
+	// Binance uses keys that only differ in case, which encoding/json would
+	// match case insensitively. Those keys are declared even if not used.
+	var m struct {
+		Event              string `json:"e"`
+		EventTime          int64  `json:"E"`
+		Symbol             string `json:"s"`
+		Side               string `json:"S"`
+		ClientOrderID      string `json:"c"`
+		OrigClientOrderID  string `json:"C"`
+		Type               string `json:"o"`
+		OrderCreationTime  int64  `json:"O"`
+		TimeInForce        string `json:"f"`
+		IcebergQuantity    string `json:"F"`
+		Quantity           string `json:"q"`
+		QuoteQuantity      string `json:"Q"`
+		Price              string `json:"p"`
+		StopPrice          string `json:"P"`
+		ExecutionType      string `json:"x"`
+		Status             string `json:"X"`
+		RejectReason       string `json:"r"`
+		OrderID            int64  `json:"i"`
+		Ignore             int64  `json:"I"`
+		LastQuantity       string `json:"l"`
+		LastPrice          string `json:"L"`
+		Commission         string `json:"n"`
+		CommissionAsset    string `json:"N"`
+		TransactionTime    int64  `json:"T"`
+		TradeID            int64  `json:"t"`
+		CumulativeQuantity string `json:"z"`
+		CumulativeQuote    string `json:"Z"`
+		IsMaker            bool   `json:"m"`
+		IgnoreM            bool   `json:"M"`
+	}
+	if err := json.Unmarshal(msg, &m); err != nil {
+		return ExecutionReport{}, fmt.Errorf("unable to unmarshal execution report: %w", err)
+	}
+
+	er := ExecutionReport{
+		Symbol:          m.Symbol,
+		OrderID:         m.OrderID,
+		ClientOrderID:   m.ClientOrderID,
+		Side:            m.Side,
+		Type:            m.Type,
+		TimeInForce:     m.TimeInForce,
+		ExecutionType:   m.ExecutionType,
+		Status:          m.Status,
+		RejectReason:    m.RejectReason,
+		CommissionAsset: m.CommissionAsset,
+		TradeID:         m.TradeID,
+		TransactionTime: ToTime(float64(m.TransactionTime)),
+	}
+
+	// A cancel reports the original client order id in C.
+	if m.OrigClientOrderID != "" {
+		er.ClientOrderID = m.OrigClientOrderID
+	}
+
+	if err := parseFloats(map[*float64]string{
+		&er.Quantity:           m.Quantity,
+		&er.Price:              m.Price,
+		&er.StopPrice:          m.StopPrice,
+		&er.LastQuantity:       m.LastQuantity,
+		&er.LastPrice:          m.LastPrice,
+		&er.CumulativeQuantity: m.CumulativeQuantity,
+		&er.CumulativeQuote:    m.CumulativeQuote,
+		&er.Commission:         m.Commission,
+	}); err != nil {
+		return ExecutionReport{}, fmt.Errorf("execution report for order %d: %w", m.OrderID, err)
+	}
+
+	return er, nil
+}
+
+// toAccountPosition decodes an outboundAccountPosition event.
+func toAccountPosition(msg []byte) (AccountPosition, error) {
+	var m struct {
+		Event      string `json:"e"`
+		EventTime  int64  `json:"E"`
+		UpdateTime int64  `json:"u"`
+		Balances   []struct {
+			Asset  string `json:"a"`
+			Free   string `json:"f"`
+			Locked string `json:"l"`
+		} `json:"B"`
+	}
+	if err := json.Unmarshal(msg, &m); err != nil {
+		return AccountPosition{}, fmt.Errorf("unable to unmarshal account position: %w", err)
+	}
+
+	ap := AccountPosition{
+		UpdateTime: ToTime(float64(m.UpdateTime)),
+		Balances:   make([]AccountBalance, len(m.Balances)),
+	}
+	for i, b := range m.Balances {
+		ap.Balances[i].Asset = b.Asset
+		if err := parseFloats(map[*float64]string{
+			&ap.Balances[i].Free:   b.Free,
+			&ap.Balances[i].Locked: b.Locked,
+		}); err != nil {
+			return AccountPosition{}, fmt.Errorf("balance of %s: %w", b.Asset, err)
+		}
+	}
+
+	return ap, nil
+}
+
+// parseFloats parses the decimal strings binance sends into their
+// destinations. Empty strings are left as zero.
+func parseFloats(fields map[*float64]string) error {
+	for dst, val := range fields {
+		if val == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("parsing %q: %w", val, err)
+		}
+		*dst = f
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package broker
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrStreamClosed is returned when the server closes the websocket connection.
+var ErrStreamClosed = errors.New("stream closed by server")
+
+// Set of websocket opcodes.
+//
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.2
+const (
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+)
+
+const (
+	// wsGUID is appended to the handshake key to compute the accept key.
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// maxMessageSize bounds the size of a message read from the stream.
+	maxMessageSize = 1 << 20
+)
+
+// wsConn is a minimal client side websocket connection, just enough to
+// consume binance streams. Messages are read from a single goroutine while
+// frames can be written concurrently.
+type wsConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+
+	mu sync.Mutex // serializes writes
+}
+
+// dialWS opens a websocket connection to the ws or wss url.
+func dialWS(ctx context.Context, rawURL string) (*wsConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing url: %w", err)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		switch u.Scheme {
+		case "wss":
+			host = net.JoinHostPort(u.Hostname(), "443")
+		default:
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	d := net.Dialer{Timeout: DialTimeout, KeepAlive: 30 * time.Second}
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s: %w", host, err)
+	}
+
+	if u.Scheme == "wss" {
+		tc := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("tls handshake: %w", err)
+		}
+		conn = tc
+	}
+
+	ws := wsConn{
+		conn: conn,
+		rd:   bufio.NewReader(conn),
+	}
+	if err := ws.handshake(ctx, u); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &ws, nil
+}
+
+// handshake upgrades the connection to the websocket protocol.
+func (ws *wsConn) handshake(ctx context.Context, u *url.URL) error {
+	nonce := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("generating key: %w", err)
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	hu := *u
+	hu.Scheme = "http"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hu.String(), nil)
+	if err != nil {
+		return fmt.Errorf("unable to create request %w", err)
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	if deadline, ok := ctx.Deadline(); ok {
+		ws.conn.SetDeadline(deadline)
+		defer ws.conn.SetDeadline(time.Time{})
+	}
+
+	if err := req.Write(ws.conn); err != nil {
+		return fmt.Errorf("writing handshake: %w", err)
+	}
+
+	resp, err := http.ReadResponse(ws.rd, req)
+	if err != nil {
+		return fmt.Errorf("reading handshake: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("handshake: %w", &APIError{Status: resp.StatusCode, Message: http.StatusText(resp.StatusCode)})
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return errors.New("handshake: invalid accept key")
+	}
+
+	return nil
+}
+
+// read returns the next data message. Control frames are handled on the way,
+// pings are answered with pongs and a close frame ends the stream.
+func (ws *wsConn) read(timeout time.Duration) ([]byte, error) {
+	var msg []byte
+	for {
+		ws.conn.SetReadDeadline(time.Now().Add(timeout))
+
+		fin, op, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case opPing:
+			if err := ws.write(opPong, payload); err != nil {
+				return nil, fmt.Errorf("writing pong: %w", err)
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			ws.write(opClose, payload)
+			return nil, ErrStreamClosed
+		}
+
+		msg = append(msg, payload...)
+		if len(msg) > maxMessageSize {
+			return nil, fmt.Errorf("message exceeds %d bytes", maxMessageSize)
+		}
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+// readFrame reads a single frame from the connection.
+func (ws *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(ws.rd, hdr[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = hdr[0]&0x80 != 0
+	op = hdr[0] & 0x0F
+	masked := hdr[1]&0x80 != 0
+
+	n := uint64(hdr[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.rd, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.rd, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > maxMessageSize {
+		return false, 0, nil, fmt.Errorf("frame exceeds %d bytes", maxMessageSize)
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(ws.rd, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(ws.rd, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return fin, op, payload, nil
+}
+
+// write sends a single frame. Client frames must always be masked.
+func (ws *wsConn) write(op byte, payload []byte) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|op)
+
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 0x80|126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		frame = append(frame, 0x80|127)
+		frame = append(frame, ext[:]...)
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(rand.Reader, mask[:]); err != nil {
+		return fmt.Errorf("generating mask: %w", err)
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	ws.conn.SetWriteDeadline(time.Now().Add(DialTimeout))
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+// Close closes the underlying connection. It is safe to call it from another
+// goroutine to unblock a pending read.
+func (ws *wsConn) Close() error {
+	return ws.conn.Close()
+}
+
+// acceptKey computes the Sec-WebSocket-Accept value for a handshake key.
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
@@ -4,8 +4,7 @@ package binance
 import (
 	"context"
 	"fmt"
-	"net/http"
-	"strconv"
+	"time"
 
 	"github.com/lgarciaaco/machina-api/business/broker"
 	"go.uber.org/zap"
@@ -13,15 +12,15 @@ import (
 
 // Agent manages the set of API's for candle access.
 type Agent struct {
-	log    *zap.SugaredLogger
-	broker broker.Broker
+	log      *zap.SugaredLogger
+	exchange broker.Exchange
 }
 
 // NewAgent constructs a data for api access.
-func NewAgent(log *zap.SugaredLogger, brk broker.Broker) Agent {
+func NewAgent(log *zap.SugaredLogger, exg broker.Exchange) Agent {
 	return Agent{
-		log:    log,
-		broker: brk,
+		log:      log,
+		exchange: exg,
 	}
 }
 
@@ -29,18 +28,31 @@ func NewAgent(log *zap.SugaredLogger, brk broker.Broker) Agent {
 // identified by their openTime. When reading candlestick data from the restApi, the latest candle is the is newest
 // and considered “open”. Once the next kline is generated, the previous one is closed and will not be modified.
 func (a Agent) QueryBySymbolAndInterval(cxt context.Context, sbl, ival string, limit int) (or []Candle, err error) {
-	bncResp, err := a.broker.Request(cxt, http.MethodGet, "klines",
-		"symbol", sbl,
-		"interval", ival,
-		"limit", strconv.Itoa(limit))
+	ks, err := a.exchange.Klines(cxt, broker.KlineQuery{
+		Symbol:   sbl,
+		Interval: ival,
+		Limit:    limit,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("fetching exchange info %w", err)
+		return nil, fmt.Errorf("fetching klines %w", err)
 	}
 
-	cdls, err := toCandle(bncResp, sbl, ival)
+	return toCandle(ks), nil
+}
+
+// QueryRange fetch the candles opened between start and end from binance api by symbol and
+// interval. At most limit candles are returned, oldest first.
+func (a Agent) QueryRange(cxt context.Context, sbl, ival string, start, end time.Time, limit int) ([]Candle, error) {
+	ks, err := a.exchange.Klines(cxt, broker.KlineQuery{
+		Symbol:   sbl,
+		Interval: ival,
+		Start:    start,
+		End:      end,
+		Limit:    limit,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("marshaling candles %w", err)
+		return nil, fmt.Errorf("fetching klines %w", err)
 	}
 
-	return cdls, nil
+	return toCandle(ks), nil
 }
@@ -6,6 +6,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/lgarciaaco/machina-api/business/core/candle/binance"
 
@@ -24,8 +25,12 @@ var (
 	ErrAuthenticationFailure = errors.New("authentication failed")
 	ErrInvalidID             = errors.New("ID is not in its proper form")
 	ErrInvalidCandle         = errors.New("candle is not valid")
+	ErrCandleOpen            = errors.New("candle is not closed yet")
 )
 
+// backfillLimit is the maximum number of candles binance returns per request.
+const backfillLimit = 1000
+
 // Core manages the set of API's for candle access.
 type Core struct {
 	dbAgent  db.Agent
@@ -33,10 +38,10 @@ type Core struct {
 }
 
 // NewCore constructs a core for user api access.
-func NewCore(log *zap.SugaredLogger, sqlxDB *sqlx.DB, broker broker.Broker) Core {
+func NewCore(log *zap.SugaredLogger, sqlxDB *sqlx.DB, exg broker.Exchange) Core {
 	return Core{
 		dbAgent:  db.NewAgent(log, sqlxDB),
-		bkrAgent: binance.NewAgent(log, broker),
+		bkrAgent: binance.NewAgent(log, exg),
 	}
 }
 
@@ -140,3 +145,89 @@ func (c Core) Seed(ctx context.Context, nCdl NewCandle, n int) error {
 
 	return nil
 }
+
+// Append inserts a closed candle received from the binance kline stream. Candles
+// missing between the last stored candle and k, because the stream was
+// disconnected for example, are backfilled from the rest api first.
+func (c Core) Append(ctx context.Context, nCdl NewCandle, k broker.Kline) (Candle, error) {
+	if err := validate.Check(nCdl); err != nil {
+		return Candle{}, fmt.Errorf("validating data: %w", err)
+	}
+
+	if !k.Closed {
+		return Candle{}, ErrCandleOpen
+	}
+
+	if _, err := c.Backfill(ctx, nCdl, k.OpenTime); err != nil {
+		return Candle{}, fmt.Errorf("backfill: %w", err)
+	}
+
+	dbCdl := db.Candle{
+		ID:         validate.GenerateID(),
+		SymbolID:   nCdl.SymbolID,
+		Symbol:     k.Symbol,
+		Interval:   k.Interval,
+		OpenTime:   k.OpenTime,
+		OpenPrice:  k.OpenPrice,
+		ClosePrice: k.ClosePrice,
+		CloseTime:  k.CloseTime,
+		Low:        k.Low,
+		High:       k.High,
+		Volume:     k.Volume,
+	}
+
+	if err := c.dbAgent.CreateUnlessExists(ctx, dbCdl); err != nil {
+		return Candle{}, fmt.Errorf("create candle in database: %w", err)
+	}
+
+	return toCandle(dbCdl), nil
+}
+
+// Backfill inserts the closed candles opened after the last stored candle and
+// before until. It returns the number of candles fetched from binance. Pairs
+// without any candle are left untouched, they have to be seeded.
+func (c Core) Backfill(ctx context.Context, nCdl NewCandle, until time.Time) (int, error) {
+	if err := validate.Check(nCdl); err != nil {
+		return 0, fmt.Errorf("validating data: %w", err)
+	}
+
+	dbCdls, err := c.dbAgent.QueryBySymbolAndInterval(ctx, 1, 1, nCdl.SymbolID, nCdl.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("query last candle: %w", err)
+	}
+	if len(dbCdls) == 0 {
+		return 0, nil
+	}
+
+	var n int
+	start := toCandle(dbCdls[0]).CloseTime.Add(time.Millisecond)
+	for start.Before(until) {
+		bkrCdls, err := c.bkrAgent.QueryRange(ctx, nCdl.Symbol, nCdl.Interval, start, until.Add(-time.Millisecond), backfillLimit)
+		if err != nil {
+			return n, fmt.Errorf("fetching candles since %s: %w", start, err)
+		}
+
+		for _, bkrCdl := range bkrCdls {
+			// The last candle might still be open.
+			if bkrCdl.CloseTime.After(time.Now()) {
+				continue
+			}
+
+			dbCdl := *(*db.Candle)(&bkrCdl)
+			dbCdl.ID = validate.GenerateID()
+			dbCdl.SymbolID = nCdl.SymbolID
+
+			if err := c.dbAgent.CreateUnlessExists(ctx, dbCdl); err != nil {
+				return n, fmt.Errorf("create candle [%v] in database. [%w]", dbCdl, err)
+			}
+			start = bkrCdl.CloseTime.Add(time.Millisecond)
+			n++
+		}
+
+		if len(bkrCdls) < backfillLimit {
+			break
+		}
+	}
+
+	return n, nil
+}
@@ -2,6 +2,7 @@ package candle
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -34,7 +35,7 @@ func TestCandle(t *testing.T) {
 	log, db, teardown := dbtest.NewUnit(t, c, "testcdl")
 	t.Cleanup(teardown)
 
-	core := NewCore(log, db, broker.TestBinance{})
+	core := NewCore(log, db, broker.NewBinance(broker.Config{}))
 
 	t.Log("Given the need to work with Candle records.")
 	{
@@ -64,6 +65,56 @@ func TestCandle(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould get back the same candle.", dbtest.Success, testID)
 		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen appending a Candle from the kline stream.", testID)
+		{
+			ctx := context.Background()
+			nCdl := NewCandle{
+				SymbolID: "5f25aa33-e294-4353-92b4-246e3bacdfc7",
+				Symbol:   "BTCUSDT",
+				Interval: "1m",
+			}
+			k := broker.Kline{
+				Symbol:     "BTCUSDT",
+				Interval:   "1m",
+				OpenTime:   broker.ToTime(1640995200000),
+				CloseTime:  broker.ToTime(1640995259999),
+				OpenPrice:  46216.93,
+				ClosePrice: 46250.01,
+				Low:        46200.00,
+				High:       46300.00,
+				Volume:     12.5,
+			}
+
+			if _, err := core.Append(ctx, nCdl, k); !errors.Is(err, ErrCandleOpen) {
+				t.Fatalf("\t%s\tTest %d:\tShould not append an open candle : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not append an open candle.", dbtest.Success, testID)
+
+			k.Closed = true
+			cdl, err := core.Append(ctx, nCdl, k)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to append candle : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to append candle.", dbtest.Success, testID)
+
+			if _, err := core.Append(ctx, nCdl, k); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould ignore a candle appended twice : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould ignore a candle appended twice.", dbtest.Success, testID)
+
+			cdls, err := core.QueryBySymbolAndInterval(ctx, 1, 10, nCdl.SymbolID, nCdl.Interval)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve candles : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve candles.", dbtest.Success, testID)
+
+			if len(cdls) != 1 || cdls[0].ID != cdl.ID || cdls[0].ClosePrice != k.ClosePrice {
+				t.Fatalf("\t%s\tTest %d:\tShould get back a single candle : %+v.", dbtest.Failed, testID, cdls)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back a single candle.", dbtest.Success, testID)
+		}
 	}
 }
 
@@ -76,7 +127,7 @@ func TestPagingCandle(t *testing.T) {
 
 	dbschema.Seed(ctx, db)
 
-	candle := NewCore(log, db, broker.Binance{})
+	candle := NewCore(log, db, broker.NewBinance(broker.Config{}))
 
 	t.Log("Given the need to page through Candle records.")
 	{
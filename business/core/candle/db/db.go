@@ -60,6 +60,23 @@ func (s Agent) Create(ctx context.Context, cdl Candle) error {
 	return nil
 }
 
+// CreateUnlessExists inserts a new candle into the database unless a candle
+// with the same symbol, interval and open time already exists.
+func (s Agent) CreateUnlessExists(ctx context.Context, cdl Candle) error {
+	const q = `
+	INSERT INTO candles
+		(candle_id, symbol_id, interval, open_time, open_price, close_time, close_price, low, high, volume)
+	VALUES
+		(:candle_id, :symbol_id, :interval, :open_time, :open_price, :close_time, :close_price, :low, :high, :volume)
+	ON CONFLICT (open_time, symbol_id, interval) DO NOTHING`
+
+	if err := database.NamedExecContext(ctx, s.log, s.db, q, cdl); err != nil {
+		return fmt.Errorf("inserting candle: %w", err)
+	}
+
+	return nil
+}
+
 // Query retrieves a list of existing candles from the database.
 func (s Agent) Query(ctx context.Context, pageNumber int, rowsPerPage int) ([]Candle, error) {
 	data := struct {
@@ -3,10 +3,8 @@ package binance
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
-	"strconv"
+	"time"
 
 	"github.com/lgarciaaco/machina-api/business/broker"
 	"go.uber.org/zap"
@@ -14,52 +12,128 @@ import (
 
 // Agent manages the set of API's for order access.
 type Agent struct {
-	log    *zap.SugaredLogger
-	broker broker.Broker
+	log      *zap.SugaredLogger
+	exchange broker.Exchange
 }
 
 // NewAgent constructs a data for api access.
-func NewAgent(log *zap.SugaredLogger, brk broker.Broker) Agent {
+func NewAgent(log *zap.SugaredLogger, exg broker.Exchange) Agent {
 	return Agent{
-		log:    log,
-		broker: brk,
+		log:      log,
+		exchange: exg,
 	}
 }
 
-// Create dispatch a POST broker call attempting to create a MARKET order. It returns the
-// broker response
+// Create dispatch a POST broker call attempting to create an order. It returns the
+// broker response. Orders that are not filled right away are returned as NEW or
+// PARTIALLY_FILLED, their executions are received through the user data stream.
 func (a Agent) Create(cxt context.Context, nOdr Order) (or OrderResponse, err error) {
-	time, err := a.broker.Time(cxt)
-	if err != nil {
-		return OrderResponse{}, fmt.Errorf("fetching time from api: %w", err)
-	}
-
-	bncResp, err := a.broker.Request(cxt, http.MethodPost, "order",
-		"symbol", nOdr.Symbol,
-		"side", nOdr.Side,
-		"type", nOdr.Type,
-		"quantity", strconv.FormatFloat(nOdr.Quantity, 'f', -1, 64),
-		"timestamp", strconv.FormatInt(time, 10))
+	bkrOdr, err := a.exchange.PlaceOrder(cxt, broker.OrderRequest{
+		Symbol:        nOdr.Symbol,
+		Side:          nOdr.Side,
+		Type:          nOdr.Type,
+		Quantity:      nOdr.Quantity,
+		QuoteQuantity: nOdr.QuoteQuantity,
+		Price:         nOdr.Price,
+		StopPrice:     nOdr.StopPrice,
+		TimeInForce:   nOdr.TimeInForce,
+		ClientOrderID: nOdr.ClientOrderID,
+	})
 	if err != nil {
 		return OrderResponse{}, fmt.Errorf("creating order %w", err)
 	}
+	odrResp := toOrderResponse(bkrOdr)
 
-	var odrResp OrderResponse
-	if err := json.NewDecoder(bncResp).Decode(&odrResp); err != nil {
-		return OrderResponse{}, fmt.Errorf("decoding order response %w", err)
+	switch odrResp.Status {
+	case broker.OrderStatusNew, broker.OrderStatusPartiallyFilled, broker.OrderStatusFilled, broker.OrderStatusExpired:
+	default:
+		return OrderResponse{}, fmt.Errorf("received unsupported status %s", odrResp.Status)
 	}
 
-	if odrResp.Status != "FILLED" {
-		return OrderResponse{}, fmt.Errorf("received unsupported status %s", odrResp.Status)
+	// Nothing was filled yet, there is no price to compute.
+	if len(odrResp.Fills) == 0 {
+		odrResp.Price = 0
+		return odrResp, nil
 	}
 
 	// We calculate the average price for this order iterating
-	// through the different fills
-	price := 0.0
+	// through the different fills, weighted by their quantity
+	var quote, qty float64
 	for _, f := range odrResp.Fills {
-		price += f.Price
+		quote += f.Price * f.Qty
+		qty += f.Qty
+	}
+	if qty > 0 {
+		odrResp.Price = quote / qty
 	}
-	odrResp.Price = price / float64(len(odrResp.Fills))
 
 	return odrResp, nil
 }
+
+// CreateOCO dispatch a POST broker call attempting to create an order list. It
+// returns the state of both legs, which binance keeps open until one executes.
+func (a Agent) CreateOCO(ctx context.Context, oco OCO) (OCOResponse, error) {
+	res, err := a.exchange.PlaceOCO(ctx, broker.OCORequest{
+		Symbol:               oco.Symbol,
+		Side:                 oco.Side,
+		Quantity:             oco.Quantity,
+		Price:                oco.Price,
+		StopPrice:            oco.StopPrice,
+		StopLimitPrice:       oco.StopLimitPrice,
+		StopLimitTimeInForce: broker.TimeInForceGTC,
+		LimitClientOrderID:   oco.LimitClientOrderID,
+		StopClientOrderID:    oco.StopClientOrderID,
+	})
+	if err != nil {
+		return OCOResponse{}, fmt.Errorf("creating order list %w", err)
+	}
+
+	return OCOResponse{
+		OrderListID: res.OrderListID,
+		Orders:      toOrderResponseSlice(res.Orders),
+	}, nil
+}
+
+// Cancel dispatch a DELETE broker call canceling an active order. It returns
+// the final state of the order.
+func (a Agent) Cancel(ctx context.Context, symbol string, brkID int64) (OrderResponse, error) {
+	bkrOdr, err := a.exchange.CancelOrder(ctx, symbol, brkID)
+	if err != nil {
+		return OrderResponse{}, fmt.Errorf("canceling order %w", err)
+	}
+
+	return toOrderResponse(bkrOdr), nil
+}
+
+// CancelOpenOrders dispatch a DELETE broker call canceling every active order
+// of the symbol, including the ones not placed through the system.
+func (a Agent) CancelOpenOrders(ctx context.Context, symbol string) ([]OrderResponse, error) {
+	bkrOdrs, err := a.exchange.CancelOpenOrders(ctx, symbol)
+	if err != nil {
+		return nil, fmt.Errorf("canceling open orders %w", err)
+	}
+
+	return toOrderResponseSlice(bkrOdrs), nil
+}
+
+// OpenOrders dispatch a GET broker call fetching the active orders of the
+// symbol.
+func (a Agent) OpenOrders(ctx context.Context, symbol string) ([]OrderResponse, error) {
+	bkrOdrs, err := a.exchange.OpenOrders(ctx, symbol)
+	if err != nil {
+		return nil, fmt.Errorf("fetching open orders %w", err)
+	}
+
+	return toOrderResponseSlice(bkrOdrs), nil
+}
+
+// AllOrders dispatch a GET broker call fetching the orders of the symbol
+// created since start.
+func (a Agent) AllOrders(ctx context.Context, symbol string, start time.Time) ([]OrderResponse, error) {
+	bkrOdrs, err := a.exchange.AllOrders(ctx, symbol, start)
+	if err != nil {
+		return nil, fmt.Errorf("fetching orders %w", err)
+	}
+
+	return toOrderResponseSlice(bkrOdrs), nil
+}
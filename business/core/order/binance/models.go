@@ -1,34 +1,103 @@
 package binance
 
+import (
+	"time"
+
+	"github.com/lgarciaaco/machina-api/business/broker"
+)
+
 // Order defines a trading order
 type Order struct {
-	Symbol   string  `json:"symbol"`
-	Side     string  `json:"side"`
-	Type     string  `json:"type"`
-	Quantity float64 `json:"quantity"`
+	Symbol        string  `json:"symbol"`
+	Side          string  `json:"side"`
+	Type          string  `json:"type"`
+	Quantity      float64 `json:"quantity"`
+	QuoteQuantity float64 `json:"quoteOrderQty"`
+	Price         float64 `json:"price"`
+	StopPrice     float64 `json:"stopPrice"`
+	TimeInForce   string  `json:"timeInForce"`
+	ClientOrderID string  `json:"newClientOrderId"`
+}
+
+// OCO defines a one-cancels-the-other order list, a LIMIT_MAKER leg at Price
+// and a STOP_LOSS_LIMIT leg triggered at StopPrice
+type OCO struct {
+	Symbol             string  `json:"symbol"`
+	Side               string  `json:"side"`
+	Quantity           float64 `json:"quantity"`
+	Price              float64 `json:"price"`
+	StopPrice          float64 `json:"stopPrice"`
+	StopLimitPrice     float64 `json:"stopLimitPrice"`
+	LimitClientOrderID string  `json:"limitClientOrderId"`
+	StopClientOrderID  string  `json:"stopClientOrderId"`
+}
+
+// OCOResponse defines the response from broker api when an order list is created
+type OCOResponse struct {
+	OrderListID int64           `json:"orderListId"`
+	Orders      []OrderResponse `json:"orderReports"`
 }
 
 // OrderResponse defines the response from broker api when an order is created
 type OrderResponse struct {
-	Symbol              string  `json:"symbol"`
-	OrderID             int     `json:"orderId"`
-	OrderListID         int     `json:"orderListId"`
-	ClientOrderID       string  `json:"clientOrderId"`
-	TransactTime        int64   `json:"transactTime"`
-	Price               float64 `json:"price,string"`
-	OrigQty             float64 `json:"origQty,string"`
-	ExecutedQty         float64 `json:"executedQty,string"`
-	CummulativeQuoteQty string  `json:"cummulativeQuoteQty"`
-	Status              string  `json:"status"`
-	TimeInForce         string  `json:"timeInForce"`
-	Type                string  `json:"type"`
-	Side                string  `json:"side"`
-	Fills               []Fill  `json:"fills"`
+	Symbol              string    `json:"symbol"`
+	OrderID             int64     `json:"orderId"`
+	ClientOrderID       string    `json:"clientOrderId"`
+	TransactTime        time.Time `json:"transactTime"`
+	Price               float64   `json:"price"`
+	OrigQty             float64   `json:"origQty"`
+	ExecutedQty         float64   `json:"executedQty"`
+	CummulativeQuoteQty float64   `json:"cummulativeQuoteQty"`
+	Status              string    `json:"status"`
+	TimeInForce         string    `json:"timeInForce"`
+	Type                string    `json:"type"`
+	Side                string    `json:"side"`
+	Fills               []Fill    `json:"fills"`
 }
 
+// Fill defines a partial execution of an order
 type Fill struct {
-	Price           float64 `json:"price,string"`
-	Qty             float64 `json:"qty,string"`
-	Commission      float64 `json:"commission,string"`
+	TradeID         int64   `json:"tradeId"`
+	Price           float64 `json:"price"`
+	Qty             float64 `json:"qty"`
+	Commission      float64 `json:"commission"`
 	CommissionAsset string  `json:"commissionAsset"`
 }
+
+// toOrderResponse converts the order returned by the exchange.
+func toOrderResponse(or broker.OrderResult) OrderResponse {
+	fills := make([]Fill, len(or.Fills))
+	for i, f := range or.Fills {
+		fills[i] = Fill{
+			TradeID:         f.TradeID,
+			Price:           f.Price,
+			Qty:             f.Quantity,
+			Commission:      f.Commission,
+			CommissionAsset: f.CommissionAsset,
+		}
+	}
+
+	return OrderResponse{
+		Symbol:              or.Symbol,
+		OrderID:             or.OrderID,
+		ClientOrderID:       or.ClientOrderID,
+		TransactTime:        or.TransactTime,
+		Price:               or.Price,
+		OrigQty:             or.OrigQuantity,
+		ExecutedQty:         or.ExecutedQuantity,
+		CummulativeQuoteQty: or.CumulativeQuote,
+		Status:              or.Status,
+		TimeInForce:         or.TimeInForce,
+		Type:                or.Type,
+		Side:                or.Side,
+		Fills:               fills,
+	}
+}
+
+func toOrderResponseSlice(ors []broker.OrderResult) []OrderResponse {
+	odrResps := make([]OrderResponse, len(ors))
+	for i, or := range ors {
+		odrResps[i] = toOrderResponse(or)
+	}
+	return odrResps
+}
@@ -2,8 +2,11 @@
 package db
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/lgarciaaco/machina-api/business/sys/database"
@@ -49,9 +52,11 @@ func (s Agent) Tran(tx sqlx.ExtContext) Agent {
 func (s Agent) Create(ctx context.Context, odr Order) error {
 	const q = `
 	INSERT INTO orders
-		(order_id, symbol_id, position_id, price, quantity, status, type, side, creation_time)
+		(order_id, symbol_id, position_id, price, quantity, status, type, side, creation_time, broker_order_id, executed_quantity,
+		 limit_price, stop_price, time_in_force, client_order_id, quote_quantity, cumulative_quote, leg, order_list_id)
 	VALUES
-		(:order_id, :symbol_id, :position_id, :price, :quantity, :status, :type, :side, :creation_time)`
+		(:order_id, :symbol_id, :position_id, :price, :quantity, :status, :type, :side, :creation_time, :broker_order_id, :executed_quantity,
+		 :limit_price, :stop_price, :time_in_force, :client_order_id, :quote_quantity, :cumulative_quote, :leg, :order_list_id)`
 
 	if err := database.NamedExecContext(ctx, s.log, s.db, q, odr); err != nil {
 		return fmt.Errorf("inserting order: %w", err)
@@ -60,27 +65,125 @@ func (s Agent) Create(ctx context.Context, odr Order) error {
 	return nil
 }
 
-// Query retrieves a list of existing orders from the database.
-func (s Agent) Query(ctx context.Context, pageNumber int, rowsPerPage int) ([]Order, error) {
+// Update replaces the execution state of an order in the database.
+func (s Agent) Update(ctx context.Context, odr Order) error {
+	const q = `
+	UPDATE
+		orders
+	SET
+		"price" = :price,
+		"quantity" = :quantity,
+		"status" = :status,
+		"executed_quantity" = :executed_quantity,
+		"cumulative_quote" = :cumulative_quote,
+		"broker_order_id" = :broker_order_id,
+		"order_list_id" = :order_list_id
+	WHERE
+		order_id = :order_id`
+
+	if err := database.NamedExecContext(ctx, s.log, s.db, q, odr); err != nil {
+		return fmt.Errorf("updating orderID[%s]: %w", odr.ID, err)
+	}
+
+	return nil
+}
+
+// CreateFills inserts the fills of an order into the database. Fills already
+// stored are ignored.
+func (s Agent) CreateFills(ctx context.Context, fills []Fill) error {
+	const q = `
+	INSERT INTO order_fills
+		(order_id, trade_id, price, quantity, commission, commission_asset, trade_time)
+	VALUES
+		(:order_id, :trade_id, :price, :quantity, :commission, :commission_asset, :trade_time)
+	ON CONFLICT DO NOTHING`
+
+	for _, fill := range fills {
+		if err := database.NamedExecContext(ctx, s.log, s.db, q, fill); err != nil {
+			return fmt.Errorf("inserting fill orderID[%s] tradeID[%d]: %w", fill.OrderID, fill.TradeID, err)
+		}
+	}
+
+	return nil
+}
+
+// QueryFills retrieves the fills of an order.
+func (s Agent) QueryFills(ctx context.Context, odrID string) ([]Fill, error) {
 	data := struct {
-		Offset      int `db:"offset"`
-		RowsPerPage int `db:"rows_per_page"`
+		OrderID string `db:"order_id"`
 	}{
-		Offset:      (pageNumber - 1) * rowsPerPage,
-		RowsPerPage: rowsPerPage,
+		OrderID: odrID,
 	}
 
 	const q = `
 	SELECT
 		*
 	FROM
-		orders
+		order_fills
+	WHERE
+		order_id = :order_id
 	ORDER BY
-		creation_time DESC
-	OFFSET :offset ROWS FETCH NEXT :rows_per_page ROWS ONLY`
+		trade_time, trade_id`
+
+	var fills []Fill
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, q, data, &fills); err != nil {
+		return nil, fmt.Errorf("selecting fills of odrID[%q]: %w", odrID, err)
+	}
+
+	return fills, nil
+}
+
+// Delete removes an order from the database.
+func (s Agent) Delete(ctx context.Context, odrID string) error {
+	data := struct {
+		OrderID string `db:"order_id"`
+	}{
+		OrderID: odrID,
+	}
+
+	const q = `
+	DELETE FROM
+		orders
+	WHERE
+		order_id = :order_id`
+
+	if err := database.NamedExecContext(ctx, s.log, s.db, q, data); err != nil {
+		return fmt.Errorf("deleting orderID[%s]: %w", odrID, err)
+	}
+
+	return nil
+}
+
+// Query retrieves a page of the orders that match the filter, sorted by the
+// given field.
+func (s Agent) Query(ctx context.Context, filter QueryFilter, orderBy OrderBy, pageNumber int, rowsPerPage int) ([]Order, error) {
+	data := map[string]interface{}{
+		"offset":        (pageNumber - 1) * rowsPerPage,
+		"rows_per_page": rowsPerPage,
+	}
+
+	const q = `
+	SELECT
+		o.*
+	FROM
+		orders AS o
+	LEFT JOIN
+		positions AS p ON p.position_id = o.position_id
+	LEFT JOIN
+		symbols AS s ON s.symbol_id = o.symbol_id`
+
+	buf := bytes.NewBufferString(q)
+	applyFilter(filter, data, buf)
+
+	by, err := orderByClause(orderBy)
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString(by)
+	buf.WriteString("\n\tOFFSET :offset ROWS FETCH NEXT :rows_per_page ROWS ONLY")
 
 	var odrs []Order
-	if err := database.NamedQuerySlice(ctx, s.log, s.db, q, data, &odrs); err != nil {
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, buf.String(), data, &odrs); err != nil {
 		return nil, fmt.Errorf("selecting orders: %w", err)
 	}
 
@@ -111,16 +214,14 @@ func (s Agent) QueryByID(ctx context.Context, odrID string) (Order, error) {
 	return odr, nil
 }
 
-// QueryByUser gets the specified order from the database.
-func (s Agent) QueryByUser(ctx context.Context, pageNumber int, rowsPerPage int, usrID string) ([]Order, error) {
+// QueryByBrokerID gets the order binance identifies with the symbol and id.
+func (s Agent) QueryByBrokerID(ctx context.Context, symbol string, brkID int64) (Order, error) {
 	data := struct {
-		UserID      string `db:"user_id"`
-		Offset      int    `db:"offset"`
-		RowsPerPage int    `db:"rows_per_page"`
+		Symbol        string `db:"symbol"`
+		BrokerOrderID int64  `db:"broker_order_id"`
 	}{
-		UserID:      usrID,
-		Offset:      (pageNumber - 1) * rowsPerPage,
-		RowsPerPage: rowsPerPage,
+		Symbol:        symbol,
+		BrokerOrderID: brkID,
 	}
 
 	const q = `
@@ -128,22 +229,102 @@ func (s Agent) QueryByUser(ctx context.Context, pageNumber int, rowsPerPage int,
 		o.*
 	FROM
 		orders AS o
-	LEFT JOIN
-		positions AS p ON p.position_id = o.position_id
+	JOIN
+		symbols AS s ON s.symbol_id = o.symbol_id
 	WHERE 
-		p.user_id = :user_id
-	ORDER BY
-		creation_time DESC
-	OFFSET :offset ROWS FETCH NEXT :rows_per_page ROWS ONLY`
+		s.symbol = :symbol AND o.broker_order_id = :broker_order_id`
+
+	var odr Order
+	if err := database.NamedQueryStruct(ctx, s.log, s.db, q, data, &odr); err != nil {
+		return Order{}, fmt.Errorf("selecting symbol[%q] brokerOrderID[%d]: %w", symbol, brkID, err)
+	}
+
+	return odr, nil
+}
+
+// QueryByClientID gets the order sent to binance with the client order id.
+func (s Agent) QueryByClientID(ctx context.Context, clientID string) (Order, error) {
+	data := struct {
+		ClientOrderID string `db:"client_order_id"`
+	}{
+		ClientOrderID: clientID,
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		orders
+	WHERE
+		client_order_id = :client_order_id`
+
+	var odr Order
+	if err := database.NamedQueryStruct(ctx, s.log, s.db, q, data, &odr); err != nil {
+		return Order{}, fmt.Errorf("selecting clientOrderID[%q]: %w", clientID, err)
+	}
+
+	return odr, nil
+}
+
+// QueryByIdempotencyKey gets the order of a position of the user sent to
+// binance with the client order id.
+func (s Agent) QueryByIdempotencyKey(ctx context.Context, usrID string, clientID string) (Order, error) {
+	data := struct {
+		UserID        string `db:"user_id"`
+		ClientOrderID string `db:"client_order_id"`
+	}{
+		UserID:        usrID,
+		ClientOrderID: clientID,
+	}
+
+	const q = `
+	SELECT
+		o.*
+	FROM
+		orders AS o
+	JOIN
+		positions AS p ON o.position_id = p.position_id
+	WHERE
+		p.user_id = :user_id AND o.client_order_id = :client_order_id`
 
-	var odr []Order
-	if err := database.NamedQuerySlice(ctx, s.log, s.db, q, data, &odr); err != nil {
-		return nil, fmt.Errorf("selecting usrID[%q]: %w", usrID, err)
+	var odr Order
+	if err := database.NamedQueryStruct(ctx, s.log, s.db, q, data, &odr); err != nil {
+		return Order{}, fmt.Errorf("selecting userID[%q] clientOrderID[%q]: %w", usrID, clientID, err)
 	}
 
 	return odr, nil
 }
 
+// QueryByStatus retrieves the orders of a symbol with the given status.
+func (s Agent) QueryByStatus(ctx context.Context, symbol string, status string) ([]Order, error) {
+	data := struct {
+		Symbol string `db:"symbol"`
+		Status string `db:"status"`
+	}{
+		Symbol: symbol,
+		Status: status,
+	}
+
+	const q = `
+	SELECT
+		o.*
+	FROM
+		orders AS o
+	JOIN
+		symbols AS s ON s.symbol_id = o.symbol_id
+	WHERE
+		s.symbol = :symbol AND o.status = :status
+	ORDER BY
+		o.creation_time`
+
+	var ords []Order
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, q, data, &ords); err != nil {
+		return nil, fmt.Errorf("selecting symbol[%q] status[%q]: %w", symbol, status, err)
+	}
+
+	return ords, nil
+}
+
 // QueryByPosition retrieves all order for a given position.
 func (s Agent) QueryByPosition(ctx context.Context, odrID string) ([]Order, error) {
 	data := struct {
@@ -169,3 +350,315 @@ func (s Agent) QueryByPosition(ctx context.Context, odrID string) ([]Order, erro
 
 	return ords, nil
 }
+
+// QueryOpenByPosition retrieves the orders of a position that are still
+// active on the exchange.
+func (s Agent) QueryOpenByPosition(ctx context.Context, posID string) ([]Order, error) {
+	data := struct {
+		PositionID string `db:"position_id"`
+	}{
+		PositionID: posID,
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		orders
+	WHERE
+		position_id = :position_id AND status IN ('NEW', 'PARTIALLY_FILLED')
+	ORDER BY
+		creation_time`
+
+	var ords []Order
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, q, data, &ords); err != nil {
+		return nil, fmt.Errorf("selecting open orders of posID[%q]: %w", posID, err)
+	}
+
+	return ords, nil
+}
+
+// QueryOpenByUser retrieves the orders a user placed on a symbol that are
+// still active on the exchange.
+func (s Agent) QueryOpenByUser(ctx context.Context, usrID string, symbol string) ([]Order, error) {
+	data := struct {
+		UserID string `db:"user_id"`
+		Symbol string `db:"symbol"`
+	}{
+		UserID: usrID,
+		Symbol: symbol,
+	}
+
+	const q = `
+	SELECT
+		o.*
+	FROM
+		orders AS o
+	JOIN
+		positions AS p ON p.position_id = o.position_id
+	JOIN
+		symbols AS s ON s.symbol_id = o.symbol_id
+	WHERE
+		p.user_id = :user_id AND s.symbol = :symbol AND o.status IN ('NEW', 'PARTIALLY_FILLED')
+	ORDER BY
+		o.creation_time`
+
+	var ords []Order
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, q, data, &ords); err != nil {
+		return nil, fmt.Errorf("selecting open orders of usrID[%q] symbol[%q]: %w", usrID, symbol, err)
+	}
+
+	return ords, nil
+}
+
+// QueryLegs retrieves the legs of the bracket of a position.
+func (s Agent) QueryLegs(ctx context.Context, posID string) ([]Order, error) {
+	data := struct {
+		PositionID string `db:"position_id"`
+	}{
+		PositionID: posID,
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		orders
+	WHERE
+		position_id = :position_id AND leg <> ''
+	ORDER BY
+		leg`
+
+	var ords []Order
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, q, data, &ords); err != nil {
+		return nil, fmt.Errorf("selecting legs of posID[%q]: %w", posID, err)
+	}
+
+	return ords, nil
+}
+
+// QueryBracket gets the take profit and stop loss attached to a position.
+func (s Agent) QueryBracket(ctx context.Context, posID string) (Bracket, error) {
+	data := struct {
+		PositionID string `db:"position_id"`
+	}{
+		PositionID: posID,
+	}
+
+	const q = `
+	SELECT
+		p.position_id, s.symbol, p.side, UPPER(p.status) AS status, p.take_profit, p.stop_loss, p.stop_limit
+	FROM
+		positions AS p
+	JOIN
+		symbols AS s ON p.symbol_id = s.symbol_id
+	WHERE
+		p.position_id = :position_id`
+
+	var brk Bracket
+	if err := database.NamedQueryStruct(ctx, s.log, s.db, q, data, &brk); err != nil {
+		return Bracket{}, fmt.Errorf("selecting bracket of posID[%q]: %w", posID, err)
+	}
+
+	return brk, nil
+}
+
+// CloseFlatPosition closes an open position once the executed quantity of its
+// orders nets to zero, binance quantities have eight decimals at most. It
+// reports whether the position was closed. A position locked by another
+// update is skipped, the fill of the next order settles it.
+func (s Agent) CloseFlatPosition(ctx context.Context, posID string) (bool, error) {
+	data := struct {
+		PositionID string `db:"position_id"`
+	}{
+		PositionID: posID,
+	}
+
+	const q = `
+	UPDATE
+		positions AS p
+	SET
+		status = 'CLOSED'
+	WHERE
+		p.position_id = (
+			SELECT position_id FROM positions
+			WHERE position_id = :position_id AND UPPER(status) = 'OPEN'
+			FOR NO KEY UPDATE SKIP LOCKED
+		) AND
+		EXISTS (SELECT 1 FROM orders WHERE position_id = p.position_id AND executed_quantity > 0) AND
+		ABS((
+			SELECT SUM(CASE WHEN o.side = p.side THEN o.executed_quantity ELSE -o.executed_quantity END)
+			FROM orders AS o WHERE o.position_id = p.position_id
+		)) < 0.000000005
+	RETURNING
+		p.position_id`
+
+	var closed struct {
+		PositionID string `db:"position_id"`
+	}
+	if err := database.NamedQueryStruct(ctx, s.log, s.db, q, data, &closed); err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("closing flat posID[%s]: %w", posID, err)
+	}
+
+	return true, nil
+}
+
+// UpsertUnknown inserts or updates an order found on binance only. The time it
+// was first detected is kept.
+func (s Agent) UpsertUnknown(ctx context.Context, uOdr UnknownOrder) error {
+	const q = `
+	INSERT INTO unknown_orders
+		(symbol, broker_order_id, client_order_id, side, type, status, price, quantity, executed_quantity, transact_time, detection_time)
+	VALUES
+		(:symbol, :broker_order_id, :client_order_id, :side, :type, :status, :price, :quantity, :executed_quantity, :transact_time, :detection_time)
+	ON CONFLICT (symbol, broker_order_id) DO UPDATE SET
+		status = EXCLUDED.status,
+		price = EXCLUDED.price,
+		executed_quantity = EXCLUDED.executed_quantity`
+
+	if err := database.NamedExecContext(ctx, s.log, s.db, q, uOdr); err != nil {
+		return fmt.Errorf("upserting unknown order symbol[%s] brokerOrderID[%d]: %w", uOdr.Symbol, uOdr.BrokerOrderID, err)
+	}
+
+	return nil
+}
+
+// QueryFilters gets the trading rules of a symbol. MARKET orders have no
+// price, so the close of the latest candle is returned to estimate it.
+func (s Agent) QueryFilters(ctx context.Context, sblID string) (Filters, error) {
+	data := struct {
+		SymbolID string `db:"symbol_id"`
+	}{
+		SymbolID: sblID,
+	}
+
+	const q = `
+	SELECT
+		s.min_price, s.max_price, s.tick_size, s.min_qty, s.max_qty, s.step_size, s.min_notional,
+		s.max_notional, s.apply_min_to_market, s.apply_max_to_market, s.market_min_qty, s.market_max_qty, s.market_step_size,
+		COALESCE(s.quote_order_qty_market_allowed, FALSE) AS quote_allowed,
+		COALESCE((
+			SELECT c.close_price FROM candles AS c
+			WHERE c.symbol_id = s.symbol_id
+			ORDER BY c.close_time DESC
+			LIMIT 1
+		), 0) AS last_price
+	FROM
+		symbols AS s
+	WHERE
+		s.symbol_id = :symbol_id`
+
+	var flt Filters
+	if err := database.NamedQueryStruct(ctx, s.log, s.db, q, data, &flt); err != nil {
+		return Filters{}, fmt.Errorf("selecting filters sblID[%q]: %w", sblID, err)
+	}
+
+	return flt, nil
+}
+
+// UpsertBalance inserts or updates the balance of an asset. Updates older
+// than the stored balance are ignored.
+func (s Agent) UpsertBalance(ctx context.Context, bln Balance) error {
+	const q = `
+	INSERT INTO balances
+		(asset, free, locked, update_time)
+	VALUES
+		(:asset, :free, :locked, :update_time)
+	ON CONFLICT (asset) DO UPDATE SET
+		free = EXCLUDED.free,
+		locked = EXCLUDED.locked,
+		update_time = EXCLUDED.update_time
+	WHERE
+		balances.update_time <= EXCLUDED.update_time`
+
+	if err := database.NamedExecContext(ctx, s.log, s.db, q, bln); err != nil {
+		return fmt.Errorf("upserting balance[%s]: %w", bln.Asset, err)
+	}
+
+	return nil
+}
+
+// QueryBalances retrieves the balances of every asset.
+func (s Agent) QueryBalances(ctx context.Context) ([]Balance, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		balances
+	ORDER BY
+		asset`
+
+	var blns []Balance
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, q, struct{}{}, &blns); err != nil {
+		return nil, fmt.Errorf("selecting balances: %w", err)
+	}
+
+	return blns, nil
+}
+
+// applyFilter appends the conditions of the filter to the query. Values are
+// always passed as named parameters.
+func applyFilter(filter QueryFilter, data map[string]interface{}, buf *bytes.Buffer) {
+	var wc []string
+
+	if filter.UserID != "" {
+		data["user_id"] = filter.UserID
+		wc = append(wc, "p.user_id = :user_id")
+	}
+	if filter.Symbol != "" {
+		data["symbol"] = filter.Symbol
+		wc = append(wc, "s.symbol = :symbol")
+	}
+	if filter.Status != "" {
+		data["status"] = filter.Status
+		wc = append(wc, "o.status = :status")
+	}
+	if filter.Side != "" {
+		data["side"] = filter.Side
+		wc = append(wc, "o.side = :side")
+	}
+	if filter.PositionID != "" {
+		data["position_id"] = filter.PositionID
+		wc = append(wc, "o.position_id = :position_id")
+	}
+	if !filter.CreatedAfter.IsZero() {
+		data["created_after"] = filter.CreatedAfter
+		wc = append(wc, "o.creation_time >= :created_after")
+	}
+	if !filter.CreatedBefore.IsZero() {
+		data["created_before"] = filter.CreatedBefore
+		wc = append(wc, "o.creation_time < :created_before")
+	}
+
+	if len(wc) > 0 {
+		buf.WriteString("\n\tWHERE\n\t\t")
+		buf.WriteString(strings.Join(wc, " AND "))
+	}
+}
+
+// orderByClause builds the ORDER BY clause of a query. Only the columns in
+// OrderByFields can be sorted by, the newest orders come first by default.
+func orderByClause(orderBy OrderBy) (string, error) {
+	if orderBy.Field == "" {
+		orderBy.Field = "creation_time"
+	}
+	col, ok := OrderByFields[orderBy.Field]
+	if !ok {
+		return "", fmt.Errorf("field %q can't be sorted by", orderBy.Field)
+	}
+
+	dir := "DESC"
+	switch strings.ToUpper(orderBy.Direction) {
+	case "", "DESC":
+	case "ASC":
+		dir = "ASC"
+	default:
+		return "", fmt.Errorf("direction %q is not asc or desc", orderBy.Direction)
+	}
+
+	// Ties keep a stable order between pages.
+	return "\n\tORDER BY\n\t\t" + col + " " + dir + ", o.order_id", nil
+}
@@ -4,13 +4,119 @@ import "time"
 
 // Order defines a trading order
 type Order struct {
-	ID           string    `db:"order_id"`      // Order ID
-	SymbolID     string    `db:"symbol_id"`     // SymbolID ID, this orders trades on
-	PositionID   string    `db:"position_id"`   // Order ID this order belongs to
-	CreationTime time.Time `db:"creation_time"` // Order creation time
-	Price        float64   `db:"price"`         // Price of the base asset
-	Quantity     float64   `db:"quantity"`      // Amount of the base asset
-	Status       string    `db:"status"`        // Status received from binance: FILLED, NEW, CANCELED
-	Type         string    `db:"type"`          // For the moment only MARKET is supported
-	Side         string    `db:"side"`          // Either SELL or BUY
+	ID               string    `db:"order_id"`          // Order ID
+	SymbolID         string    `db:"symbol_id"`         // SymbolID ID, this orders trades on
+	PositionID       string    `db:"position_id"`       // Order ID this order belongs to
+	CreationTime     time.Time `db:"creation_time"`     // Order creation time
+	Price            float64   `db:"price"`             // Average price the base asset was filled at
+	Quantity         float64   `db:"quantity"`          // Amount of the base asset
+	Status           string    `db:"status"`            // PENDING until sent, then the status received from binance: NEW, PARTIALLY_FILLED, FILLED, CANCELED, EXPIRED
+	Type             string    `db:"type"`              // MARKET, LIMIT, LIMIT_MAKER, STOP_LOSS_LIMIT or TAKE_PROFIT_LIMIT
+	Side             string    `db:"side"`              // Either SELL or BUY
+	BrokerOrderID    int64     `db:"broker_order_id"`   // Order ID assigned by binance
+	ExecutedQuantity float64   `db:"executed_quantity"` // Amount of the base asset filled so far
+	LimitPrice       float64   `db:"limit_price"`       // Limit price, zero for MARKET orders
+	StopPrice        float64   `db:"stop_price"`        // Price that triggers STOP_LOSS_LIMIT and TAKE_PROFIT_LIMIT orders
+	TimeInForce      string    `db:"time_in_force"`     // GTC, IOC or FOK, empty for MARKET and LIMIT_MAKER orders
+	ClientOrderID    string    `db:"client_order_id"`   // Order ID sent to binance, it finds the order before binance assigns one
+	QuoteQuantity    float64   `db:"quote_quantity"`    // Amount of the quote asset a MARKET order spends or receives, zero when the quantity is set
+	CumulativeQuote  float64   `db:"cumulative_quote"`  // Amount of the quote asset filled so far
+	Leg              string    `db:"leg"`               // TAKE_PROFIT or STOP_LOSS for the legs of the bracket of the position, empty otherwise
+	OrderListID      int64     `db:"order_list_id"`     // Order list ID assigned by binance to the legs of a bracket
+}
+
+// QueryFilter defines the conditions the orders of a query match. Zero values
+// are conditions not applied.
+type QueryFilter struct {
+	UserID        string
+	Symbol        string
+	Status        string
+	Side          string
+	PositionID    string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+// OrderBy defines the field and direction orders are sorted by.
+type OrderBy struct {
+	Field     string
+	Direction string
+}
+
+// OrderByFields maps the fields orders can be sorted by to their column.
+var OrderByFields = map[string]string{
+	"creation_time": "o.creation_time",
+	"price":         "o.price",
+	"quantity":      "o.quantity",
+	"status":        "o.status",
+	"side":          "o.side",
+	"type":          "o.type",
+	"symbol":        "s.symbol",
+}
+
+// Fill defines a partial execution of an order
+type Fill struct {
+	OrderID         string    `db:"order_id"`         // Order ID the fill belongs to
+	TradeID         int64     `db:"trade_id"`         // Trade ID assigned by binance
+	Price           float64   `db:"price"`            // Price the quantity was filled at
+	Quantity        float64   `db:"quantity"`         // Amount of the base asset filled
+	Commission      float64   `db:"commission"`       // Commission charged for the fill
+	CommissionAsset string    `db:"commission_asset"` // Asset the commission was charged in
+	TradeTime       time.Time `db:"trade_time"`       // Time of the fill
+}
+
+// UnknownOrder defines an order found on binance that was not placed through
+// the system. It is kept for review.
+type UnknownOrder struct {
+	Symbol           string    `db:"symbol"`            // Symbol the order trades on
+	BrokerOrderID    int64     `db:"broker_order_id"`   // Order ID assigned by binance
+	ClientOrderID    string    `db:"client_order_id"`   // Client order ID reported by binance
+	Side             string    `db:"side"`              // Either SELL or BUY
+	Type             string    `db:"type"`              // Order type reported by binance
+	Status           string    `db:"status"`            // Last status reported by binance
+	Price            float64   `db:"price"`             // Average price the base asset was filled at
+	Quantity         float64   `db:"quantity"`          // Amount of the base asset
+	ExecutedQuantity float64   `db:"executed_quantity"` // Amount of the base asset filled so far
+	TransactTime     time.Time `db:"transact_time"`     // Time binance created the order
+	DetectionTime    time.Time `db:"detection_time"`    // Time the order was first found
+}
+
+// Balance defines the balance of an asset in the binance account
+type Balance struct {
+	Asset      string    `db:"asset"`       // Asset name, BTC, USDT
+	Free       float64   `db:"free"`        // Amount available for trading
+	Locked     float64   `db:"locked"`      // Amount locked by open orders
+	UpdateTime time.Time `db:"update_time"` // Time of the last update received from binance
+}
+
+// Bracket defines the take profit and stop loss attached to a position. Zero
+// prices are a position without bracket.
+type Bracket struct {
+	PositionID string  `db:"position_id"` // Position the bracket is attached to
+	Symbol     string  `db:"symbol"`      // Symbol the position trades on
+	Side       string  `db:"side"`        // Side of the position, the legs have the opposite side
+	Status     string  `db:"status"`      // Status of the position
+	TakeProfit float64 `db:"take_profit"` // Price of the LIMIT_MAKER leg
+	StopLoss   float64 `db:"stop_loss"`   // Price that triggers the STOP_LOSS_LIMIT leg
+	StopLimit  float64 `db:"stop_limit"`  // Limit price of the STOP_LOSS_LIMIT leg, the stop loss when zero
+}
+
+// Filters defines the trading rules binance checks the orders of a symbol
+// against. Zero values are rules the symbol doesn't have.
+type Filters struct {
+	MinPrice         float64 `db:"min_price"`           // Lowest price allowed
+	MaxPrice         float64 `db:"max_price"`           // Highest price allowed
+	TickSize         float64 `db:"tick_size"`           // Prices are multiples of the tick size
+	MinQty           float64 `db:"min_qty"`             // Lowest quantity allowed
+	MaxQty           float64 `db:"max_qty"`             // Highest quantity allowed
+	StepSize         float64 `db:"step_size"`           // Quantities are multiples of the step size
+	MinNotional      float64 `db:"min_notional"`        // Lowest price times quantity allowed
+	MaxNotional      float64 `db:"max_notional"`        // Highest price times quantity allowed
+	ApplyMinToMarket bool    `db:"apply_min_to_market"` // MinNotional applies to MARKET orders
+	ApplyMaxToMarket bool    `db:"apply_max_to_market"` // MaxNotional applies to MARKET orders
+	MarketMinQty     float64 `db:"market_min_qty"`      // Lowest quantity allowed for MARKET orders
+	MarketMaxQty     float64 `db:"market_max_qty"`      // Highest quantity allowed for MARKET orders
+	MarketStepSize   float64 `db:"market_step_size"`    // Step size of MARKET orders
+	QuoteAllowed     bool    `db:"quote_allowed"`       // MARKET orders can set a quote quantity
+	LastPrice        float64 `db:"last_price"`          // Close of the latest candle, zero without candles
 }
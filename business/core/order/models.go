@@ -8,29 +8,158 @@ import (
 
 // Order represents an individual order
 type Order struct {
-	ID           string    `json:"order_id"`
-	SymbolID     string    `json:"symbol_id"`
-	PositionID   string    `json:"position_id"`
-	CreationTime time.Time `json:"creation_time"`
-	Price        float64   `json:"price"`
-	Quantity     float64   `json:"quantity"`
-	Status       string    `json:"status"`
-	Type         string    `json:"type"`
-	Side         string    `json:"side"`
-}
-
-// NewOrder contains information needed to create a new Order.
+	ID               string    `json:"order_id"`
+	SymbolID         string    `json:"symbol_id"`
+	PositionID       string    `json:"position_id"`
+	CreationTime     time.Time `json:"creation_time"`
+	Price            float64   `json:"price"`
+	Quantity         float64   `json:"quantity"`
+	Status           string    `json:"status"`
+	Type             string    `json:"type"`
+	Side             string    `json:"side"`
+	BrokerOrderID    int64     `json:"broker_order_id"`
+	ExecutedQuantity float64   `json:"executed_quantity"`
+	LimitPrice       float64   `json:"limit_price"`
+	StopPrice        float64   `json:"stop_price"`
+	TimeInForce      string    `json:"time_in_force"`
+	ClientOrderID    string    `json:"client_order_id"`
+	QuoteQuantity    float64   `json:"quote_quantity"`
+	CumulativeQuote  float64   `json:"cumulative_quote"`
+	Leg              string    `json:"leg"`
+	OrderListID      int64     `json:"order_list_id"`
+	Fills            []Fill    `json:"fills,omitempty"`
+}
+
+// Fill represents a partial execution of an order
+type Fill struct {
+	TradeID         int64     `json:"trade_id"`
+	Price           float64   `json:"price"`
+	Quantity        float64   `json:"quantity"`
+	Commission      float64   `json:"commission"`
+	CommissionAsset string    `json:"commission_asset"`
+	TradeTime       time.Time `json:"trade_time"`
+}
+
+// Reconciliation sums up the changes a reconciliation made to the orders of
+// a symbol.
+type Reconciliation struct {
+	Symbol    string
+	Updated   int // Updated orders had a state different from the exchange
+	Completed int // Completed orders were pending and found on the exchange
+	Rejected  int // Rejected orders were pending and never reached the exchange
+	Unknown   int // Unknown orders are on the exchange but were not placed through the system
+}
+
+// Balance represents the balance of an asset in the binance account
+type Balance struct {
+	Asset      string    `json:"asset"`
+	Free       float64   `json:"free"`
+	Locked     float64   `json:"locked"`
+	UpdateTime time.Time `json:"update_time"`
+}
+
+// NewBracket contains the take profit and stop loss to attach to a position
+// on the symbol. Side is the side of the position. StopLimit is the limit
+// price of the stop loss, the stop loss itself when zero.
+type NewBracket struct {
+	SymbolID   string
+	Side       string
+	TakeProfit float64
+	StopLoss   float64
+	StopLimit  float64
+}
+
+// NewOrder contains information needed to create a new Order. Type defaults
+// to MARKET. Every other type needs a price, stop limit orders a stop price
+// too. MARKET orders can set QuoteQuantity instead of Quantity, to spend or
+// receive an amount of the quote asset when the symbol allows it.
+// TimeInForce defaults to GTC for the types that take it. Round rounds
+// the quantity and prices down to the step and tick sizes of the symbol
+// instead of rejecting them. IdempotencyKey is the idempotency key of the
+// request, a retry of the user with the same key gets the order placed the
+// first time.
 type NewOrder struct {
-	PositionID string  `json:"position_id" validate:"required"`
-	SymbolID   string  `json:"-"`
-	Symbol     string  `json:"-"`
-	Quantity   float64 `json:"quantity" validate:"required"`
-	Side       string  `json:"side" validate:"required"`
+	PositionID     string  `json:"position_id" validate:"required"`
+	SymbolID       string  `json:"-"`
+	Symbol         string  `json:"-"`
+	UserID         string  `json:"-"`
+	IdempotencyKey string  `json:"-"`
+	Quantity       float64 `json:"quantity" validate:"required_without=QuoteQuantity"`
+	QuoteQuantity  float64 `json:"quote_quantity" validate:"omitempty,gt=0"`
+	Side           string  `json:"side" validate:"required"`
+	Type           string  `json:"type" validate:"omitempty,oneof=MARKET LIMIT LIMIT_MAKER STOP_LOSS_LIMIT TAKE_PROFIT_LIMIT"`
+	Price          float64 `json:"price" validate:"omitempty,gt=0"`
+	StopPrice      float64 `json:"stop_price" validate:"omitempty,gt=0"`
+	TimeInForce    string  `json:"time_in_force" validate:"omitempty,oneof=GTC IOC FOK"`
+	Round          bool    `json:"round"`
+}
+
+// QueryFilter holds the conditions the orders of a query match. Zero values
+// are not applied, CreatedBefore is exclusive.
+type QueryFilter struct {
+	Symbol        string    `json:"symbol"`
+	Status        string    `json:"status" validate:"omitempty,oneof=PENDING NEW PARTIALLY_FILLED FILLED CANCELED PENDING_CANCEL REJECTED EXPIRED"`
+	Side          string    `json:"side" validate:"omitempty,oneof=BUY SELL"`
+	PositionID    string    `json:"position_id" validate:"omitempty,uuid4"`
+	CreatedAfter  time.Time `json:"created_after"`
+	CreatedBefore time.Time `json:"created_before"`
+}
+
+// OrderBy holds the field and direction orders are sorted by. The newest
+// orders come first by default.
+type OrderBy struct {
+	Field     string `json:"sort"`
+	Direction string `json:"direction" validate:"omitempty,oneof=asc desc ASC DESC"`
+}
+
+func toDBQueryFilter(filter QueryFilter) db.QueryFilter {
+	return db.QueryFilter{
+		Symbol:        filter.Symbol,
+		Status:        filter.Status,
+		Side:          filter.Side,
+		PositionID:    filter.PositionID,
+		CreatedAfter:  filter.CreatedAfter,
+		CreatedBefore: filter.CreatedBefore,
+	}
 }
 
 func toOrder(dbOdr db.Order) Order {
-	pc := (*Order)(&dbOdr)
-	return *pc
+	return Order{
+		ID:               dbOdr.ID,
+		SymbolID:         dbOdr.SymbolID,
+		PositionID:       dbOdr.PositionID,
+		CreationTime:     dbOdr.CreationTime,
+		Price:            dbOdr.Price,
+		Quantity:         dbOdr.Quantity,
+		Status:           dbOdr.Status,
+		Type:             dbOdr.Type,
+		Side:             dbOdr.Side,
+		BrokerOrderID:    dbOdr.BrokerOrderID,
+		ExecutedQuantity: dbOdr.ExecutedQuantity,
+		LimitPrice:       dbOdr.LimitPrice,
+		StopPrice:        dbOdr.StopPrice,
+		TimeInForce:      dbOdr.TimeInForce,
+		ClientOrderID:    dbOdr.ClientOrderID,
+		QuoteQuantity:    dbOdr.QuoteQuantity,
+		CumulativeQuote:  dbOdr.CumulativeQuote,
+		Leg:              dbOdr.Leg,
+		OrderListID:      dbOdr.OrderListID,
+	}
+}
+
+func toFillSlice(dbFills []db.Fill) []Fill {
+	fills := make([]Fill, len(dbFills))
+	for i, dbFill := range dbFills {
+		fills[i] = Fill{
+			TradeID:         dbFill.TradeID,
+			Price:           dbFill.Price,
+			Quantity:        dbFill.Quantity,
+			Commission:      dbFill.Commission,
+			CommissionAsset: dbFill.CommissionAsset,
+			TradeTime:       dbFill.TradeTime,
+		}
+	}
+	return fills
 }
 
 func toOrderSlice(dbOrds []db.Order) []Order {
@@ -40,3 +169,11 @@ func toOrderSlice(dbOrds []db.Order) []Order {
 	}
 	return odrs
 }
+
+func toBalanceSlice(dbBlns []db.Balance) []Balance {
+	blns := make([]Balance, len(dbBlns))
+	for i, dbBln := range dbBlns {
+		blns[i] = Balance(dbBln)
+	}
+	return blns
+}
@@ -6,12 +6,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lgarciaaco/machina-api/business/core/order/binance"
 
 	"github.com/lgarciaaco/machina-api/business/broker"
 
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/lgarciaaco/machina-api/business/core/order/db"
 	"github.com/lgarciaaco/machina-api/business/sys/database"
@@ -24,57 +29,177 @@ var (
 	ErrNotFound              = errors.New("order not found")
 	ErrAuthenticationFailure = errors.New("authentication failed")
 	ErrInvalidID             = errors.New("ID is not in its proper form")
+	ErrNotOpen               = errors.New("order is not open")
+	ErrIdempotencyConflict   = errors.New("idempotency key was used for a different order")
 )
 
+// StatusPending is the status of an order stored before binance confirms it.
+const StatusPending = "PENDING"
+
+// Set of legs of the bracket attached to a position.
+const (
+	LegTakeProfit = "TAKE_PROFIT"
+	LegStopLoss   = "STOP_LOSS"
+)
+
+// QuantityTolerance is half the smallest quantity binance trades, quantities
+// have eight decimals at most. Net quantities below it are zero.
+const QuantityTolerance = 0.000000005
+
+// PendingTimeout is how long an order can stay pending before the reconciler
+// considers binance never got it.
+const PendingTimeout = time.Minute
+
 // Core manages the set of API's for candle access.
 type Core struct {
+	log      *zap.SugaredLogger
 	dbAgent  db.Agent
 	bkrAgent binance.Agent
 }
 
 // NewCore constructs a core for user api access.
-func NewCore(log *zap.SugaredLogger, sqlxDB *sqlx.DB, brk broker.Broker) Core {
+func NewCore(log *zap.SugaredLogger, sqlxDB *sqlx.DB, exg broker.Exchange) Core {
 	return Core{
+		log:      log,
 		dbAgent:  db.NewAgent(log, sqlxDB),
-		bkrAgent: binance.NewAgent(log, brk),
+		bkrAgent: binance.NewAgent(log, exg),
 	}
 }
 
 // Create inserts a new order into the database.
 func (c Core) Create(ctx context.Context, nOdr NewOrder, now time.Time) (Order, error) {
+	if nOdr.Type == "" {
+		nOdr.Type = broker.OrderTypeMarket
+	}
 	if err := validate.Check(nOdr); err != nil {
 		return Order{}, fmt.Errorf("validating data: %w", err)
 	}
+	if err := checkType(&nOdr); err != nil {
+		return Order{}, fmt.Errorf("validating data: %w", err)
+	}
+
+	flt, err := c.dbAgent.QueryFilters(ctx, nOdr.SymbolID)
+	if err != nil {
+		return Order{}, fmt.Errorf("query filters: %w", err)
+	}
+	if err := checkFilters(&nOdr, flt); err != nil {
+		return Order{}, fmt.Errorf("validating data: %w", err)
+	}
+
+	// The bracket of the position is placed once the entry fills, its prices
+	// are checked before the entry is sent as binance can't take it back.
+	brk, err := c.dbAgent.QueryBracket(ctx, nOdr.PositionID)
+	if err != nil && !errors.Is(err, database.ErrDBNotFound) {
+		return Order{}, fmt.Errorf("query bracket: %w", err)
+	}
+	if brk.TakeProfit != 0 && brk.Side == nOdr.Side && brk.Status != "CLOSED" {
+		if err := checkBracket(brk, flt); err != nil {
+			return Order{}, fmt.Errorf("validating data: %w", err)
+		}
+	}
+
+	// A retried request finds the order placed by the first one.
+	if nOdr.IdempotencyKey != "" {
+		odr, found, err := c.replay(ctx, nOdr)
+		if err != nil || found {
+			return odr, err
+		}
+	}
+
+	// The order is stored before it is sent, so an order binance accepts is
+	// never lost if the system stops before storing the response. The
+	// reconciler finds it on binance with the client order id.
+	dbOdr := db.Order{
+		ID:            validate.GenerateID(),
+		SymbolID:      nOdr.SymbolID,
+		PositionID:    nOdr.PositionID,
+		CreationTime:  now,
+		Quantity:      nOdr.Quantity,
+		QuoteQuantity: nOdr.QuoteQuantity,
+		Status:        StatusPending,
+		Type:          nOdr.Type,
+		Side:          nOdr.Side,
+		LimitPrice:    nOdr.Price,
+		StopPrice:     nOdr.StopPrice,
+		TimeInForce:   nOdr.TimeInForce,
+	}
+	dbOdr.ClientOrderID = dbOdr.ID
+	if nOdr.IdempotencyKey != "" {
+		dbOdr.ClientOrderID = clientOrderID(nOdr.UserID, nOdr.IdempotencyKey)
+	}
+
+	if err := c.dbAgent.Create(ctx, dbOdr); err != nil {
+		// The first request stored the order in the meantime.
+		if errors.Is(err, database.ErrDBDuplicatedEntry) {
+			odr, _, err := c.replay(ctx, nOdr)
+			return odr, err
+		}
+		return Order{}, fmt.Errorf("create: %w", err)
+	}
 
 	// Create order with the broker
 	bkrOdr := binance.Order{
-		Symbol:   nOdr.Symbol,
-		Side:     nOdr.Side,
-		Type:     broker.OrderTypeMarket,
-		Quantity: nOdr.Quantity,
+		Symbol:        nOdr.Symbol,
+		Side:          nOdr.Side,
+		Type:          nOdr.Type,
+		Quantity:      nOdr.Quantity,
+		QuoteQuantity: nOdr.QuoteQuantity,
+		Price:         nOdr.Price,
+		StopPrice:     nOdr.StopPrice,
+		TimeInForce:   nOdr.TimeInForce,
+		ClientOrderID: dbOdr.ClientOrderID,
 	}
 	or, err := c.bkrAgent.Create(ctx, bkrOdr)
 	if err != nil {
+		// Orders binance rejected are dropped, the others stay pending until
+		// the reconciler finds out whether binance got them.
+		if broker.IsRejected(err) {
+			if err := c.dbAgent.Delete(ctx, dbOdr.ID); err != nil {
+				return Order{}, fmt.Errorf("delete: %w", err)
+			}
+		}
 		return Order{}, fmt.Errorf("create: %w", err)
 	}
 
-	dbOdr := db.Order{
-		ID:           validate.GenerateID(),
-		SymbolID:     nOdr.SymbolID,
-		PositionID:   nOdr.PositionID,
-		CreationTime: now,
-		Price:        or.Price,
-		Quantity:     nOdr.Quantity,
-		Status:       or.Status,
-		Type:         broker.OrderTypeMarket,
-		Side:         nOdr.Side,
+	dbOdr.BrokerOrderID = or.OrderID
+	dbOdr.Status = or.Status
+	dbOdr.ExecutedQuantity = or.ExecutedQty
+	dbOdr.CumulativeQuote = or.CummulativeQuoteQty
+	dbOdr.Price = or.Price
+
+	// The base quantity of an order placed for a quote quantity is the
+	// quantity binance filled.
+	if dbOdr.QuoteQuantity > 0 {
+		dbOdr.Quantity = or.ExecutedQty
 	}
 
-	if err := c.dbAgent.Create(ctx, dbOdr); err != nil {
-		return Order{}, fmt.Errorf("create: %w", err)
+	dbFills := make([]db.Fill, len(or.Fills))
+	for i, f := range or.Fills {
+		dbFills[i] = db.Fill{
+			OrderID:         dbOdr.ID,
+			TradeID:         f.TradeID,
+			Price:           f.Price,
+			Quantity:        f.Qty,
+			Commission:      f.Commission,
+			CommissionAsset: f.CommissionAsset,
+			TradeTime:       or.TransactTime,
+		}
 	}
 
-	return toOrder(dbOdr), nil
+	if err := c.store(ctx, dbOdr, dbFills); err != nil {
+		return Order{}, err
+	}
+
+	odr := toOrder(dbOdr)
+	odr.Fills = toFillSlice(dbFills)
+
+	// The order is placed whatever happens to the bracket, failing the
+	// request would have the caller place it again.
+	if err := c.settle(ctx, odr, now); err != nil {
+		c.log.Errorw("settle", "orderID", odr.ID, "positionID", odr.PositionID, "ERROR", err)
+	}
+
+	return odr, nil
 }
 
 // QueryByID gets the specified order from the database.
@@ -91,12 +216,25 @@ func (c Core) QueryByID(ctx context.Context, odrID string) (Order, error) {
 		return Order{}, fmt.Errorf("query: %w", err)
 	}
 
-	return toOrder(odr), nil
+	dbFills, err := c.dbAgent.QueryFills(ctx, odrID)
+	if err != nil {
+		return Order{}, fmt.Errorf("query: %w", err)
+	}
+
+	o := toOrder(odr)
+	o.Fills = toFillSlice(dbFills)
+
+	return o, nil
 }
 
-// Query gets the specified orders.
-func (c Core) Query(ctx context.Context, pageNumber int, rowsPerPage int) ([]Order, error) {
-	dbOdrs, err := c.dbAgent.Query(ctx, pageNumber, rowsPerPage)
+// Query gets a page of the orders that match the filter, sorted by the
+// given field.
+func (c Core) Query(ctx context.Context, filter QueryFilter, orderBy OrderBy, pageNumber int, rowsPerPage int) ([]Order, error) {
+	if err := checkQuery(filter, orderBy); err != nil {
+		return nil, fmt.Errorf("validating data: %w", err)
+	}
+
+	dbOdrs, err := c.dbAgent.Query(ctx, toDBQueryFilter(filter), db.OrderBy(orderBy), pageNumber, rowsPerPage)
 	if err != nil {
 		if errors.Is(err, database.ErrDBNotFound) {
 			return nil, ErrNotFound
@@ -107,9 +245,17 @@ func (c Core) Query(ctx context.Context, pageNumber int, rowsPerPage int) ([]Ord
 	return toOrderSlice(dbOdrs), nil
 }
 
-// QueryByUser gets the specified orders from the database given a userId.
-func (c Core) QueryByUser(ctx context.Context, pageNumber int, rowsPerPage int, usrID string) ([]Order, error) {
-	dbOdrs, err := c.dbAgent.QueryByUser(ctx, pageNumber, rowsPerPage, usrID)
+// QueryByUser gets a page of the orders of a user that match the filter,
+// sorted by the given field.
+func (c Core) QueryByUser(ctx context.Context, filter QueryFilter, orderBy OrderBy, pageNumber int, rowsPerPage int, usrID string) ([]Order, error) {
+	if err := checkQuery(filter, orderBy); err != nil {
+		return nil, fmt.Errorf("validating data: %w", err)
+	}
+
+	dbFilter := toDBQueryFilter(filter)
+	dbFilter.UserID = usrID
+
+	dbOdrs, err := c.dbAgent.Query(ctx, dbFilter, db.OrderBy(orderBy), pageNumber, rowsPerPage)
 	if err != nil {
 		if errors.Is(err, database.ErrDBNotFound) {
 			return nil, ErrNotFound
@@ -119,3 +265,953 @@ func (c Core) QueryByUser(ctx context.Context, pageNumber int, rowsPerPage int,
 
 	return toOrderSlice(dbOdrs), nil
 }
+
+// ApplyExecution updates the order binance reports in the execution report.
+// It returns ErrNotFound when the order was not placed through the system.
+func (c Core) ApplyExecution(ctx context.Context, er broker.ExecutionReport) (Order, error) {
+	dbOdr, found, err := c.match(ctx, er.Symbol, er.OrderID, er.ClientOrderID)
+	if err != nil {
+		return Order{}, fmt.Errorf("query: %w", err)
+	}
+	if !found {
+		return Order{}, ErrNotFound
+	}
+
+	var dbFills []db.Fill
+	if er.ExecutionType == broker.ExecutionTypeTrade {
+		dbFills = append(dbFills, db.Fill{
+			OrderID:         dbOdr.ID,
+			TradeID:         er.TradeID,
+			Price:           er.LastPrice,
+			Quantity:        er.LastQuantity,
+			Commission:      er.Commission,
+			CommissionAsset: er.CommissionAsset,
+			TradeTime:       er.TransactionTime,
+		})
+	}
+
+	odr, err := c.apply(ctx, dbOdr, er.Status, er.CumulativeQuantity, er.CumulativeQuote, dbFills...)
+	if err != nil {
+		return Order{}, err
+	}
+
+	if err := c.settle(ctx, odr, er.TransactionTime); err != nil {
+		return odr, err
+	}
+
+	return odr, nil
+}
+
+// Reconcile compares the orders of the symbol binance reports with the ones in
+// the database. Orders binance reports as open or created since the given
+// time are checked. Pending orders are completed when found, or rejected once
+// they are older than PendingTimeout. Wrong states are fixed, and orders that
+// were not placed through the system are stored for review.
+func (c Core) Reconcile(ctx context.Context, symbol string, since time.Time, now time.Time) (Reconciliation, error) {
+	rcn := Reconciliation{Symbol: symbol}
+
+	pending, err := c.dbAgent.QueryByStatus(ctx, symbol, StatusPending)
+	if err != nil {
+		return rcn, fmt.Errorf("query: %w", err)
+	}
+	for _, p := range pending {
+		if p.CreationTime.Before(since) {
+			since = p.CreationTime
+		}
+	}
+
+	open, err := c.bkrAgent.OpenOrders(ctx, symbol)
+	if err != nil {
+		return rcn, fmt.Errorf("reconcile: %w", err)
+	}
+	all, err := c.bkrAgent.AllOrders(ctx, symbol, since)
+	if err != nil {
+		return rcn, fmt.Errorf("reconcile: %w", err)
+	}
+
+	// Open orders created before since are not in all orders.
+	ors := all
+	seen := make(map[int64]bool, len(all))
+	for _, or := range all {
+		seen[or.OrderID] = true
+	}
+	for _, or := range open {
+		if !seen[or.OrderID] {
+			ors = append(ors, or)
+		}
+	}
+
+	found := make(map[string]bool)
+	for _, or := range ors {
+		dbOdr, ok, err := c.match(ctx, symbol, or.OrderID, or.ClientOrderID)
+		if err != nil {
+			return rcn, fmt.Errorf("query: %w", err)
+		}
+
+		if !ok {
+			uOdr := db.UnknownOrder{
+				Symbol:           symbol,
+				BrokerOrderID:    or.OrderID,
+				ClientOrderID:    or.ClientOrderID,
+				Side:             or.Side,
+				Type:             or.Type,
+				Status:           or.Status,
+				Quantity:         or.OrigQty,
+				ExecutedQuantity: or.ExecutedQty,
+				TransactTime:     or.TransactTime,
+				DetectionTime:    now,
+			}
+			if or.ExecutedQty > 0 {
+				uOdr.Price = or.CummulativeQuoteQty / or.ExecutedQty
+			}
+			if err := c.dbAgent.UpsertUnknown(ctx, uOdr); err != nil {
+				return rcn, fmt.Errorf("upsert: %w", err)
+			}
+			rcn.Unknown++
+			continue
+		}
+		found[dbOdr.ID] = true
+
+		if dbOdr.Status == StatusPending {
+			rcn.Completed++
+		} else if dbOdr.Status != or.Status || dbOdr.ExecutedQuantity != or.ExecutedQty {
+			rcn.Updated++
+		}
+
+		odr, err := c.apply(ctx, dbOdr, or.Status, or.ExecutedQty, or.CummulativeQuoteQty)
+		if err != nil {
+			return rcn, err
+		}
+		if err := c.settle(ctx, odr, now); err != nil {
+			return rcn, err
+		}
+	}
+
+	for _, p := range pending {
+		if found[p.ID] || p.CreationTime.After(now.Add(-PendingTimeout)) {
+			continue
+		}
+
+		p.Status = broker.OrderStatusRejected
+		if err := c.dbAgent.Update(ctx, p); err != nil {
+			return rcn, fmt.Errorf("update: %w", err)
+		}
+		rcn.Rejected++
+	}
+
+	return rcn, nil
+}
+
+// Cancel cancels an order that is still active on the exchange and stores
+// its final state. The symbol is the one the order trades on.
+func (c Core) Cancel(ctx context.Context, odrID string, symbol string) (Order, error) {
+	if err := validate.CheckID(odrID); err != nil {
+		return Order{}, ErrInvalidID
+	}
+
+	dbOdr, err := c.dbAgent.QueryByID(ctx, odrID)
+	if err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return Order{}, ErrNotFound
+		}
+		return Order{}, fmt.Errorf("query: %w", err)
+	}
+
+	return c.cancel(ctx, dbOdr, symbol)
+}
+
+// CancelByPosition cancels the orders of a position that are still active on
+// the exchange. It returns the canceled orders.
+func (c Core) CancelByPosition(ctx context.Context, posID string, symbol string) ([]Order, error) {
+	if err := validate.CheckID(posID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	dbOdrs, err := c.dbAgent.QueryOpenByPosition(ctx, posID)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	return c.cancelAll(ctx, dbOdrs, symbol)
+}
+
+// CancelByUser cancels the orders a user placed on the symbol that are still
+// active on the exchange. It returns the canceled orders.
+func (c Core) CancelByUser(ctx context.Context, usrID string, symbol string) ([]Order, error) {
+	dbOdrs, err := c.dbAgent.QueryOpenByUser(ctx, usrID, symbol)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	return c.cancelAll(ctx, dbOdrs, symbol)
+}
+
+// CancelBySymbol cancels every order active on the exchange for the symbol,
+// including the ones not placed through the system. It returns the canceled
+// orders the system knows about.
+func (c Core) CancelBySymbol(ctx context.Context, symbol string) ([]Order, error) {
+	ors, err := c.bkrAgent.CancelOpenOrders(ctx, symbol)
+	if err != nil {
+		// Binance answers with an unknown order when nothing is open.
+		if errors.Is(err, broker.ErrUnknownOrder) {
+			return []Order{}, nil
+		}
+		return nil, fmt.Errorf("cancel: %w", err)
+	}
+
+	odrs := []Order{}
+	for _, or := range ors {
+		dbOdr, err := c.dbAgent.QueryByBrokerID(ctx, symbol, or.OrderID)
+		if err != nil {
+			if errors.Is(err, database.ErrDBNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("query: %w", err)
+		}
+
+		odr, err := c.apply(ctx, dbOdr, or.Status, or.ExecutedQty, or.CummulativeQuoteQty)
+		if err != nil {
+			return nil, err
+		}
+		odrs = append(odrs, odr)
+	}
+
+	return odrs, nil
+}
+
+// UpdateBalances stores the balances binance reports in an account update.
+func (c Core) UpdateBalances(ctx context.Context, ap broker.AccountPosition) error {
+	for _, b := range ap.Balances {
+		dbBln := db.Balance{
+			Asset:      b.Asset,
+			Free:       b.Free,
+			Locked:     b.Locked,
+			UpdateTime: ap.UpdateTime,
+		}
+
+		if err := c.dbAgent.UpsertBalance(ctx, dbBln); err != nil {
+			return fmt.Errorf("upsert: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// QueryBalances gets the balances of the binance account.
+func (c Core) QueryBalances(ctx context.Context) ([]Balance, error) {
+	dbBlns, err := c.dbAgent.QueryBalances(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	return toBalanceSlice(dbBlns), nil
+}
+
+// =============================================================================
+
+// cancel cancels the order with the exchange and stores its final state.
+func (c Core) cancel(ctx context.Context, dbOdr db.Order, symbol string) (Order, error) {
+	if isFinal(dbOdr.Status) || dbOdr.Status == StatusPending {
+		return Order{}, ErrNotOpen
+	}
+
+	or, err := c.bkrAgent.Cancel(ctx, symbol, dbOdr.BrokerOrderID)
+	if err != nil {
+		return Order{}, fmt.Errorf("cancel: %w", err)
+	}
+
+	return c.apply(ctx, dbOdr, or.Status, or.ExecutedQty, or.CummulativeQuoteQty)
+}
+
+// cancelAll cancels the orders one by one. Orders the exchange doesn't know as
+// active anymore are skipped, their state arrives through the user data stream.
+func (c Core) cancelAll(ctx context.Context, dbOdrs []db.Order, symbol string) ([]Order, error) {
+	odrs := []Order{}
+	for _, dbOdr := range dbOdrs {
+		odr, err := c.cancel(ctx, dbOdr, symbol)
+		if err != nil {
+			if errors.Is(err, broker.ErrUnknownOrder) {
+				continue
+			}
+			return odrs, fmt.Errorf("orderID[%s]: %w", dbOdr.ID, err)
+		}
+		odrs = append(odrs, odr)
+	}
+
+	return odrs, nil
+}
+
+// clientOrderID returns the client order id binance gets for the idempotency
+// key of a user. Keys are scoped per user, so the id is derived from both to
+// keep the keys of different users from colliding.
+func clientOrderID(usrID string, key string) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(usrID+"/"+key)).String()
+}
+
+// replay gets the order the user placed with the idempotency key of the new
+// order, with its fills. The order is returned as stored, a pending order is
+// still being placed or waits for the reconciler. It fails with
+// ErrIdempotencyConflict when the key was used for a different order.
+func (c Core) replay(ctx context.Context, nOdr NewOrder) (Order, bool, error) {
+	dbOdr, err := c.dbAgent.QueryByIdempotencyKey(ctx, nOdr.UserID, clientOrderID(nOdr.UserID, nOdr.IdempotencyKey))
+	if err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return Order{}, false, nil
+		}
+		return Order{}, false, fmt.Errorf("query: %w", err)
+	}
+
+	// The base quantity of orders placed for a quote quantity is the
+	// quantity filled.
+	sameQty := dbOdr.QuoteQuantity == nOdr.QuoteQuantity && (nOdr.QuoteQuantity > 0 || dbOdr.Quantity == nOdr.Quantity)
+	if dbOdr.PositionID != nOdr.PositionID || dbOdr.Side != nOdr.Side || dbOdr.Type != nOdr.Type || !sameQty ||
+		dbOdr.LimitPrice != nOdr.Price || dbOdr.StopPrice != nOdr.StopPrice || dbOdr.TimeInForce != nOdr.TimeInForce {
+		return Order{}, false, ErrIdempotencyConflict
+	}
+
+	dbFills, err := c.dbAgent.QueryFills(ctx, dbOdr.ID)
+	if err != nil {
+		return Order{}, false, fmt.Errorf("query fills: %w", err)
+	}
+
+	odr := toOrder(dbOdr)
+	odr.Fills = toFillSlice(dbFills)
+
+	// The first request might have stopped before placing the bracket.
+	if err := c.settle(ctx, odr, dbOdr.CreationTime); err != nil {
+		c.log.Errorw("settle", "orderID", odr.ID, "positionID", odr.PositionID, "ERROR", err)
+	}
+
+	return odr, true, nil
+}
+
+// match finds the order binance identifies with the symbol and id. Orders
+// binance didn't confirm yet are found with the client order id, they get the
+// binance id.
+func (c Core) match(ctx context.Context, symbol string, brkID int64, clientID string) (db.Order, bool, error) {
+	dbOdr, err := c.dbAgent.QueryByBrokerID(ctx, symbol, brkID)
+	if err == nil {
+		return dbOdr, true, nil
+	}
+	if !errors.Is(err, database.ErrDBNotFound) {
+		return db.Order{}, false, err
+	}
+
+	// Client order ids generated by binance are not in the database, the ones
+	// sent are order ids or idempotency keys.
+	if clientID == "" {
+		return db.Order{}, false, nil
+	}
+
+	dbOdr, err = c.dbAgent.QueryByClientID(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return db.Order{}, false, nil
+		}
+		return db.Order{}, false, err
+	}
+	if dbOdr.BrokerOrderID != 0 && dbOdr.BrokerOrderID != brkID {
+		return db.Order{}, false, nil
+	}
+	dbOdr.BrokerOrderID = brkID
+
+	return dbOdr, true, nil
+}
+
+// apply stores the execution state the exchange reports for an order and
+// its new fills. Reports might arrive out of order, never go back on filled
+// quantity nor leave a final status.
+func (c Core) apply(ctx context.Context, dbOdr db.Order, status string, cumQty float64, cumQuote float64, dbFills ...db.Fill) (Order, error) {
+	stale := cumQty < dbOdr.ExecutedQuantity || (cumQty == dbOdr.ExecutedQuantity && isFinal(dbOdr.Status))
+	if stale {
+		// A late report still holds a fill that happened.
+		if err := c.dbAgent.CreateFills(ctx, dbFills); err != nil {
+			return Order{}, fmt.Errorf("create fills: %w", err)
+		}
+		return toOrder(dbOdr), nil
+	}
+
+	dbOdr.Status = status
+	dbOdr.ExecutedQuantity = cumQty
+	dbOdr.CumulativeQuote = cumQuote
+	if dbOdr.QuoteQuantity > 0 {
+		dbOdr.Quantity = cumQty
+	}
+	if cumQty > 0 {
+		dbOdr.Price = cumQuote / cumQty
+	}
+
+	if err := c.store(ctx, dbOdr, dbFills); err != nil {
+		return Order{}, err
+	}
+
+	return toOrder(dbOdr), nil
+}
+
+// store updates the order and inserts its fills in a single transaction.
+func (c Core) store(ctx context.Context, dbOdr db.Order, dbFills []db.Fill) error {
+	tran := func(tx sqlx.ExtContext) error {
+		if err := c.dbAgent.Tran(tx).Update(ctx, dbOdr); err != nil {
+			return fmt.Errorf("update: %w", err)
+		}
+		if err := c.dbAgent.Tran(tx).CreateFills(ctx, dbFills); err != nil {
+			return fmt.Errorf("create fills: %w", err)
+		}
+		return nil
+	}
+
+	if err := c.dbAgent.WithinTran(ctx, tran); err != nil {
+		return fmt.Errorf("tran: %w", err)
+	}
+
+	return nil
+}
+
+// settle acts on the position of a filled order. A filled leg cancels the
+// other one, any other fill sizes the bracket to the quantity the position
+// holds. The position is closed once its orders net to zero.
+func (c Core) settle(ctx context.Context, odr Order, now time.Time) error {
+	if odr.Status != broker.OrderStatusFilled {
+		return nil
+	}
+
+	if odr.Leg != "" {
+		if err := c.closeBracket(ctx, odr); err != nil {
+			return err
+		}
+		return c.closeFlat(ctx, odr)
+	}
+
+	if err := c.placeBracket(ctx, odr, now); err != nil {
+		return err
+	}
+
+	return c.closeFlat(ctx, odr)
+}
+
+// closeFlat closes the position of a filled order when the quantity its
+// orders bought and sold nets to zero, and cancels the orders it still has
+// active on the exchange.
+func (c Core) closeFlat(ctx context.Context, odr Order) error {
+	closed, err := c.dbAgent.CloseFlatPosition(ctx, odr.PositionID)
+	if err != nil {
+		return fmt.Errorf("close position: %w", err)
+	}
+	if !closed {
+		return nil
+	}
+
+	dbOdrs, err := c.dbAgent.QueryOpenByPosition(ctx, odr.PositionID)
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+	if len(dbOdrs) == 0 {
+		return nil
+	}
+
+	brk, err := c.dbAgent.QueryBracket(ctx, odr.PositionID)
+	if err != nil {
+		return fmt.Errorf("query bracket: %w", err)
+	}
+	if _, err := c.cancelAll(ctx, dbOdrs, brk.Symbol); err != nil {
+		return fmt.Errorf("cancel orders: %w", err)
+	}
+
+	return nil
+}
+
+// placeBracket submits the take profit and stop loss of the position as an
+// OCO order list for the net quantity the position holds. A bracket for a
+// different quantity is canceled and replaced, as entries scale the position
+// in and exits scale it out. The legs are stored pending before they are
+// sent, the unique index on the active legs of a position keeps a second call
+// from placing them twice.
+func (c Core) placeBracket(ctx context.Context, odr Order, now time.Time) error {
+	brk, err := c.dbAgent.QueryBracket(ctx, odr.PositionID)
+	if err != nil {
+		return fmt.Errorf("query bracket: %w", err)
+	}
+	if brk.TakeProfit == 0 || brk.Status == "CLOSED" {
+		return nil
+	}
+
+	dbOdrs, err := c.dbAgent.QueryByPosition(ctx, odr.PositionID)
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+
+	var net float64
+	var active []db.Order
+	for _, dbOdr := range dbOdrs {
+		if dbOdr.Side == brk.Side {
+			net += dbOdr.ExecutedQuantity
+		} else {
+			net -= dbOdr.ExecutedQuantity
+		}
+		if dbOdr.Leg != "" && !isFinal(dbOdr.Status) {
+			active = append(active, dbOdr)
+		}
+	}
+
+	for _, leg := range active {
+		// Legs being placed are left to the call placing them.
+		if leg.Status == StatusPending {
+			return nil
+		}
+		if math.Abs(leg.Quantity-leg.ExecutedQuantity-net) < QuantityTolerance {
+			return nil
+		}
+	}
+	if err := c.cancelLegs(ctx, active, brk.Symbol); err != nil {
+		return fmt.Errorf("cancel legs: %w", err)
+	}
+	if net < QuantityTolerance {
+		return nil
+	}
+
+	side := broker.OrderSideSell
+	if brk.Side == broker.OrderSideSell {
+		side = broker.OrderSideBuy
+	}
+	stopLimit := brk.StopLimit
+	if stopLimit == 0 {
+		stopLimit = brk.StopLoss
+	}
+
+	tp := db.Order{
+		ID:           validate.GenerateID(),
+		SymbolID:     odr.SymbolID,
+		PositionID:   odr.PositionID,
+		CreationTime: now,
+		Quantity:     net,
+		Status:       StatusPending,
+		Type:         broker.OrderTypeLimitMaker,
+		Side:         side,
+		LimitPrice:   brk.TakeProfit,
+		Leg:          LegTakeProfit,
+	}
+	tp.ClientOrderID = tp.ID
+
+	sl := db.Order{
+		ID:           validate.GenerateID(),
+		SymbolID:     odr.SymbolID,
+		PositionID:   odr.PositionID,
+		CreationTime: now,
+		Quantity:     net,
+		Status:       StatusPending,
+		Type:         broker.OrderTypeStopLossLimit,
+		Side:         side,
+		LimitPrice:   stopLimit,
+		StopPrice:    brk.StopLoss,
+		TimeInForce:  broker.TimeInForceGTC,
+		Leg:          LegStopLoss,
+	}
+	sl.ClientOrderID = sl.ID
+
+	tran := func(tx sqlx.ExtContext) error {
+		for _, leg := range []db.Order{tp, sl} {
+			if err := c.dbAgent.Tran(tx).Create(ctx, leg); err != nil {
+				return fmt.Errorf("create: %w", err)
+			}
+		}
+		return nil
+	}
+	if err := c.dbAgent.WithinTran(ctx, tran); err != nil {
+		if errors.Is(err, database.ErrDBDuplicatedEntry) {
+			return nil
+		}
+		return fmt.Errorf("tran: %w", err)
+	}
+
+	res, err := c.bkrAgent.CreateOCO(ctx, binance.OCO{
+		Symbol:             brk.Symbol,
+		Side:               side,
+		Quantity:           net,
+		Price:              tp.LimitPrice,
+		StopPrice:          sl.StopPrice,
+		StopLimitPrice:     sl.LimitPrice,
+		LimitClientOrderID: tp.ClientOrderID,
+		StopClientOrderID:  sl.ClientOrderID,
+	})
+	if err != nil {
+		if broker.IsRejected(err) {
+			for _, leg := range []db.Order{tp, sl} {
+				if err := c.dbAgent.Delete(ctx, leg.ID); err != nil {
+					return fmt.Errorf("delete: %w", err)
+				}
+			}
+		}
+		return fmt.Errorf("create bracket: %w", err)
+	}
+
+	for _, leg := range []db.Order{tp, sl} {
+		for _, or := range res.Orders {
+			if or.ClientOrderID != leg.ClientOrderID {
+				continue
+			}
+			leg.BrokerOrderID = or.OrderID
+			leg.Status = or.Status
+			leg.ExecutedQuantity = or.ExecutedQty
+			leg.CumulativeQuote = or.CummulativeQuoteQty
+			leg.OrderListID = res.OrderListID
+			if err := c.dbAgent.Update(ctx, leg); err != nil {
+				return fmt.Errorf("update: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// closeBracket cancels the legs still open once one of them filled. Binance
+// cancels the other leg of an order list by itself, the legs it already
+// cancelled are marked so.
+func (c Core) closeBracket(ctx context.Context, leg Order) error {
+	dbLegs, err := c.dbAgent.QueryLegs(ctx, leg.PositionID)
+	if err != nil {
+		return fmt.Errorf("query legs: %w", err)
+	}
+
+	brk, err := c.dbAgent.QueryBracket(ctx, leg.PositionID)
+	if err != nil {
+		return fmt.Errorf("query bracket: %w", err)
+	}
+
+	var open []db.Order
+	for _, dbLeg := range dbLegs {
+		if dbLeg.ID != leg.ID && !isFinal(dbLeg.Status) && dbLeg.Status != StatusPending {
+			open = append(open, dbLeg)
+		}
+	}
+	if err := c.cancelLegs(ctx, open, brk.Symbol); err != nil {
+		return fmt.Errorf("cancel legs: %w", err)
+	}
+
+	return nil
+}
+
+// cancelLegs cancels the legs of a bracket. Binance cancels the whole order
+// list with its first leg, the legs it doesn't know as active anymore are
+// marked canceled so a new bracket can take their place.
+func (c Core) cancelLegs(ctx context.Context, dbLegs []db.Order, symbol string) error {
+	for _, dbLeg := range dbLegs {
+		_, err := c.cancel(ctx, dbLeg, symbol)
+		switch {
+		case err == nil:
+		case errors.Is(err, broker.ErrUnknownOrder):
+			dbLeg.Status = broker.OrderStatusCanceled
+			if err := c.dbAgent.Update(ctx, dbLeg); err != nil {
+				return fmt.Errorf("update: %w", err)
+			}
+		default:
+			return fmt.Errorf("orderID[%s]: %w", dbLeg.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// checkQuery validates the filter and the field orders are sorted by.
+func checkQuery(filter QueryFilter, orderBy OrderBy) error {
+	if err := validate.Check(filter); err != nil {
+		return err
+	}
+	if err := validate.Check(orderBy); err != nil {
+		return err
+	}
+	if _, ok := db.OrderByFields[orderBy.Field]; orderBy.Field != "" && !ok {
+		names := make([]string, 0, len(db.OrderByFields))
+		for name := range db.OrderByFields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return validate.FieldErrors{{Field: "sort", Error: "sort must be one of " + strings.Join(names, " ")}}
+	}
+	if !filter.CreatedAfter.IsZero() && !filter.CreatedBefore.IsZero() && !filter.CreatedAfter.Before(filter.CreatedBefore) {
+		return validate.FieldErrors{{Field: "created_before", Error: "created_before must be after created_after"}}
+	}
+
+	return nil
+}
+
+// checkType validates the prices and time in force required by the type of
+// the order. The time in force defaults to GTC for the types that need one.
+func checkType(nOdr *NewOrder) error {
+	var fields validate.FieldErrors
+	required := func(field string) {
+		fields = append(fields, validate.FieldError{Field: field, Error: field + " is a required field"})
+	}
+	excluded := func(field string) {
+		fields = append(fields, validate.FieldError{Field: field, Error: field + " is not allowed for " + nOdr.Type + " orders"})
+	}
+
+	switch {
+	case nOdr.Quantity != 0 && nOdr.QuoteQuantity != 0:
+		fields = append(fields, validate.FieldError{Field: "quote_quantity", Error: "quote_quantity is not allowed with quantity"})
+	case nOdr.QuoteQuantity != 0 && nOdr.Type != broker.OrderTypeMarket:
+		excluded("quote_quantity")
+	}
+
+	switch nOdr.Type {
+	case broker.OrderTypeMarket:
+		if nOdr.Price != 0 {
+			excluded("price")
+		}
+		if nOdr.StopPrice != 0 {
+			excluded("stop_price")
+		}
+		if nOdr.TimeInForce != "" {
+			excluded("time_in_force")
+		}
+
+	case broker.OrderTypeLimitMaker:
+		if nOdr.Price == 0 {
+			required("price")
+		}
+		if nOdr.StopPrice != 0 {
+			excluded("stop_price")
+		}
+		if nOdr.TimeInForce != "" {
+			excluded("time_in_force")
+		}
+
+	case broker.OrderTypeLimit:
+		if nOdr.Price == 0 {
+			required("price")
+		}
+		if nOdr.StopPrice != 0 {
+			excluded("stop_price")
+		}
+
+	case broker.OrderTypeStopLossLimit, broker.OrderTypeTakeProfitLimit:
+		if nOdr.Price == 0 {
+			required("price")
+		}
+		if nOdr.StopPrice == 0 {
+			required("stop_price")
+		}
+	}
+
+	if len(fields) > 0 {
+		return fields
+	}
+
+	if nOdr.TimeInForce == "" && nOdr.Type != broker.OrderTypeMarket && nOdr.Type != broker.OrderTypeLimitMaker {
+		nOdr.TimeInForce = broker.TimeInForceGTC
+	}
+
+	return nil
+}
+
+// checkFilters validates the quantity and prices against the trading rules
+// of the symbol, so binance doesn't reject the order for them. MARKET orders
+// are checked against the close of the latest candle for the notional, the
+// ones placed for a quote quantity against that quantity. The notional of
+// MARKET orders isn't checked when the symbol has no candles yet.
+func checkFilters(nOdr *NewOrder, flt db.Filters) error {
+	market := nOdr.Type == broker.OrderTypeMarket
+	if nOdr.Round {
+		nOdr.Quantity = roundDown(nOdr.Quantity, flt.StepSize)
+		if market {
+			nOdr.Quantity = roundDown(nOdr.Quantity, flt.MarketStepSize)
+		}
+		nOdr.Price = roundDown(nOdr.Price, flt.TickSize)
+		nOdr.StopPrice = roundDown(nOdr.StopPrice, flt.TickSize)
+	}
+
+	var fields validate.FieldErrors
+	check := func(field string, val, min, max, step float64) bool {
+		var msg string
+		switch {
+		case min > 0 && val < min:
+			msg = field + " must be at least " + formatFloat(min)
+		case max > 0 && val > max:
+			msg = field + " must be at most " + formatFloat(max)
+		case step > 0 && !isMultiple(val, step):
+			msg = field + " must be a multiple of " + formatFloat(step)
+		default:
+			return true
+		}
+		fields = append(fields, validate.FieldError{Field: field, Error: msg})
+		return false
+	}
+
+	switch {
+	case nOdr.QuoteQuantity == 0 && nOdr.Quantity == 0:
+		// Only a quantity rounded down gets here, it was under the step size.
+		step := flt.StepSize
+		if market {
+			step = math.Max(step, flt.MarketStepSize)
+		}
+		fields = append(fields, validate.FieldError{Field: "quantity", Error: "quantity must be at least " + formatFloat(step)})
+	case nOdr.QuoteQuantity != 0:
+		if !flt.QuoteAllowed {
+			fields = append(fields, validate.FieldError{Field: "quote_quantity", Error: "quote_quantity is not allowed for " + nOdr.Symbol})
+		}
+	case check("quantity", nOdr.Quantity, flt.MinQty, flt.MaxQty, flt.StepSize) && market:
+		check("quantity", nOdr.Quantity, flt.MarketMinQty, flt.MarketMaxQty, flt.MarketStepSize)
+	}
+	if nOdr.Price != 0 {
+		check("price", nOdr.Price, flt.MinPrice, flt.MaxPrice, flt.TickSize)
+	}
+	if nOdr.StopPrice != 0 {
+		check("stop_price", nOdr.StopPrice, flt.MinPrice, flt.MaxPrice, flt.TickSize)
+	}
+
+	// The notional filters of MARKET orders only apply when the symbol says
+	// so, and can't be checked without a last price to estimate it.
+	notional, minNotional, maxNotional := nOdr.Price*nOdr.Quantity, flt.MinNotional, flt.MaxNotional
+	field, msg := "quantity", "quantity times price must be "
+	if market {
+		notional = flt.LastPrice * nOdr.Quantity
+		if !flt.ApplyMinToMarket {
+			minNotional = 0
+		}
+		if !flt.ApplyMaxToMarket {
+			maxNotional = 0
+		}
+	}
+	if nOdr.QuoteQuantity != 0 {
+		notional, field, msg = nOdr.QuoteQuantity, "quote_quantity", "quote_quantity must be "
+	}
+	switch {
+	case len(fields) > 0 || notional == 0:
+	case minNotional > 0 && notional < minNotional:
+		fields = append(fields, validate.FieldError{Field: field, Error: msg + "at least " + formatFloat(minNotional)})
+	case maxNotional > 0 && notional > maxNotional:
+		fields = append(fields, validate.FieldError{Field: field, Error: msg + "at most " + formatFloat(maxNotional)})
+	}
+
+	if len(fields) > 0 {
+		return fields
+	}
+
+	return nil
+}
+
+// CheckBracket validates the take profit and stop loss of a position against
+// the trading rules of the symbol and its last price. The legs of the
+// bracket are on the side opposite to the position.
+func (c Core) CheckBracket(ctx context.Context, nBrk NewBracket) error {
+	flt, err := c.dbAgent.QueryFilters(ctx, nBrk.SymbolID)
+	if err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return validate.FieldErrors{{Field: "symbol_id", Error: "symbol_id is not a known symbol"}}
+		}
+		return fmt.Errorf("query filters: %w", err)
+	}
+
+	brk := db.Bracket{
+		Side:       nBrk.Side,
+		TakeProfit: nBrk.TakeProfit,
+		StopLoss:   nBrk.StopLoss,
+		StopLimit:  nBrk.StopLimit,
+	}
+
+	return checkBracket(brk, flt)
+}
+
+// checkBracket validates the prices of the bracket against the price filter
+// of the symbol. Binance accepts an OCO order list for a SELL only with the
+// take profit above the last price and the stop loss below it, the other way
+// around for a BUY, and a stop limit that doesn't cross the stop loss.
+func checkBracket(brk db.Bracket, flt db.Filters) error {
+	var fields validate.FieldErrors
+	check := func(field string, val float64) {
+		var msg string
+		switch {
+		case flt.MinPrice > 0 && val < flt.MinPrice:
+			msg = field + " must be at least " + formatFloat(flt.MinPrice)
+		case flt.MaxPrice > 0 && val > flt.MaxPrice:
+			msg = field + " must be at most " + formatFloat(flt.MaxPrice)
+		case flt.TickSize > 0 && !isMultiple(val, flt.TickSize):
+			msg = field + " must be a multiple of " + formatFloat(flt.TickSize)
+		default:
+			return
+		}
+		fields = append(fields, validate.FieldError{Field: field, Error: msg})
+	}
+
+	check("take_profit", brk.TakeProfit)
+	check("stop_loss", brk.StopLoss)
+	if brk.StopLimit != 0 {
+		check("stop_limit", brk.StopLimit)
+	}
+	if len(fields) > 0 {
+		return fields
+	}
+
+	last := flt.LastPrice
+	switch brk.Side {
+	case broker.OrderSideBuy:
+		switch {
+		case brk.StopLimit != 0 && brk.StopLimit > brk.StopLoss:
+			fields = append(fields, validate.FieldError{Field: "stop_limit", Error: "stop_limit must be at most stop_loss for BUY positions"})
+		case last > 0 && brk.TakeProfit <= last:
+			fields = append(fields, validate.FieldError{Field: "take_profit", Error: "take_profit must be above the last price " + formatFloat(last)})
+		case last > 0 && brk.StopLoss >= last:
+			fields = append(fields, validate.FieldError{Field: "stop_loss", Error: "stop_loss must be below the last price " + formatFloat(last)})
+		}
+	case broker.OrderSideSell:
+		switch {
+		case brk.StopLimit != 0 && brk.StopLimit < brk.StopLoss:
+			fields = append(fields, validate.FieldError{Field: "stop_limit", Error: "stop_limit must be at least stop_loss for SELL positions"})
+		case last > 0 && brk.TakeProfit >= last:
+			fields = append(fields, validate.FieldError{Field: "take_profit", Error: "take_profit must be below the last price " + formatFloat(last)})
+		case last > 0 && brk.StopLoss <= last:
+			fields = append(fields, validate.FieldError{Field: "stop_loss", Error: "stop_loss must be above the last price " + formatFloat(last)})
+		}
+	}
+	if len(fields) > 0 {
+		return fields
+	}
+
+	return nil
+}
+
+// roundDown rounds the value down to a multiple of the step. A zero step
+// leaves the value as is.
+func roundDown(val float64, step float64) float64 {
+	if step <= 0 {
+		return val
+	}
+
+	// Binance steps are powers of ten, working with integers of the smallest
+	// unit avoids the errors of floating point division.
+	unit := math.Pow10(decimals(step))
+	units := math.Floor(val*unit + 1e-6)
+	return (units - math.Mod(units, math.Round(step*unit))) / unit
+}
+
+// isMultiple reports whether the value is a multiple of the step.
+func isMultiple(val float64, step float64) bool {
+	unit := math.Pow10(decimals(step))
+	units := val * unit
+	if math.Abs(units-math.Round(units)) > 1e-6 {
+		return false
+	}
+	return math.Mod(math.Round(units), math.Round(step*unit)) == 0
+}
+
+// decimals returns the number of decimals of the value.
+func decimals(val float64) int {
+	s := formatFloat(val)
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return len(s) - i - 1
+	}
+	return 0
+}
+
+// formatFloat formats the value with the decimals it needs, without exponent.
+func formatFloat(val float64) string {
+	return strconv.FormatFloat(val, 'f', -1, 64)
+}
+
+// isFinal reports whether an order with the status can't change anymore.
+func isFinal(status string) bool {
+	switch status {
+	case broker.OrderStatusFilled, broker.OrderStatusCanceled, broker.OrderStatusExpired, broker.OrderStatusRejected:
+		return true
+	}
+	return false
+}
@@ -2,13 +2,19 @@ package order
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/lgarciaaco/machina-api/business/broker"
 	"github.com/lgarciaaco/machina-api/business/broker/encode"
+	"github.com/lgarciaaco/machina-api/business/core/order/db"
+	"github.com/lgarciaaco/machina-api/business/sys/validate"
 
 	"github.com/lgarciaaco/machina-api/foundation/docker"
 
@@ -52,10 +58,11 @@ func TestOrder(t *testing.T) {
 
 	dbschema.Seed(ctx, db)
 
-	core := NewCore(log, db, broker.TestBinance{
-		APIKey: key,
-		Signer: &encode.Hmac{Key: []byte(secret)},
-	})
+	core := NewCore(log, db, broker.NewBinance(broker.Config{
+		APIKey:      key,
+		Signer:      &encode.Hmac{Key: []byte(secret)},
+		Environment: broker.EnvTestNet,
+	}))
 
 	t.Log("Given the need to work with Order records.")
 	{
@@ -92,6 +99,576 @@ func TestOrder(t *testing.T) {
 	}
 }
 
+func TestOrderPaper(t *testing.T) {
+	log, db, teardown := dbtest.NewUnit(t, c, "testodrpaper")
+	t.Cleanup(teardown)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dbschema.Seed(ctx, db)
+
+	fee, slippage := 0.001, 0.01
+	paper := broker.NewPaper(broker.PaperConfig{
+		Log:      log,
+		DB:       db,
+		Fee:      fee,
+		Slippage: slippage,
+		Balances: map[string]float64{"ETH": 1, "USDT": 100},
+	})
+	core := NewCore(log, db, paper)
+
+	t.Log("Given the need to trade without an exchange.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen selling at the last synced candle.", testID)
+		{
+			ctx := context.Background()
+
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			nOdr := NewOrder{
+				SymbolID:   "125240c0-7f7f-4d0f-b30d-939fd93cf027",
+				Symbol:     "ETHUSDT",
+				PositionID: "891c178b-3dbf-4f99-a8f0-99a86cb578b7",
+				Quantity:   1,
+				Side:       "SELL",
+			}
+			odr, err := core.Create(ctx, nOdr, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create order : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create order.", dbtest.Success, testID)
+
+			// The last seeded candle of ETHUSDT closes at 310.50.
+			if exp := 310.50 * (1 - slippage); odr.Price != exp || odr.Status != "FILLED" {
+				t.Fatalf("\t%s\tTest %d:\tShould fill at the last close with slippage, exp %v got %v %s.", dbtest.Failed, testID, exp, odr.Price, odr.Status)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fill at the last close with slippage.", dbtest.Success, testID)
+
+			acc, err := paper.Account(ctx)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to fetch the balances : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to fetch the balances.", dbtest.Success, testID)
+
+			exp := []broker.AccountBalance{
+				{Asset: "ETH", Free: 0},
+				{Asset: "USDT", Free: 100 + (odr.Price - odr.Price*fee)},
+			}
+			if diff := cmp.Diff(exp, acc.Balances); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould move the balances minus the fee. Diff:\n%s", dbtest.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould move the balances minus the fee.", dbtest.Success, testID)
+
+			if _, err := core.Create(ctx, nOdr, now); !errors.Is(err, broker.ErrInsufficientBalance) {
+				t.Fatalf("\t%s\tTest %d:\tShould not sell more than the balance : %v.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not sell more than the balance.", dbtest.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen buying for a quote quantity.", testID)
+		{
+			ctx := context.Background()
+
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			nOdr := NewOrder{
+				SymbolID:      "125240c0-7f7f-4d0f-b30d-939fd93cf027",
+				Symbol:        "ETHUSDT",
+				PositionID:    "891c178b-3dbf-4f99-a8f0-99a86cb578b7",
+				QuoteQuantity: 100,
+				Side:          "BUY",
+			}
+			odr, err := core.Create(ctx, nOdr, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create order : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create order.", dbtest.Success, testID)
+
+			exp := 100 / (310.50 * (1 + slippage))
+			if odr.QuoteQuantity != 100 || odr.CumulativeQuote != 100 || odr.ExecutedQuantity != exp || odr.Quantity != exp {
+				t.Fatalf("\t%s\tTest %d:\tShould record the executed and quote quantities : %+v.", dbtest.Failed, testID, odr)
+			}
+			t.Logf("\t%s\tTest %d:\tShould record the executed and quote quantities.", dbtest.Success, testID)
+
+			nOdr.Type, nOdr.Price = broker.OrderTypeLimit, 300
+			var fields validate.FieldErrors
+			if _, err := core.Create(ctx, nOdr, now); !errors.As(err, &fields) || fields[0].Field != "quote_quantity" {
+				t.Fatalf("\t%s\tTest %d:\tShould only allow a quote quantity on MARKET orders : %v.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only allow a quote quantity on MARKET orders.", dbtest.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen two users send the same idempotency key.", testID)
+		{
+			ctx := context.Background()
+
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			nOdr := NewOrder{
+				SymbolID:       "125240c0-7f7f-4d0f-b30d-939fd93cf027",
+				Symbol:         "ETHUSDT",
+				PositionID:     "891c178b-3dbf-4f99-a8f0-99a86cb578b7",
+				UserID:         "45b5fbd3-755f-4379-8f07-a58d4a30fa2f",
+				IdempotencyKey: "same-key",
+				QuoteQuantity:  20,
+				Side:           "BUY",
+			}
+			odr1, err := core.Create(ctx, nOdr, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create order : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create order.", dbtest.Success, testID)
+
+			retry, err := core.Create(ctx, nOdr, now)
+			if err != nil || retry.ID != odr1.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould get the same order on a retry : %v %s.", dbtest.Failed, testID, err, retry.ID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the same order on a retry.", dbtest.Success, testID)
+
+			const q = `
+			INSERT INTO positions
+				(position_id, symbol_id, user_id, creation_time, side, status)
+			VALUES
+				($1, '125240c0-7f7f-4d0f-b30d-939fd93cf027', '5cf37266-3473-4006-984f-9325122678b7', NOW(), 'BUY', 'OPEN')`
+			nOdr.PositionID = "e0c5b3f4-8f53-4d9a-a8a4-3b0c2b8f0d6e"
+			if _, err := db.ExecContext(ctx, q, nOdr.PositionID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a position for another user : %s.", dbtest.Failed, testID, err)
+			}
+
+			nOdr.UserID = "5cf37266-3473-4006-984f-9325122678b7"
+			odr2, err := core.Create(ctx, nOdr, now)
+			if err != nil || odr2.ID == odr1.ID || odr2.ClientOrderID == odr1.ClientOrderID {
+				t.Fatalf("\t%s\tTest %d:\tShould place another order for another user : %v %s.", dbtest.Failed, testID, err, odr2.ID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould place another order for another user.", dbtest.Success, testID)
+		}
+	}
+}
+
+func TestOrderFilters(t *testing.T) {
+	log, sqlxDB, teardown := dbtest.NewUnit(t, c, "testodrfilters")
+	t.Cleanup(teardown)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dbschema.Seed(ctx, sqlxDB)
+
+	const q = `
+	UPDATE symbols SET
+		min_price = 0.01, max_price = 10000, tick_size = 0.01,
+		min_qty = 0.001, max_qty = 100, step_size = 0.001, min_notional = 10
+	WHERE
+		symbol = 'ETHUSDT'`
+	if _, err := sqlxDB.ExecContext(ctx, q); err != nil {
+		t.Fatalf("Should be able to set the filters of ETHUSDT : %s.", err)
+	}
+
+	paper := broker.NewPaper(broker.PaperConfig{
+		Log:      log,
+		DB:       sqlxDB,
+		Balances: map[string]float64{"ETH": 1, "USDT": 100},
+	})
+	core := NewCore(log, sqlxDB, paper)
+
+	t.Log("Given the need to validate orders against the filters of the symbol.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the order breaks the filters.", testID)
+		{
+			ctx := context.Background()
+
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			nOdr := NewOrder{
+				SymbolID:   "125240c0-7f7f-4d0f-b30d-939fd93cf027",
+				Symbol:     "ETHUSDT",
+				PositionID: "891c178b-3dbf-4f99-a8f0-99a86cb578b7",
+				Quantity:   0.12345,
+				Side:       "SELL",
+			}
+			_, err := core.Create(ctx, nOdr, now)
+			var fields validate.FieldErrors
+			if !errors.As(err, &fields) || len(fields) != 1 || fields[0].Field != "quantity" {
+				t.Fatalf("\t%s\tTest %d:\tShould reject a quantity off the step size : %v.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject a quantity off the step size.", dbtest.Success, testID)
+
+			// The last seeded candle of ETHUSDT closes at 310.50.
+			nOdr.Quantity = 0.01
+			if _, err := core.Create(ctx, nOdr, now); !errors.As(err, &fields) || fields[0].Field != "quantity" {
+				t.Fatalf("\t%s\tTest %d:\tShould reject an order under the min notional : %v.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject an order under the min notional.", dbtest.Success, testID)
+
+			odrs, err := core.dbAgent.QueryByPosition(ctx, nOdr.PositionID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query the orders : %s.", dbtest.Failed, testID, err)
+			}
+			for _, odr := range odrs {
+				if odr.Status == StatusPending {
+					t.Fatalf("\t%s\tTest %d:\tShould not store rejected orders : %+v.", dbtest.Failed, testID, odr)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould not store rejected orders.", dbtest.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the order asks to be rounded.", testID)
+		{
+			ctx := context.Background()
+
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			nOdr := NewOrder{
+				SymbolID:   "125240c0-7f7f-4d0f-b30d-939fd93cf027",
+				Symbol:     "ETHUSDT",
+				PositionID: "891c178b-3dbf-4f99-a8f0-99a86cb578b7",
+				Quantity:   0.12345,
+				Side:       "SELL",
+				Round:      true,
+			}
+			odr, err := core.Create(ctx, nOdr, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create order : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create order.", dbtest.Success, testID)
+
+			if odr.Quantity != 0.123 || odr.ExecutedQuantity != 0.123 {
+				t.Fatalf("\t%s\tTest %d:\tShould round the quantity down to the step size : %v.", dbtest.Failed, testID, odr.Quantity)
+			}
+			t.Logf("\t%s\tTest %d:\tShould round the quantity down to the step size.", dbtest.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the bracket of a position breaks the filters.", testID)
+		{
+			ctx := context.Background()
+
+			nBrk := NewBracket{
+				SymbolID:   "125240c0-7f7f-4d0f-b30d-939fd93cf027",
+				Side:       "BUY",
+				TakeProfit: 400.005,
+				StopLoss:   300,
+			}
+			var fields validate.FieldErrors
+			if err := core.CheckBracket(ctx, nBrk); !errors.As(err, &fields) || fields[0].Field != "take_profit" {
+				t.Fatalf("\t%s\tTest %d:\tShould reject a take profit off the tick size : %v.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject a take profit off the tick size.", dbtest.Success, testID)
+
+			nBrk.TakeProfit = 400
+			nBrk.StopLimit = 301
+			if err := core.CheckBracket(ctx, nBrk); !errors.As(err, &fields) || fields[0].Field != "stop_limit" {
+				t.Fatalf("\t%s\tTest %d:\tShould reject a stop limit above the stop loss of a BUY position : %v.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject a stop limit above the stop loss of a BUY position.", dbtest.Success, testID)
+
+			nBrk.StopLimit = 299
+			if err := core.CheckBracket(ctx, nBrk); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould accept a bracket around the last price : %v.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept a bracket around the last price.", dbtest.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a MARKET order is checked against the notional filters.", testID)
+		{
+			flt := db.Filters{MinNotional: 10, MaxNotional: 1000, ApplyMinToMarket: true}
+			nOdr := NewOrder{Symbol: "ETHUSDT", Type: broker.OrderTypeMarket, Quantity: 0.01}
+			if err := checkFilters(&nOdr, flt); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould skip the notional without a last price : %v.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould skip the notional without a last price.", dbtest.Success, testID)
+
+			flt.LastPrice = 310.50
+			var fields validate.FieldErrors
+			if err := checkFilters(&nOdr, flt); !errors.As(err, &fields) || fields[0].Field != "quantity" {
+				t.Fatalf("\t%s\tTest %d:\tShould reject an order under the min notional : %v.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject an order under the min notional.", dbtest.Success, testID)
+
+			nOdr.Quantity = 10
+			if err := checkFilters(&nOdr, flt); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould skip the max notional not applied to MARKET orders : %v.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould skip the max notional not applied to MARKET orders.", dbtest.Success, testID)
+
+			nOdr.Type, nOdr.Price = broker.OrderTypeLimit, 310.50
+			if err := checkFilters(&nOdr, flt); !errors.As(err, &fields) || fields[0].Field != "quantity" {
+				t.Fatalf("\t%s\tTest %d:\tShould reject a LIMIT order over the max notional : %v.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject a LIMIT order over the max notional.", dbtest.Success, testID)
+		}
+	}
+}
+
+func TestOrderDryRun(t *testing.T) {
+	log, sqlxDB, teardown := dbtest.NewUnit(t, c, "testodrdryrun")
+	t.Cleanup(teardown)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dbschema.Seed(ctx, sqlxDB)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/time") {
+			fmt.Fprintf(w, `{"serverTime":%d}`, time.Now().UnixMilli())
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	core := NewCore(log, sqlxDB, broker.NewBinance(broker.Config{
+		APIKey:      "key",
+		Signer:      &encode.Hmac{Key: []byte("secret")},
+		Environment: broker.EnvDryRun,
+		BaseURL:     srv.URL,
+	}))
+
+	t.Log("Given the need to place orders in dry-run mode.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen binance validates the order without placing it.", testID)
+		{
+			ctx := context.Background()
+
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			nOdr := NewOrder{
+				SymbolID:   "125240c0-7f7f-4d0f-b30d-939fd93cf027",
+				Symbol:     "ETHUSDT",
+				PositionID: "891c178b-3dbf-4f99-a8f0-99a86cb578b7",
+				Quantity:   1,
+				Side:       "SELL",
+			}
+			odr, err := core.Create(ctx, nOdr, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create order : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create order.", dbtest.Success, testID)
+
+			sOdr, err := core.QueryByID(ctx, odr.ID)
+			if err != nil || sOdr.Status != "NEW" || sOdr.Quantity != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould store the order NEW : %v %+v.", dbtest.Failed, testID, err, sOdr)
+			}
+			t.Logf("\t%s\tTest %d:\tShould store the order NEW.", dbtest.Success, testID)
+		}
+	}
+}
+
+func TestOrderBracket(t *testing.T) {
+	log, sqlxDB, teardown := dbtest.NewUnit(t, c, "testodrbracket")
+	t.Cleanup(teardown)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dbschema.Seed(ctx, sqlxDB)
+
+	const posID = "b2b4fc0b-3a8e-4d24-9b44-0c8d2c2d1c2f"
+	const q = `
+	INSERT INTO positions
+		(position_id, symbol_id, user_id, creation_time, side, status, take_profit, stop_loss)
+	VALUES
+		($1, '125240c0-7f7f-4d0f-b30d-939fd93cf027', '45b5fbd3-755f-4379-8f07-a58d4a30fa2f', NOW(), 'BUY', 'OPEN', 400, 300)`
+	if _, err := sqlxDB.ExecContext(ctx, q, posID); err != nil {
+		t.Fatalf("Should be able to create a position with a bracket : %s.", err)
+	}
+
+	paper := broker.NewPaper(broker.PaperConfig{
+		Log:      log,
+		DB:       sqlxDB,
+		Balances: map[string]float64{"USDT": 1000},
+	})
+	core := NewCore(log, sqlxDB, paper)
+
+	t.Log("Given the need to protect positions scaling in with a bracket.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the take profit placed for the first entry fills.", testID)
+		{
+			ctx := context.Background()
+
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			nOdr := NewOrder{
+				SymbolID:   "125240c0-7f7f-4d0f-b30d-939fd93cf027",
+				Symbol:     "ETHUSDT",
+				PositionID: posID,
+				Quantity:   1,
+				Side:       "BUY",
+			}
+			if _, err := core.Create(ctx, nOdr, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create the first entry : %s.", dbtest.Failed, testID, err)
+			}
+
+			// The paper broker doesn't take OCO order lists, the take profit
+			// stands for the one binance placed for the first entry.
+			tp := db.Order{
+				ID:            validate.GenerateID(),
+				SymbolID:      nOdr.SymbolID,
+				PositionID:    posID,
+				CreationTime:  now,
+				Quantity:      1,
+				Status:        "NEW",
+				Type:          broker.OrderTypeLimitMaker,
+				Side:          "SELL",
+				LimitPrice:    400,
+				BrokerOrderID: 42,
+				Leg:           LegTakeProfit,
+			}
+			tp.ClientOrderID = tp.ID
+			if err := core.dbAgent.Create(ctx, tp); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to store the take profit : %s.", dbtest.Failed, testID, err)
+			}
+
+			if _, err := core.Create(ctx, nOdr, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create the second entry : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to enter the position twice.", dbtest.Success, testID)
+
+			legs, err := core.dbAgent.QueryLegs(ctx, posID)
+			if err != nil || len(legs) != 1 || legs[0].Status != "CANCELED" {
+				t.Fatalf("\t%s\tTest %d:\tShould cancel the take profit sized for the first entry : %v %+v.", dbtest.Failed, testID, err, legs)
+			}
+			t.Logf("\t%s\tTest %d:\tShould cancel the take profit sized for the first entry.", dbtest.Success, testID)
+
+			// Binance reports the fill if the take profit filled before it
+			// was canceled.
+			er := broker.ExecutionReport{
+				Symbol:             "ETHUSDT",
+				OrderID:            tp.BrokerOrderID,
+				ClientOrderID:      tp.ClientOrderID,
+				Side:               "SELL",
+				Type:               broker.OrderTypeLimitMaker,
+				ExecutionType:      broker.ExecutionTypeTrade,
+				Status:             "FILLED",
+				LastQuantity:       1,
+				LastPrice:          400,
+				CumulativeQuantity: 1,
+				CumulativeQuote:    400,
+				TradeID:            7,
+				TransactionTime:    now,
+			}
+			if _, err := core.ApplyExecution(ctx, er); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to apply the take profit fill : %s.", dbtest.Failed, testID, err)
+			}
+
+			brk, err := core.dbAgent.QueryBracket(ctx, posID)
+			if err != nil || brk.Status != "OPEN" {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the position open : %v %+v.", dbtest.Failed, testID, err, brk)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the position open.", dbtest.Success, testID)
+
+			odrs, err := core.dbAgent.QueryByPosition(ctx, posID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query the orders : %s.", dbtest.Failed, testID, err)
+			}
+			var net float64
+			for _, odr := range odrs {
+				if odr.Side == "BUY" {
+					net += odr.ExecutedQuantity
+				} else {
+					net -= odr.ExecutedQuantity
+				}
+			}
+			if net != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould still hold the second entry, got %v.", dbtest.Failed, testID, net)
+			}
+			t.Logf("\t%s\tTest %d:\tShould still hold the second entry.", dbtest.Success, testID)
+		}
+	}
+}
+
+func TestOrderReconcile(t *testing.T) {
+	log, sqlxDB, teardown := dbtest.NewUnit(t, c, "testodrreconcile")
+	t.Cleanup(teardown)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dbschema.Seed(ctx, sqlxDB)
+
+	now := time.Now().UTC()
+	lost := dbOrder(now.Add(-time.Hour))
+	never := dbOrder(now.Add(-time.Hour))
+
+	allOrders := fmt.Sprintf(`[
+		{"symbol":"BNBUSDT","orderId":71,"clientOrderId":%q,"price":"0","origQty":"0.1","executedQty":"0.1","cummulativeQuoteQty":"38.5","status":"FILLED","timeInForce":"GTC","type":"MARKET","side":"SELL","time":%d},
+		{"symbol":"BNBUSDT","orderId":72,"clientOrderId":"web_4f2ac0d9","price":"300","origQty":"1","executedQty":"0","cummulativeQuoteQty":"0","status":"NEW","timeInForce":"GTC","type":"LIMIT","side":"BUY","time":%d}
+	]`, lost.ClientOrderID, now.UnixMilli(), now.UnixMilli())
+
+	exchange := broker.NewClient(broker.NewReplayer(broker.Cassette{
+		Interactions: []broker.Interaction{
+			{Method: "GET", Endpoint: "openOrders", Params: []string{"symbol", "BNBUSDT"}, Response: []byte(`[]`)},
+			{Method: "GET", Endpoint: "allOrders", Params: []string{"symbol", "BNBUSDT", "startTime", "0", "limit", "1000"}, Response: []byte(allOrders)},
+		},
+	}))
+	core := NewCore(log, sqlxDB, exchange)
+
+	t.Log("Given the need to reconcile orders with the exchange.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen orders were left pending.", testID)
+		{
+			ctx := context.Background()
+
+			for _, dbOdr := range []db.Order{lost, never} {
+				if err := core.dbAgent.Create(ctx, dbOdr); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to store the pending order : %s.", dbtest.Failed, testID, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to store the pending orders.", dbtest.Success, testID)
+
+			rcn, err := core.Reconcile(ctx, "BNBUSDT", now.Add(-24*time.Hour), now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reconcile : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to reconcile.", dbtest.Success, testID)
+
+			exp := Reconciliation{Symbol: "BNBUSDT", Completed: 1, Rejected: 1, Unknown: 1}
+			if diff := cmp.Diff(exp, rcn); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould complete, reject and flag orders. Diff:\n%s", dbtest.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould complete, reject and flag orders.", dbtest.Success, testID)
+
+			odr, err := core.QueryByID(ctx, lost.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve order by ID: %s.", dbtest.Failed, testID, err)
+			}
+			if odr.Status != "FILLED" || odr.BrokerOrderID != 71 || odr.ExecutedQuantity != 0.1 {
+				t.Fatalf("\t%s\tTest %d:\tShould complete the order binance got: %+v.", dbtest.Failed, testID, odr)
+			}
+			t.Logf("\t%s\tTest %d:\tShould complete the order binance got.", dbtest.Success, testID)
+
+			odr, err = core.QueryByID(ctx, never.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve order by ID: %s.", dbtest.Failed, testID, err)
+			}
+			if odr.Status != "REJECTED" {
+				t.Fatalf("\t%s\tTest %d:\tShould reject the order binance never got: %+v.", dbtest.Failed, testID, odr)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject the order binance never got.", dbtest.Success, testID)
+		}
+	}
+}
+
+// dbOrder returns a pending order on BNBUSDT as stored before it is sent.
+func dbOrder(now time.Time) db.Order {
+	id := validate.GenerateID()
+	return db.Order{
+		ID:            id,
+		SymbolID:      "97514fb4-4ff5-4561-91d1-c8da711d8f32",
+		PositionID:    "75fabb5c-6c22-40c6-9236-0f8017a8e12d",
+		CreationTime:  now,
+		Quantity:      0.1,
+		Status:        StatusPending,
+		Type:          "MARKET",
+		Side:          "SELL",
+		ClientOrderID: id,
+	}
+}
+
 func TestPagingOrders(t *testing.T) {
 	key, present := os.LookupEnv("MACHINA_BROKER_BINANCE_KEY")
 	if !present {
@@ -111,10 +688,11 @@ func TestPagingOrders(t *testing.T) {
 
 	dbschema.Seed(ctx, db)
 
-	core := NewCore(log, db, broker.TestBinance{
-		APIKey: key,
-		Signer: &encode.Hmac{Key: []byte(secret)},
-	})
+	core := NewCore(log, db, broker.NewBinance(broker.Config{
+		APIKey:      key,
+		Signer:      &encode.Hmac{Key: []byte(secret)},
+		Environment: broker.EnvTestNet,
+	}))
 
 	t.Log("Given the need to page through Positions records.")
 	{
@@ -123,7 +701,7 @@ func TestPagingOrders(t *testing.T) {
 		{
 			ctx := context.Background()
 
-			odr1, err := core.Query(ctx, 1, 1)
+			odr1, err := core.Query(ctx, QueryFilter{}, OrderBy{}, 1, 1)
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve orders for page 1 : %s.", dbtest.Failed, testID, err)
 			}
@@ -134,7 +712,7 @@ func TestPagingOrders(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould have a single order.", dbtest.Success, testID)
 
-			odr2, err := core.QueryByUser(ctx, 2, 1, "45b5fbd3-755f-4379-8f07-a58d4a30fa2f")
+			odr2, err := core.QueryByUser(ctx, QueryFilter{}, OrderBy{}, 2, 1, "45b5fbd3-755f-4379-8f07-a58d4a30fa2f")
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve orders for page 2 : %s.", dbtest.Failed, testID, err)
 			}
@@ -2,11 +2,15 @@
 package db
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/lgarciaaco/machina-api/business/sys/database"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
@@ -49,9 +53,9 @@ func (s Agent) Tran(tx sqlx.ExtContext) Agent {
 func (s Agent) Create(ctx context.Context, pos Position) error {
 	const q = `
 	INSERT INTO positions
-		(position_id, symbol_id, user_id, creation_time, side, status)
+		(position_id, symbol_id, user_id, creation_time, side, status, idempotency_key, take_profit, stop_loss, stop_limit)
 	VALUES
-		(:position_id, :symbol_id, :user_id, :creation_time, :side, :status)`
+		(:position_id, :symbol_id, :user_id, :creation_time, :side, :status, :idempotency_key, :take_profit, :stop_loss, :stop_limit)`
 
 	if err := database.NamedExecContext(ctx, s.log, s.db, q, pos); err != nil {
 		return fmt.Errorf("inserting position: %w", err)
@@ -60,14 +64,12 @@ func (s Agent) Create(ctx context.Context, pos Position) error {
 	return nil
 }
 
-// Query retrieves a list of existing positions from the database.
-func (s Agent) Query(ctx context.Context, pageNumber int, rowsPerPage int) ([]Position, error) {
-	data := struct {
-		Offset      int `db:"offset"`
-		RowsPerPage int `db:"rows_per_page"`
-	}{
-		Offset:      (pageNumber - 1) * rowsPerPage,
-		RowsPerPage: rowsPerPage,
+// Query retrieves a page of the positions that match the filter, sorted by
+// the given field.
+func (s Agent) Query(ctx context.Context, filter QueryFilter, orderBy OrderBy, pageNumber int, rowsPerPage int) ([]Position, error) {
+	data := map[string]interface{}{
+		"offset":        (pageNumber - 1) * rowsPerPage,
+		"rows_per_page": rowsPerPage,
 	}
 
 	const q = `
@@ -83,31 +85,33 @@ func (s Agent) Query(ctx context.Context, pageNumber int, rowsPerPage int) ([]Po
 	LEFT JOIN
 		symbols AS s ON p.symbol_id = s.symbol_id
 	LEFT JOIN
-		orders AS o ON p.position_id = o.position_id
-	GROUP BY
-		p.position_id, u.name, s.symbol
-	ORDER BY
-		creation_time DESC
-	OFFSET :offset ROWS FETCH NEXT :rows_per_page ROWS ONLY`
+		orders AS o ON p.position_id = o.position_id`
+
+	buf := bytes.NewBufferString(q)
+	applyFilter(filter, data, buf)
+	buf.WriteString("\n\tGROUP BY\n\t\tp.position_id, u.name, s.symbol")
+
+	by, err := orderByClause(orderBy)
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString(by)
+	buf.WriteString("\n\tOFFSET :offset ROWS FETCH NEXT :rows_per_page ROWS ONLY")
 
 	var poss []Position
-	if err := database.NamedQuerySlice(ctx, s.log, s.db, q, data, &poss); err != nil {
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, buf.String(), data, &poss); err != nil {
 		return nil, fmt.Errorf("selecting positions: %w", err)
 	}
 
 	return poss, nil
 }
 
-// QueryByUser gets the specified candles from the database.
-func (s Agent) QueryByUser(ctx context.Context, pageNumber int, rowsPerPage int, usrID string) ([]Position, error) {
+// QueryByID gets the specified position from the database.
+func (s Agent) QueryByID(ctx context.Context, posID string) (Position, error) {
 	data := struct {
-		UserID      string `db:"user_id"`
-		Offset      int    `db:"offset"`
-		RowsPerPage int    `db:"rows_per_page"`
+		PositionID string `db:"position_id"`
 	}{
-		UserID:      usrID,
-		Offset:      (pageNumber - 1) * rowsPerPage,
-		RowsPerPage: rowsPerPage,
+		PositionID: posID,
 	}
 
 	const q = `
@@ -125,27 +129,27 @@ func (s Agent) QueryByUser(ctx context.Context, pageNumber int, rowsPerPage int,
 	LEFT JOIN
 		orders AS o ON p.position_id = o.position_id
 	WHERE 
-		p.user_id = :user_id
+		p.position_id = :position_id
 	GROUP BY
-		p.position_id, u.name, s.symbol
-	ORDER BY
-		p.creation_time DESC
-	OFFSET :offset ROWS FETCH NEXT :rows_per_page ROWS ONLY`
+		p.position_id, u.name, s.symbol`
 
-	var poss []Position
-	if err := database.NamedQuerySlice(ctx, s.log, s.db, q, data, &poss); err != nil {
-		return nil, fmt.Errorf("selecting positions [%q]: %w", usrID, err)
+	var pos Position
+	if err := database.NamedQueryStruct(ctx, s.log, s.db, q, data, &pos); err != nil {
+		return Position{}, fmt.Errorf("selecting posID[%q]: %w", posID, err)
 	}
 
-	return poss, nil
+	return pos, nil
 }
 
-// QueryByID gets the specified position from the database.
-func (s Agent) QueryByID(ctx context.Context, posID string) (Position, error) {
+// QueryByIdempotencyKey gets the position a user created with the
+// idempotency key.
+func (s Agent) QueryByIdempotencyKey(ctx context.Context, usrID string, key string) (Position, error) {
 	data := struct {
-		PositionID string `db:"position_id"`
+		UserID         string `db:"user_id"`
+		IdempotencyKey string `db:"idempotency_key"`
 	}{
-		PositionID: posID,
+		UserID:         usrID,
+		IdempotencyKey: key,
 	}
 
 	const q = `
@@ -162,19 +166,135 @@ func (s Agent) QueryByID(ctx context.Context, posID string) (Position, error) {
 		symbols AS s ON p.symbol_id = s.symbol_id
 	LEFT JOIN
 		orders AS o ON p.position_id = o.position_id
-	WHERE 
-		p.position_id = :position_id
+	WHERE
+		p.user_id = :user_id AND p.idempotency_key = :idempotency_key
 	GROUP BY
 		p.position_id, u.name, s.symbol`
 
 	var pos Position
 	if err := database.NamedQueryStruct(ctx, s.log, s.db, q, data, &pos); err != nil {
-		return Position{}, fmt.Errorf("selecting posID[%q]: %w", posID, err)
+		return Position{}, fmt.Errorf("selecting userID[%q] idempotencyKey[%q]: %w", usrID, key, err)
 	}
 
 	return pos, nil
 }
 
+// QueryTrailing retrieves the open positions with a trailing stop.
+func (s Agent) QueryTrailing(ctx context.Context) ([]Position, error) {
+	const q = `
+	SELECT
+		p.*,
+		u.name AS user,
+		s.symbol AS symbol,
+		json_agg(o.*) AS orders
+	FROM
+		positions AS p
+	LEFT JOIN
+		users AS u ON p.user_id = u.user_id
+	LEFT JOIN
+		symbols AS s ON p.symbol_id = s.symbol_id
+	LEFT JOIN
+		orders AS o ON p.position_id = o.position_id
+	WHERE
+		UPPER(p.status) = 'OPEN' AND (p.trail_amount > 0 OR p.trail_percent > 0)
+	GROUP BY
+		p.position_id, u.name, s.symbol`
+
+	var poss []Position
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, q, struct{}{}, &poss); err != nil {
+		return nil, fmt.Errorf("selecting trailing positions: %w", err)
+	}
+
+	return poss, nil
+}
+
+// QueryOcoAllowed tells whether binance accepts OCO order lists on the symbol.
+func (s Agent) QueryOcoAllowed(ctx context.Context, sblID string) (bool, error) {
+	data := struct {
+		SymbolID string `db:"symbol_id"`
+	}{
+		SymbolID: sblID,
+	}
+
+	const q = `
+	SELECT
+		COALESCE(oco_allowed, false) AS oco_allowed
+	FROM
+		symbols
+	WHERE
+		symbol_id = :symbol_id`
+
+	var sbl struct {
+		OcoAllowed bool `db:"oco_allowed"`
+	}
+	if err := database.NamedQueryStruct(ctx, s.log, s.db, q, data, &sbl); err != nil {
+		return false, fmt.Errorf("selecting symbolID[%q]: %w", sblID, err)
+	}
+
+	return sbl.OcoAllowed, nil
+}
+
+// QueryFees retrieves the commissions charged for the orders of the
+// positions, summed by order and asset.
+func (s Agent) QueryFees(ctx context.Context, posIDs []string) ([]Fee, error) {
+	data := struct {
+		PositionIDs interface{} `db:"position_ids"`
+	}{
+		PositionIDs: pq.Array(posIDs),
+	}
+
+	const q = `
+	SELECT
+		f.order_id,
+		f.commission_asset,
+		SUM(f.commission) AS commission,
+		SUM(f.commission * f.price) AS commission_quote
+	FROM
+		order_fills AS f
+	JOIN
+		orders AS o ON o.order_id = f.order_id
+	WHERE
+		o.position_id = ANY(:position_ids)
+	GROUP BY
+		f.order_id, f.commission_asset`
+
+	var fees []Fee
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, q, data, &fees); err != nil {
+		return nil, fmt.Errorf("selecting fees: %w", err)
+	}
+
+	return fees, nil
+}
+
+// QueryMarkets retrieves the assets and the last price of the symbols.
+func (s Agent) QueryMarkets(ctx context.Context, sblIDs []string) ([]Market, error) {
+	data := struct {
+		SymbolIDs interface{} `db:"symbol_ids"`
+	}{
+		SymbolIDs: pq.Array(sblIDs),
+	}
+
+	const q = `
+	SELECT
+		s.symbol_id,
+		s.base_asset,
+		s.quote_asset,
+		COALESCE(c.close_price, 0) AS last_price
+	FROM
+		symbols AS s
+	LEFT JOIN LATERAL
+		(SELECT close_price FROM candles WHERE symbol_id = s.symbol_id ORDER BY close_time DESC LIMIT 1) AS c ON true
+	WHERE
+		s.symbol_id = ANY(:symbol_ids)`
+
+	var mkts []Market
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, q, data, &mkts); err != nil {
+		return nil, fmt.Errorf("selecting markets: %w", err)
+	}
+
+	return mkts, nil
+}
+
 // Update modifies data about a Position. It will error if the specified ID is
 // invalid or does not reference an existing Position. When updating a position,
 // it only makes sense to change its status from open to closed.
@@ -193,3 +313,122 @@ func (s Agent) Update(ctx context.Context, pos Position) error {
 
 	return nil
 }
+
+// UpdateTrail sets the trailing stop of an open Position and the best price
+// seen. It fails with database.ErrDBNotFound when the position is not open.
+func (s Agent) UpdateTrail(ctx context.Context, pos Position) error {
+	const q = `
+	UPDATE
+		positions
+	SET
+		"trail_amount" = :trail_amount,
+		"trail_percent" = :trail_percent,
+		"trail_peak" = :trail_peak
+	WHERE
+		position_id = :position_id AND UPPER(status) = 'OPEN'
+	RETURNING
+		position_id`
+
+	var updated struct {
+		ID string `db:"position_id"`
+	}
+	if err := database.NamedQueryStruct(ctx, s.log, s.db, q, pos, &updated); err != nil {
+		return fmt.Errorf("updating trail positionID[%s]: %w", pos.ID, err)
+	}
+
+	return nil
+}
+
+// UpdateTrailPeak sets the best price seen by the trailing stop of a Position.
+// It reports whether the position is still open with a trailing stop, a stop
+// set or cleared in between is left as it is.
+func (s Agent) UpdateTrailPeak(ctx context.Context, pos Position) (bool, error) {
+	const q = `
+	UPDATE
+		positions
+	SET
+		"trail_peak" = :trail_peak
+	WHERE
+		position_id = :position_id AND
+		UPPER(status) = 'OPEN' AND
+		(trail_amount > 0 OR trail_percent > 0)
+	RETURNING
+		position_id`
+
+	var updated struct {
+		ID string `db:"position_id"`
+	}
+	if err := database.NamedQueryStruct(ctx, s.log, s.db, q, pos, &updated); err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("updating trail peak positionID[%s]: %w", pos.ID, err)
+	}
+
+	return true, nil
+}
+
+// applyFilter appends the conditions of the filter to the query. Values are
+// always passed as named parameters.
+func applyFilter(filter QueryFilter, data map[string]interface{}, buf *bytes.Buffer) {
+	var wc []string
+
+	if filter.UserID != "" {
+		data["user_id"] = filter.UserID
+		wc = append(wc, "p.user_id = :user_id")
+	}
+	if filter.Symbol != "" {
+		data["symbol"] = filter.Symbol
+		wc = append(wc, "s.symbol = :symbol")
+	}
+	if filter.Status != "" {
+		// Older positions were stored with a lowercase status.
+		data["status"] = filter.Status
+		wc = append(wc, "UPPER(p.status) = :status")
+	}
+	if filter.Side != "" {
+		data["side"] = filter.Side
+		wc = append(wc, "p.side = :side")
+	}
+	if filter.PositionID != "" {
+		data["position_id"] = filter.PositionID
+		wc = append(wc, "p.position_id = :position_id")
+	}
+	if !filter.CreatedAfter.IsZero() {
+		data["created_after"] = filter.CreatedAfter
+		wc = append(wc, "p.creation_time >= :created_after")
+	}
+	if !filter.CreatedBefore.IsZero() {
+		data["created_before"] = filter.CreatedBefore
+		wc = append(wc, "p.creation_time < :created_before")
+	}
+
+	if len(wc) > 0 {
+		buf.WriteString("\n\tWHERE\n\t\t")
+		buf.WriteString(strings.Join(wc, " AND "))
+	}
+}
+
+// orderByClause builds the ORDER BY clause of a query. Only the columns in
+// OrderByFields can be sorted by, the newest positions come first by default.
+func orderByClause(orderBy OrderBy) (string, error) {
+	if orderBy.Field == "" {
+		orderBy.Field = "creation_time"
+	}
+	col, ok := OrderByFields[orderBy.Field]
+	if !ok {
+		return "", fmt.Errorf("field %q can't be sorted by", orderBy.Field)
+	}
+
+	dir := "DESC"
+	switch strings.ToUpper(orderBy.Direction) {
+	case "", "DESC":
+	case "ASC":
+		dir = "ASC"
+	default:
+		return "", fmt.Errorf("direction %q is not asc or desc", orderBy.Direction)
+	}
+
+	// Ties keep a stable order between pages.
+	return "\n\tORDER BY\n\t\t" + col + " " + dir + ", p.position_id", nil
+}
@@ -7,13 +7,62 @@ import (
 // Position is the amount of a security, asset, or property that is owned (or sold short)
 // by some individual or other entity. A trader or investor takes a position when they make a purchase through
 type Position struct {
-	ID           string    `db:"position_id"`   // Position ID
-	SymbolID     string    `db:"symbol_id"`     // Symbol this position is trading on
-	UserID       string    `db:"user_id"`       // User who created this position
-	Side         string    `db:"side"`          // Position side: SELL / BUY
-	Status       string    `db:"status"`        // Status open / closed
-	CreationTime time.Time `db:"creation_time"` // CreationTime of the position
-	User         string    `db:"user"`
-	Symbol       string    `db:"symbol"`
-	Orders       string    `db:"orders"`
+	ID             string    `db:"position_id"`     // Position ID
+	SymbolID       string    `db:"symbol_id"`       // Symbol this position is trading on
+	UserID         string    `db:"user_id"`         // User who created this position
+	Side           string    `db:"side"`            // Position side: SELL / BUY
+	Status         string    `db:"status"`          // Status open / closed
+	CreationTime   time.Time `db:"creation_time"`   // CreationTime of the position
+	IdempotencyKey string    `db:"idempotency_key"` // Key of the request that created the position, empty when not set
+	TakeProfit     float64   `db:"take_profit"`     // Price the bracket takes profit at, zero without bracket
+	StopLoss       float64   `db:"stop_loss"`       // Price that triggers the stop loss of the bracket, zero without bracket
+	StopLimit      float64   `db:"stop_limit"`      // Limit price of the stop loss, the stop loss when zero
+	TrailAmount    float64   `db:"trail_amount"`    // Distance of the trailing stop to the best price, zero when trailing by percent
+	TrailPercent   float64   `db:"trail_percent"`   // Distance of the trailing stop as a percent of the best price
+	TrailPeak      float64   `db:"trail_peak"`      // Best price seen since the trail was set, zero until evaluated
+	User           string    `db:"user"`
+	Symbol         string    `db:"symbol"`
+	Orders         string    `db:"orders"`
+}
+
+// QueryFilter defines the conditions the positions of a query match. Zero
+// values are conditions not applied.
+type QueryFilter struct {
+	UserID        string
+	Symbol        string
+	Status        string
+	Side          string
+	PositionID    string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+// OrderBy defines the field and direction positions are sorted by.
+type OrderBy struct {
+	Field     string
+	Direction string
+}
+
+// OrderByFields maps the fields positions can be sorted by to their column.
+var OrderByFields = map[string]string{
+	"creation_time": "p.creation_time",
+	"status":        "p.status",
+	"side":          "p.side",
+	"symbol":        "s.symbol",
+}
+
+// Fee defines the commissions charged for the fills of an order in one asset.
+type Fee struct {
+	OrderID         string  `db:"order_id"`         // Order the fills belong to
+	CommissionAsset string  `db:"commission_asset"` // Asset the commissions were charged in
+	Commission      float64 `db:"commission"`       // Sum of the commissions
+	CommissionQuote float64 `db:"commission_quote"` // Sum of the commissions times the fill price
+}
+
+// Market defines the assets of a symbol and the close of its last candle.
+type Market struct {
+	SymbolID   string  `db:"symbol_id"`   // Symbol ID
+	BaseAsset  string  `db:"base_asset"`  // Asset traded
+	QuoteAsset string  `db:"quote_asset"` // Asset prices are quoted in
+	LastPrice  float64 `db:"last_price"`  // Close of the last synced candle, zero without candles
 }
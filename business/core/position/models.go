@@ -3,9 +3,11 @@ package position
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/lgarciaaco/machina-api/business/broker"
 	"github.com/lgarciaaco/machina-api/business/core/position/db"
 )
 
@@ -15,31 +17,110 @@ type Position struct {
 	SymbolID     string    `json:"-"`             // SymbolID this position is trading on, used to preload Symbol
 	UserID       string    `json:"-"`             // UserID who created this position, used to preload User
 	Side         string    `json:"side"`          // Position side: SELL / BUY
-	Status       string    `json:"status"`        // Status open / closed
+	Status       string    `json:"status"`        // Status OPEN / CLOSED
 	CreationTime time.Time `json:"creation_time"` // CreationTime of the position
 	User         string    `json:"user"`          // Name of the owner
 	Symbol       string    `json:"symbol"`        // Symbol this position is trading on
+	TakeProfit   float64   `json:"take_profit"`   // Price the bracket takes profit at, zero without bracket
+	StopLoss     float64   `json:"stop_loss"`     // Price that triggers the stop loss of the bracket
+	StopLimit    float64   `json:"stop_limit"`    // Limit price of the stop loss, the stop loss when zero
+	TrailAmount  float64   `json:"trail_amount"`  // Distance of the trailing stop to the best price
+	TrailPercent float64   `json:"trail_percent"` // Distance of the trailing stop as a percent of the best price
+	TrailPeak    float64   `json:"trail_peak"`    // Best price seen since the trail was set
+	NetQuantity  float64   `json:"net_quantity"`  // Quantity the entry orders filled minus the quantity the exit orders filled
+	EntryPrice   float64   `json:"entry_price"`   // Average price of the entry orders, weighted by the quantity they filled
+	Exposure     float64   `json:"exposure"`      // Net quantity valued at the last price, at the entry price without candles
 	Orders       []Order   `json:"orders"`        // Orders belonging to this position
+	PnL          *PnL      `json:"pnl,omitempty"` // Profit and loss of the position, without the breakdown per order
 }
 
-// NewPosition contains information needed to create a new position
+// NewPosition contains information needed to create a new position.
+// IdempotencyKey is the idempotency key of the request, a retry with the same
+// key gets the position created the first time. TakeProfit and StopLoss
+// attach a bracket to the position, an OCO order list placed once an entry
+// order fills. StopLimit is the limit price of the stop loss, the stop loss
+// itself when not set.
 type NewPosition struct {
-	UserID   string `json:"user_id"`
-	SymbolID string `json:"symbol_id" validate:"required"`
-	Side     string `json:"side" validate:"required"`
+	UserID         string  `json:"user_id"`
+	SymbolID       string  `json:"symbol_id" validate:"required"`
+	Side           string  `json:"side" validate:"required"`
+	IdempotencyKey string  `json:"-"`
+	TakeProfit     float64 `json:"take_profit" validate:"omitempty,gt=0"`
+	StopLoss       float64 `json:"stop_loss" validate:"omitempty,gt=0"`
+	StopLimit      float64 `json:"stop_limit" validate:"omitempty,gt=0"`
+}
+
+// NewTrail contains the distance a trailing stop keeps from the best price
+// of a position, either an amount of the quote asset or a percent of the
+// price.
+type NewTrail struct {
+	Amount  float64 `json:"amount" validate:"omitempty,gt=0"`
+	Percent float64 `json:"percent" validate:"omitempty,gt=0,lt=100"`
+}
+
+// QueryFilter holds the conditions the positions of a query match. Zero
+// values are not applied, CreatedBefore is exclusive.
+type QueryFilter struct {
+	Symbol        string    `json:"symbol"`
+	Status        string    `json:"status" validate:"omitempty,oneof=OPEN CLOSED"`
+	Side          string    `json:"side" validate:"omitempty,oneof=BUY SELL"`
+	PositionID    string    `json:"position_id" validate:"omitempty,uuid4"`
+	CreatedAfter  time.Time `json:"created_after"`
+	CreatedBefore time.Time `json:"created_before"`
+}
+
+// OrderBy holds the field and direction positions are sorted by. The newest
+// positions come first by default.
+type OrderBy struct {
+	Field     string `json:"sort"`
+	Direction string `json:"direction" validate:"omitempty,oneof=asc desc ASC DESC"`
 }
 
 // Order represent an order in a position
 type Order struct {
-	ID           string    `json:"order_id"`
-	SymbolID     string    `json:"symbol_id"`
-	PositionID   string    `json:"position_id"`
-	CreationTime orderTime `json:"creation_time"`
-	Price        float64   `json:"price"`
-	Quantity     float64   `json:"quantity"`
-	Status       string    `json:"status"`
-	Type         string    `json:"type"`
-	Side         string    `json:"side"`
+	ID               string    `json:"order_id"`
+	SymbolID         string    `json:"symbol_id"`
+	PositionID       string    `json:"position_id"`
+	CreationTime     orderTime `json:"creation_time"`
+	Price            float64   `json:"price"`
+	Quantity         float64   `json:"quantity"`
+	Status           string    `json:"status"`
+	Type             string    `json:"type"`
+	Side             string    `json:"side"`
+	ExecutedQuantity float64   `json:"executed_quantity"`
+	CumulativeQuote  float64   `json:"cumulative_quote"`
+	Leg              string    `json:"leg"`
+}
+
+// PnL represents the profit and loss of a position in its quote asset. Entry
+// orders are averaged by cost, exit orders realize the difference between
+// their price and the average entry price. The quantity still held is valued
+// at the close of the latest synced candle. Fees charged in the base or the
+// quote asset are converted to the quote asset, fees charged in any other
+// asset are listed in OtherFees.
+type PnL struct {
+	PositionID    string             `json:"position_id"`
+	Realized      float64            `json:"realized"`
+	Unrealized    float64            `json:"unrealized"`
+	Fees          float64            `json:"fees"`
+	OtherFees     map[string]float64 `json:"other_fees,omitempty"`
+	Net           float64            `json:"net"`
+	ReturnPercent float64            `json:"return_percent"`
+	LastPrice     float64            `json:"last_price"`
+	Orders        []OrderPnL         `json:"orders,omitempty"`
+}
+
+// OrderPnL represents the share of an order in the profit and loss of its
+// position. Realized is zero for entry orders.
+type OrderPnL struct {
+	OrderID  string  `json:"order_id"`
+	Side     string  `json:"side"`
+	Entry    bool    `json:"entry"`
+	Quantity float64 `json:"quantity"`
+	Price    float64 `json:"price"`
+	Quote    float64 `json:"quote"`
+	Fees     float64 `json:"fees"`
+	Realized float64 `json:"realized"`
 }
 
 // orderTime is a custom time implementation to be able to Unmarshal psql
@@ -54,17 +135,154 @@ func toPosition(dbPos db.Position) Position {
 		}
 	}
 
-	return Position{
+	pos := Position{
 		ID:           dbPos.ID,
 		SymbolID:     dbPos.SymbolID,
 		UserID:       dbPos.UserID,
 		Side:         dbPos.Side,
-		Status:       dbPos.Status,
+		Status:       strings.ToUpper(dbPos.Status),
 		CreationTime: dbPos.CreationTime,
 		User:         dbPos.User,
 		Symbol:       dbPos.Symbol,
+		TakeProfit:   dbPos.TakeProfit,
+		StopLoss:     dbPos.StopLoss,
+		StopLimit:    dbPos.StopLimit,
+		TrailAmount:  dbPos.TrailAmount,
+		TrailPercent: dbPos.TrailPercent,
+		TrailPeak:    dbPos.TrailPeak,
 		Orders:       ords,
 	}
+	pos.NetQuantity, pos.EntryPrice = size(ords, dbPos.Side)
+
+	return pos
+}
+
+// size returns the net quantity the orders of a position filled, and the
+// volume weighted average price of its entry orders. Entry orders are the
+// orders on the side of the position, the others are exits.
+func size(ords []Order, side string) (float64, float64) {
+	var net, entryQty, entryQuote float64
+	for _, ord := range ords {
+		if ord.Side != side {
+			net -= ord.ExecutedQuantity
+			continue
+		}
+
+		quote := ord.CumulativeQuote
+		if quote == 0 {
+			quote = ord.Price * ord.ExecutedQuantity
+		}
+		net += ord.ExecutedQuantity
+		entryQty += ord.ExecutedQuantity
+		entryQuote += quote
+	}
+
+	if entryQty == 0 {
+		return net, 0
+	}
+	return net, entryQuote / entryQty
+}
+
+// computePnL computes the profit and loss of a position from the executed
+// quantity of its orders, in the order they were created.
+func computePnL(pos Position, fees []db.Fee, mkt db.Market) PnL {
+	ords := make([]Order, len(pos.Orders))
+	copy(ords, pos.Orders)
+	sort.SliceStable(ords, func(i, j int) bool {
+		return time.Time(ords[i].CreationTime).Before(time.Time(ords[j].CreationTime))
+	})
+
+	pnl := PnL{
+		PositionID: pos.ID,
+		LastPrice:  mkt.LastPrice,
+	}
+
+	var held, cost, entryCost float64
+	for _, ord := range ords {
+		if ord.ExecutedQuantity == 0 {
+			continue
+		}
+
+		quote := ord.CumulativeQuote
+		if quote == 0 {
+			quote = ord.Price * ord.ExecutedQuantity
+		}
+		opnl := OrderPnL{
+			OrderID:  ord.ID,
+			Side:     ord.Side,
+			Entry:    ord.Side == pos.Side,
+			Quantity: ord.ExecutedQuantity,
+			Price:    quote / ord.ExecutedQuantity,
+			Quote:    quote,
+		}
+
+		for _, fee := range fees {
+			if fee.OrderID != ord.ID {
+				continue
+			}
+			switch fee.CommissionAsset {
+			case mkt.QuoteAsset:
+				opnl.Fees += fee.Commission
+			case mkt.BaseAsset:
+				opnl.Fees += fee.CommissionQuote
+			default:
+				if pnl.OtherFees == nil {
+					pnl.OtherFees = make(map[string]float64)
+				}
+				pnl.OtherFees[fee.CommissionAsset] += fee.Commission
+			}
+		}
+		pnl.Fees += opnl.Fees
+
+		switch {
+		case opnl.Entry:
+			held += opnl.Quantity
+			cost += opnl.Quote
+			entryCost += opnl.Quote
+		case held > 0:
+			// Exits beyond the quantity held have no entry price to realize
+			// against.
+			qty := opnl.Quantity
+			if qty > held {
+				qty = held
+			}
+			avg := cost / held
+			opnl.Realized = (opnl.Price - avg) * qty
+			if pos.Side == broker.OrderSideSell {
+				opnl.Realized = -opnl.Realized
+			}
+			cost -= avg * qty
+			held -= qty
+		}
+		pnl.Realized += opnl.Realized
+
+		pnl.Orders = append(pnl.Orders, opnl)
+	}
+
+	if held > 0 && mkt.LastPrice > 0 {
+		pnl.Unrealized = mkt.LastPrice*held - cost
+		if pos.Side == broker.OrderSideSell {
+			pnl.Unrealized = -pnl.Unrealized
+		}
+	}
+
+	pnl.Net = pnl.Realized + pnl.Unrealized - pnl.Fees
+	if entryCost > 0 {
+		pnl.ReturnPercent = pnl.Net / entryCost * 100
+	}
+
+	return pnl
+}
+
+func toDBQueryFilter(filter QueryFilter) db.QueryFilter {
+	return db.QueryFilter{
+		Symbol:        filter.Symbol,
+		Status:        filter.Status,
+		Side:          filter.Side,
+		PositionID:    filter.PositionID,
+		CreatedAfter:  filter.CreatedAfter,
+		CreatedBefore: filter.CreatedBefore,
+	}
 }
 
 func toPositionSlice(dbPoss []db.Position) []Position {
@@ -75,8 +293,26 @@ func toPositionSlice(dbPoss []db.Position) []Position {
 	return poss
 }
 
+// TrailStop returns the price the trailing stop of the position is at, zero
+// when the position doesn't trail or no price was seen yet.
+func (p Position) TrailStop() float64 {
+	dist := p.TrailAmount
+	if p.TrailPercent > 0 {
+		dist = p.TrailPeak * p.TrailPercent / 100
+	}
+	if p.TrailPeak == 0 || dist == 0 {
+		return 0
+	}
+
+	if p.Side == broker.OrderSideSell {
+		return p.TrailPeak + dist
+	}
+	return p.TrailPeak - dist
+}
+
+// Equal tells whether both times are the same instant.
 func (ot orderTime) Equal(cmp orderTime) bool {
-	return true
+	return time.Time(ot).Equal(time.Time(cmp))
 }
 
 func (ot orderTime) MarshalJSON() ([]byte, error) {
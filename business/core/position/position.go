@@ -6,9 +6,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lgarciaaco/machina-api/business/broker"
+	"github.com/lgarciaaco/machina-api/business/core/order"
 	"github.com/lgarciaaco/machina-api/business/core/position/db"
 	"github.com/lgarciaaco/machina-api/business/sys/database"
 	"github.com/lgarciaaco/machina-api/business/sys/validate"
@@ -20,6 +24,10 @@ var (
 	ErrNotFound      = errors.New("position not found")
 	ErrInvalidID     = errors.New("ID is not in its proper form")
 	ErrAlreadyClosed = errors.New("can't close a position that is already closed")
+	ErrPendingOrders = errors.New("can't close a position with orders binance didn't confirm yet")
+	ErrNotFilled     = errors.New("order closing the position was not filled")
+
+	ErrIdempotencyConflict = errors.New("idempotency key was used for a different position")
 
 	CLOSED = "CLOSED"
 	OPEN   = "OPEN"
@@ -28,12 +36,14 @@ var (
 // Core manages the set of API's for candle access.
 type Core struct {
 	agent db.Agent
+	order order.Core
 }
 
 // NewCore constructs a core for user api access.
-func NewCore(log *zap.SugaredLogger, sqlxDB *sqlx.DB) Core {
+func NewCore(log *zap.SugaredLogger, sqlxDB *sqlx.DB, exg broker.Exchange) Core {
 	return Core{
 		agent: db.NewAgent(log, sqlxDB),
+		order: order.NewCore(log, sqlxDB, exg),
 	}
 }
 
@@ -42,17 +52,37 @@ func (c Core) Create(ctx context.Context, nPos NewPosition, now time.Time) (Posi
 	if err := validate.Check(nPos); err != nil {
 		return Position{}, fmt.Errorf("validating data: %w", err)
 	}
+	if err := c.checkBracket(ctx, nPos); err != nil {
+		return Position{}, fmt.Errorf("validating data: %w", err)
+	}
+
+	// A retried request finds the position created by the first one.
+	if nPos.IdempotencyKey != "" {
+		pos, found, err := c.replay(ctx, nPos)
+		if err != nil || found {
+			return pos, err
+		}
+	}
 
 	dbPos := db.Position{
-		ID:           validate.GenerateID(),
-		SymbolID:     nPos.SymbolID,
-		UserID:       nPos.UserID,
-		Side:         nPos.Side,
-		Status:       OPEN,
-		CreationTime: now,
+		ID:             validate.GenerateID(),
+		SymbolID:       nPos.SymbolID,
+		UserID:         nPos.UserID,
+		Side:           nPos.Side,
+		Status:         OPEN,
+		CreationTime:   now,
+		IdempotencyKey: nPos.IdempotencyKey,
+		TakeProfit:     nPos.TakeProfit,
+		StopLoss:       nPos.StopLoss,
+		StopLimit:      nPos.StopLimit,
 	}
 
 	if err := c.agent.Create(ctx, dbPos); err != nil {
+		// The first request stored the position in the meantime.
+		if errors.Is(err, database.ErrDBDuplicatedEntry) {
+			pos, _, err := c.replay(ctx, nPos)
+			return pos, err
+		}
 		return Position{}, fmt.Errorf("create: %w", err)
 	}
 
@@ -65,9 +95,14 @@ func (c Core) Create(ctx context.Context, nPos NewPosition, now time.Time) (Posi
 	return toPosition(rPos), nil
 }
 
-// Query gets the specified positions.
-func (c Core) Query(ctx context.Context, pageNumber int, rowsPerPage int) ([]Position, error) {
-	dbPoss, err := c.agent.Query(ctx, pageNumber, rowsPerPage)
+// Query gets a page of the positions that match the filter, sorted by the
+// given field.
+func (c Core) Query(ctx context.Context, filter QueryFilter, orderBy OrderBy, pageNumber int, rowsPerPage int) ([]Position, error) {
+	if err := checkQuery(filter, orderBy); err != nil {
+		return nil, fmt.Errorf("validating data: %w", err)
+	}
+
+	dbPoss, err := c.agent.Query(ctx, toDBQueryFilter(filter), db.OrderBy(orderBy), pageNumber, rowsPerPage)
 	if err != nil {
 		if errors.Is(err, database.ErrDBNotFound) {
 			return nil, ErrNotFound
@@ -75,7 +110,7 @@ func (c Core) Query(ctx context.Context, pageNumber int, rowsPerPage int) ([]Pos
 		return nil, fmt.Errorf("query: %w", err)
 	}
 
-	return toPositionSlice(dbPoss), nil
+	return c.withPnL(ctx, toPositionSlice(dbPoss))
 }
 
 // QueryByID gets the specified position from the database.
@@ -92,12 +127,47 @@ func (c Core) QueryByID(ctx context.Context, posID string) (Position, error) {
 		return Position{}, fmt.Errorf("query: %w", err)
 	}
 
-	return toPosition(dbPos), nil
+	poss, err := c.withPnL(ctx, []Position{toPosition(dbPos)})
+	if err != nil {
+		return Position{}, err
+	}
+
+	return poss[0], nil
+}
+
+// PnL gets the profit and loss of the position, with the share of each of
+// its orders. The position is the one the caller already got, with its
+// orders.
+func (c Core) PnL(ctx context.Context, pos Position) (PnL, error) {
+	fees, err := c.agent.QueryFees(ctx, []string{pos.ID})
+	if err != nil {
+		return PnL{}, fmt.Errorf("query fees: %w", err)
+	}
+
+	mkts, err := c.agent.QueryMarkets(ctx, []string{pos.SymbolID})
+	if err != nil {
+		return PnL{}, fmt.Errorf("query markets: %w", err)
+	}
+
+	var mkt db.Market
+	if len(mkts) > 0 {
+		mkt = mkts[0]
+	}
+
+	return computePnL(pos, fees, mkt), nil
 }
 
-// QueryByUser gets the specified position from the database given a userId.
-func (c Core) QueryByUser(ctx context.Context, pageNumber int, rowsPerPage int, usrID string) ([]Position, error) {
-	dbPoss, err := c.agent.QueryByUser(ctx, pageNumber, rowsPerPage, usrID)
+// QueryByUser gets a page of the positions of a user that match the filter,
+// sorted by the given field.
+func (c Core) QueryByUser(ctx context.Context, filter QueryFilter, orderBy OrderBy, pageNumber int, rowsPerPage int, usrID string) ([]Position, error) {
+	if err := checkQuery(filter, orderBy); err != nil {
+		return nil, fmt.Errorf("validating data: %w", err)
+	}
+
+	dbFilter := toDBQueryFilter(filter)
+	dbFilter.UserID = usrID
+
+	dbPoss, err := c.agent.Query(ctx, dbFilter, db.OrderBy(orderBy), pageNumber, rowsPerPage)
 	if err != nil {
 		if errors.Is(err, database.ErrDBNotFound) {
 			return nil, ErrNotFound
@@ -105,32 +175,340 @@ func (c Core) QueryByUser(ctx context.Context, pageNumber int, rowsPerPage int,
 		return nil, fmt.Errorf("query: %w", err)
 	}
 
-	return toPositionSlice(dbPoss), nil
+	return c.withPnL(ctx, toPositionSlice(dbPoss))
+}
+
+// Close closes a position identified by a given ID. The orders of the
+// position still open are canceled, and a market order sells what the
+// position holds or buys back what it sold, over-exits included. The
+// position is closed once binance accepted the order, dry-run orders that
+// never fill included.
+//
+// Binance can't take orders back, so the steps don't share a transaction,
+// each one is stored as it happens. A failure after the orders were
+// canceled leaves the position open without them, bracket included, and
+// closing it again offsets what is still held. The offsetting order has an
+// idempotency key derived from the position and its orders, so concurrent
+// closes place it once. An offsetting order binance got without the system storing the
+// answer stays pending until the reconciler settles it, which closes the
+// position once it is flat.
+func (c Core) Close(ctx context.Context, posID string, now time.Time) error {
+	dbPos, err := c.queryOpen(ctx, posID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.order.CancelByPosition(ctx, posID, dbPos.Symbol); err != nil {
+		return fmt.Errorf("cancel orders: %w", err)
+	}
+
+	// Canceled orders might have filled some more in the meantime, even
+	// enough to close the position.
+	dbPos, err = c.queryOpen(ctx, posID)
+	if err != nil {
+		if errors.Is(err, ErrAlreadyClosed) {
+			return nil
+		}
+		return err
+	}
+	pos := toPosition(dbPos)
+
+	for _, o := range pos.Orders {
+		if o.Status == order.StatusPending {
+			return ErrPendingOrders
+		}
+	}
+
+	// A position that sold more than it bought, or the other way around,
+	// is offset on its own side.
+	side, qty := broker.OrderSideSell, pos.NetQuantity
+	if pos.Side == broker.OrderSideSell {
+		side = broker.OrderSideBuy
+	}
+	if qty < 0 {
+		side, qty = pos.Side, -qty
+	}
+
+	if qty > order.QuantityTolerance {
+		odr, err := c.order.Create(ctx, order.NewOrder{
+			PositionID:     pos.ID,
+			SymbolID:       pos.SymbolID,
+			Symbol:         pos.Symbol,
+			UserID:         pos.UserID,
+			IdempotencyKey: fmt.Sprintf("close-%s-%d", pos.ID, len(pos.Orders)),
+			Quantity:       qty,
+			Side:           side,
+			Type:           broker.OrderTypeMarket,
+			Round:          true,
+		}, now)
+		if err != nil {
+			return fmt.Errorf("create order: %w", err)
+		}
+		if odr.Status != broker.OrderStatusFilled && odr.Status != broker.OrderStatusPartiallyFilled && odr.Status != broker.OrderStatusNew {
+			return fmt.Errorf("orderID[%s] status[%s]: %w", odr.ID, odr.Status, ErrNotFilled)
+		}
+	}
+
+	// The fill of the order closed the position already when it is flat.
+	dbPos.Status = CLOSED
+	if err := c.agent.Update(ctx, dbPos); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	return nil
+}
+
+// SetTrail sets the trailing stop of an open position. The stop starts
+// trailing from the next price evaluated.
+func (c Core) SetTrail(ctx context.Context, posID string, nTrl NewTrail) (Position, error) {
+	if err := validate.CheckID(posID); err != nil {
+		return Position{}, ErrInvalidID
+	}
+	if err := validate.Check(nTrl); err != nil {
+		return Position{}, fmt.Errorf("validating data: %w", err)
+	}
+	if (nTrl.Amount == 0) == (nTrl.Percent == 0) {
+		return Position{}, fmt.Errorf("validating data: %w", validate.FieldErrors{{Field: "amount", Error: "one of amount or percent is required"}})
+	}
+
+	dbPos, err := c.queryOpen(ctx, posID)
+	if err != nil {
+		return Position{}, err
+	}
+
+	dbPos.TrailAmount = nTrl.Amount
+	dbPos.TrailPercent = nTrl.Percent
+	dbPos.TrailPeak = 0
+	if err := c.agent.UpdateTrail(ctx, dbPos); err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return Position{}, ErrAlreadyClosed
+		}
+		return Position{}, fmt.Errorf("update: %w", err)
+	}
+
+	return toPosition(dbPos), nil
 }
 
-// Close closes a position identified by a given ID.
-// Closing a position consist on figuring out the open balance and creating a position
-// to set balance to 0.
-func (c Core) Close(ctx context.Context, posID string) error {
+// ClearTrail removes the trailing stop of an open position.
+func (c Core) ClearTrail(ctx context.Context, posID string) error {
 	if err := validate.CheckID(posID); err != nil {
 		return ErrInvalidID
 	}
 
+	dbPos, err := c.queryOpen(ctx, posID)
+	if err != nil {
+		return err
+	}
+
+	dbPos.TrailAmount = 0
+	dbPos.TrailPercent = 0
+	dbPos.TrailPeak = 0
+	if err := c.agent.UpdateTrail(ctx, dbPos); err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return ErrAlreadyClosed
+		}
+		return fmt.Errorf("update: %w", err)
+	}
+
+	return nil
+}
+
+// QueryTrailing gets the open positions with a trailing stop.
+func (c Core) QueryTrailing(ctx context.Context) ([]Position, error) {
+	dbPoss, err := c.agent.QueryTrailing(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	return toPositionSlice(dbPoss), nil
+}
+
+// Trail moves the trailing stop of the position with a new price, and tells
+// whether the price reached the stop. The stop only moves in favor of the
+// position: up with the highest price of BUY positions, down with the lowest
+// price of SELL positions. A stop cleared or a position closed since pos was
+// queried never reaches the stop.
+func (c Core) Trail(ctx context.Context, pos Position, price float64) (bool, error) {
+	better := pos.TrailPeak == 0 || (pos.Side == broker.OrderSideSell && price < pos.TrailPeak) || (pos.Side != broker.OrderSideSell && price > pos.TrailPeak)
+	if better {
+		pos.TrailPeak = price
+	}
+
+	stop := pos.TrailStop()
+	hit := price <= stop
+	if pos.Side == broker.OrderSideSell {
+		hit = price >= stop
+	}
+	if !better && !hit {
+		return false, nil
+	}
+
+	// Only the peak is written, and only while the stop is still set, so a
+	// stop set or cleared since pos was queried is not overwritten.
+	dbPos := db.Position{
+		ID:        pos.ID,
+		TrailPeak: pos.TrailPeak,
+	}
+	trailing, err := c.agent.UpdateTrailPeak(ctx, dbPos)
+	if err != nil {
+		return false, fmt.Errorf("update: %w", err)
+	}
+	if !trailing {
+		return false, nil
+	}
+
+	return hit, nil
+}
+
+// queryOpen gets the position, it fails with ErrAlreadyClosed when the
+// position is closed.
+func (c Core) queryOpen(ctx context.Context, posID string) (db.Position, error) {
 	dbPos, err := c.agent.QueryByID(ctx, posID)
 	if err != nil {
 		if errors.Is(err, database.ErrDBNotFound) {
-			return ErrNotFound
+			return db.Position{}, ErrNotFound
 		}
-		return fmt.Errorf("updating product posID[%s]: %w", posID, err)
+		return db.Position{}, fmt.Errorf("query: %w", err)
+	}
+	if strings.EqualFold(dbPos.Status, CLOSED) {
+		return db.Position{}, ErrAlreadyClosed
 	}
 
-	if dbPos.Status == CLOSED {
-		return ErrAlreadyClosed
+	return dbPos, nil
+}
+
+// withPnL sets the profit and loss of the positions, leaving out the
+// breakdown per order.
+func (c Core) withPnL(ctx context.Context, poss []Position) ([]Position, error) {
+	if len(poss) == 0 {
+		return poss, nil
 	}
-	dbPos.Status = CLOSED
 
-	if err := c.agent.Update(ctx, dbPos); err != nil {
-		return fmt.Errorf("update: %w", err)
+	posIDs := make([]string, len(poss))
+	var sblIDs []string
+	seen := make(map[string]bool)
+	for i, pos := range poss {
+		posIDs[i] = pos.ID
+		if !seen[pos.SymbolID] {
+			seen[pos.SymbolID] = true
+			sblIDs = append(sblIDs, pos.SymbolID)
+		}
+	}
+
+	fees, err := c.agent.QueryFees(ctx, posIDs)
+	if err != nil {
+		return nil, fmt.Errorf("query fees: %w", err)
+	}
+
+	dbMkts, err := c.agent.QueryMarkets(ctx, sblIDs)
+	if err != nil {
+		return nil, fmt.Errorf("query markets: %w", err)
+	}
+	mkts := make(map[string]db.Market, len(dbMkts))
+	for _, mkt := range dbMkts {
+		mkts[mkt.SymbolID] = mkt
+	}
+
+	for i, pos := range poss {
+		mkt := mkts[pos.SymbolID]
+		pnl := computePnL(pos, fees, mkt)
+		pnl.Orders = nil
+		poss[i].PnL = &pnl
+
+		price := mkt.LastPrice
+		if price == 0 {
+			price = pos.EntryPrice
+		}
+		poss[i].Exposure = pos.NetQuantity * price
+	}
+
+	return poss, nil
+}
+
+// replay gets the position the user created with the idempotency key of the
+// new position. It fails with ErrIdempotencyConflict when the key was used
+// for a different position.
+func (c Core) replay(ctx context.Context, nPos NewPosition) (Position, bool, error) {
+	dbPos, err := c.agent.QueryByIdempotencyKey(ctx, nPos.UserID, nPos.IdempotencyKey)
+	if err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return Position{}, false, nil
+		}
+		return Position{}, false, fmt.Errorf("query: %w", err)
+	}
+
+	if dbPos.SymbolID != nPos.SymbolID || dbPos.Side != nPos.Side || dbPos.TakeProfit != nPos.TakeProfit ||
+		dbPos.StopLoss != nPos.StopLoss || dbPos.StopLimit != nPos.StopLimit {
+		return Position{}, false, ErrIdempotencyConflict
+	}
+
+	return toPosition(dbPos), true, nil
+}
+
+// checkBracket validates the take profit and stop loss of a new position. Both
+// are set together, on the side the position profits and loses, and the
+// symbol has to accept OCO order lists.
+func (c Core) checkBracket(ctx context.Context, nPos NewPosition) error {
+	if nPos.TakeProfit == 0 && nPos.StopLoss == 0 {
+		if nPos.StopLimit > 0 {
+			return validate.FieldErrors{{Field: "stop_limit", Error: "stop_limit needs a stop_loss"}}
+		}
+		return nil
+	}
+
+	var fields validate.FieldErrors
+	switch {
+	case nPos.TakeProfit == 0:
+		fields = append(fields, validate.FieldError{Field: "take_profit", Error: "take_profit is required with stop_loss"})
+	case nPos.StopLoss == 0:
+		fields = append(fields, validate.FieldError{Field: "stop_loss", Error: "stop_loss is required with take_profit"})
+	case nPos.Side == broker.OrderSideBuy && nPos.TakeProfit <= nPos.StopLoss:
+		fields = append(fields, validate.FieldError{Field: "take_profit", Error: "take_profit must be above stop_loss for BUY positions"})
+	case nPos.Side == broker.OrderSideSell && nPos.TakeProfit >= nPos.StopLoss:
+		fields = append(fields, validate.FieldError{Field: "take_profit", Error: "take_profit must be below stop_loss for SELL positions"})
+	}
+	if len(fields) > 0 {
+		return fields
+	}
+
+	ok, err := c.agent.QueryOcoAllowed(ctx, nPos.SymbolID)
+	if err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return validate.FieldErrors{{Field: "symbol_id", Error: "symbol_id is not a known symbol"}}
+		}
+		return fmt.Errorf("query symbol: %w", err)
+	}
+	if !ok {
+		return validate.FieldErrors{{Field: "take_profit", Error: "symbol doesn't allow OCO orders"}}
+	}
+
+	return c.order.CheckBracket(ctx, order.NewBracket{
+		SymbolID:   nPos.SymbolID,
+		Side:       nPos.Side,
+		TakeProfit: nPos.TakeProfit,
+		StopLoss:   nPos.StopLoss,
+		StopLimit:  nPos.StopLimit,
+	})
+}
+
+// checkQuery validates the filter and the field positions are sorted by.
+func checkQuery(filter QueryFilter, orderBy OrderBy) error {
+	if err := validate.Check(filter); err != nil {
+		return err
+	}
+	if err := validate.Check(orderBy); err != nil {
+		return err
+	}
+	if _, ok := db.OrderByFields[orderBy.Field]; orderBy.Field != "" && !ok {
+		names := make([]string, 0, len(db.OrderByFields))
+		for name := range db.OrderByFields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return validate.FieldErrors{{Field: "sort", Error: "sort must be one of " + strings.Join(names, " ")}}
+	}
+	if !filter.CreatedAfter.IsZero() && !filter.CreatedBefore.IsZero() && !filter.CreatedAfter.Before(filter.CreatedBefore) {
+		return validate.FieldErrors{{Field: "created_before", Error: "created_before must be after created_after"}}
 	}
 
 	return nil
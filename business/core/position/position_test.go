@@ -2,6 +2,7 @@ package position
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -10,8 +11,11 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 
+	"github.com/lgarciaaco/machina-api/business/broker"
+	"github.com/lgarciaaco/machina-api/business/core/order"
 	"github.com/lgarciaaco/machina-api/business/data/dbschema"
 	"github.com/lgarciaaco/machina-api/business/data/dbtest"
+	"github.com/lgarciaaco/machina-api/business/sys/validate"
 )
 
 var c *docker.Container
@@ -32,7 +36,18 @@ func TestPosition(t *testing.T) {
 	log, db, teardown := dbtest.NewUnit(t, c, "testpos")
 	t.Cleanup(teardown)
 
-	core := NewCore(log, db)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dbschema.Seed(ctx, db)
+
+	paper := broker.NewPaper(broker.PaperConfig{
+		Log:      log,
+		DB:       db,
+		Balances: map[string]float64{"USDT": 1000},
+	})
+	core := NewCore(log, db, paper)
+	odrCore := order.NewCore(log, db, paper)
 
 	t.Log("Given the need to work with Positions records.")
 	{
@@ -65,11 +80,23 @@ func TestPosition(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould get back the same position.", dbtest.Success, testID)
 
-			err = core.Close(ctx, pos.ID)
+			nOdr := order.NewOrder{
+				PositionID: pos.ID,
+				SymbolID:   nPos.SymbolID,
+				Symbol:     "ETHUSDT",
+				Quantity:   2,
+				Side:       "BUY",
+			}
+			if _, err := odrCore.Create(ctx, nOdr, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to buy for the position : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to buy for the position.", dbtest.Success, testID)
+
+			err = core.Close(ctx, pos.ID, now)
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to close position : %s.", dbtest.Failed, testID, err)
 			}
-			t.Logf("\t%s\tTest %d:\tShould be able to create position.", dbtest.Success, testID)
+			t.Logf("\t%s\tTest %d:\tShould be able to close position.", dbtest.Success, testID)
 
 			clsPos, err = core.QueryByID(ctx, pos.ID)
 			if err != nil {
@@ -81,10 +108,300 @@ func TestPosition(t *testing.T) {
 				t.Fatalf("\t%s\tTest %d:\tShould get CLOSED status for position but got %s.", dbtest.Failed, testID, clsPos.Status)
 			}
 			t.Logf("\t%s\tTest %d:\tShould get CLOSED status for position.", dbtest.Success, testID)
+
+			if len(clsPos.Orders) != 2 || clsPos.Orders[1].Side == clsPos.Orders[0].Side || clsPos.Orders[0].ExecutedQuantity != 2 || clsPos.Orders[1].ExecutedQuantity != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould sell what the position bought : %+v.", dbtest.Failed, testID, clsPos.Orders)
+			}
+			t.Logf("\t%s\tTest %d:\tShould sell what the position bought.", dbtest.Success, testID)
+
+			if err := core.Close(ctx, pos.ID, now); !errors.Is(err, ErrAlreadyClosed) {
+				t.Fatalf("\t%s\tTest %d:\tShould not close a closed position : %v.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not close a closed position.", dbtest.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen attaching a take profit and a stop loss.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			nPos := NewPosition{
+				SymbolID:   "125240c0-7f7f-4d0f-b30d-939fd93cf027", // SymbolID is seeded in db with OCO allowed
+				UserID:     "45b5fbd3-755f-4379-8f07-a58d4a30fa2f", // UserID is seeded in db
+				Side:       "BUY",
+				TakeProfit: 290,
+				StopLoss:   300,
+			}
+			if _, err := core.Create(ctx, nPos, now); !validate.IsFieldErrors(err) {
+				t.Fatalf("\t%s\tTest %d:\tShould reject a take profit below the stop loss of a BUY position: %v.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject a take profit below the stop loss of a BUY position.", dbtest.Success, testID)
+
+			// The last candle seeded closes at 310.50.
+			nPos.TakeProfit = 400
+			nPos.StopLoss = 320
+			if _, err := core.Create(ctx, nPos, now); !validate.IsFieldErrors(err) {
+				t.Fatalf("\t%s\tTest %d:\tShould reject a stop loss above the last price of a BUY position: %v.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject a stop loss above the last price of a BUY position.", dbtest.Success, testID)
+
+			nPos.StopLoss = 300
+			pos, err := core.Create(ctx, nPos, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create position : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create position.", dbtest.Success, testID)
+
+			if pos.TakeProfit != 400 || pos.StopLoss != 300 || pos.StopLimit != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould store the bracket: %+v.", dbtest.Failed, testID, pos)
+			}
+			t.Logf("\t%s\tTest %d:\tShould store the bracket.", dbtest.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen trailing a stop behind the price.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			nPos := NewPosition{
+				SymbolID: "125240c0-7f7f-4d0f-b30d-939fd93cf027", // SymbolID is seeded in db
+				UserID:   "45b5fbd3-755f-4379-8f07-a58d4a30fa2f", // UserID is seeded in db
+				Side:     "BUY",
+			}
+			pos, err := core.Create(ctx, nPos, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create position : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create position.", dbtest.Success, testID)
+
+			if _, err := core.SetTrail(ctx, pos.ID, NewTrail{Amount: 10, Percent: 5}); !validate.IsFieldErrors(err) {
+				t.Fatalf("\t%s\tTest %d:\tShould reject both an amount and a percent: %v.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject both an amount and a percent.", dbtest.Success, testID)
+
+			if _, err := core.SetTrail(ctx, pos.ID, NewTrail{Percent: 10}); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to set the trail : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to set the trail.", dbtest.Success, testID)
+
+			// The stop follows the highest price, 200 puts it at 180.
+			var stale Position
+			for _, tt := range []struct {
+				price float64
+				hit   bool
+			}{{100, false}, {200, false}, {185, false}, {180, true}} {
+				poss, err := core.QueryTrailing(ctx)
+				if err != nil || len(poss) != 1 {
+					t.Fatalf("\t%s\tTest %d:\tShould get the trailing position : %v %v.", dbtest.Failed, testID, err, poss)
+				}
+
+				stale = poss[0]
+
+				hit, err := core.Trail(ctx, poss[0], tt.price)
+				if err != nil || hit != tt.hit {
+					t.Fatalf("\t%s\tTest %d:\tShould reach the stop at price %v only: %v %v.", dbtest.Failed, testID, tt.price, hit, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould reach the stop once the price moved back by the trail.", dbtest.Success, testID)
+
+			if err := core.ClearTrail(ctx, pos.ID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to clear the trail : %s.", dbtest.Failed, testID, err)
+			}
+			if poss, err := core.QueryTrailing(ctx); err != nil || len(poss) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould not trail the position anymore : %v %v.", dbtest.Failed, testID, err, poss)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not trail the position anymore.", dbtest.Success, testID)
+
+			if hit, err := core.Trail(ctx, stale, 100); err != nil || hit {
+				t.Fatalf("\t%s\tTest %d:\tShould not reach a cleared stop : %v %v.", dbtest.Failed, testID, hit, err)
+			}
+			if poss, err := core.QueryTrailing(ctx); err != nil || len(poss) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould not restore a cleared trail : %v %v.", dbtest.Failed, testID, err, poss)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not reach or restore a cleared stop.", dbtest.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen scaling in and out of a position.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			nPos := NewPosition{
+				SymbolID: "125240c0-7f7f-4d0f-b30d-939fd93cf027", // SymbolID is seeded in db
+				UserID:   "45b5fbd3-755f-4379-8f07-a58d4a30fa2f", // UserID is seeded in db
+				Side:     "BUY",
+			}
+			pos, err := core.Create(ctx, nPos, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create position : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create position.", dbtest.Success, testID)
+
+			for _, side := range []string{"BUY", "BUY", "SELL"} {
+				nOdr := order.NewOrder{
+					PositionID: pos.ID,
+					SymbolID:   nPos.SymbolID,
+					Symbol:     "ETHUSDT",
+					Quantity:   1,
+					Side:       side,
+				}
+				if _, err := odrCore.Create(ctx, nOdr, now); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to %s for the position : %s.", dbtest.Failed, testID, side, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to buy twice and sell once for the position.", dbtest.Success, testID)
+
+			pos, err = core.QueryByID(ctx, pos.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve position by ID: %s.", dbtest.Failed, testID, err)
+			}
+			if pos.Status != OPEN || pos.NetQuantity != 1 || pos.EntryPrice <= 0 || pos.Exposure <= 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould hold the quantity not sold yet : %+v.", dbtest.Failed, testID, pos)
+			}
+			t.Logf("\t%s\tTest %d:\tShould hold the quantity not sold yet.", dbtest.Success, testID)
+
+			nOdr := order.NewOrder{
+				PositionID: pos.ID,
+				SymbolID:   nPos.SymbolID,
+				Symbol:     "ETHUSDT",
+				Quantity:   1,
+				Side:       "SELL",
+			}
+			if _, err := odrCore.Create(ctx, nOdr, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sell the rest of the position : %s.", dbtest.Failed, testID, err)
+			}
+
+			pos, err = core.QueryByID(ctx, pos.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve position by ID: %s.", dbtest.Failed, testID, err)
+			}
+			if pos.Status != CLOSED || pos.NetQuantity != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould close the position once it holds nothing : %+v.", dbtest.Failed, testID, pos)
+			}
+			t.Logf("\t%s\tTest %d:\tShould close the position once it holds nothing.", dbtest.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the offsetting order fails after canceling the open orders.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			core := NewCore(log, db, offsetFails{paper})
+
+			nPos := NewPosition{
+				SymbolID: "125240c0-7f7f-4d0f-b30d-939fd93cf027",
+				UserID:   "45b5fbd3-755f-4379-8f07-a58d4a30fa2f",
+				Side:     "BUY",
+			}
+			pos, err := core.Create(ctx, nPos, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create position : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create position.", dbtest.Success, testID)
+
+			const q = `
+			INSERT INTO orders
+				(order_id, symbol_id, position_id, price, quantity, executed_quantity, status, type, side, creation_time, broker_order_id)
+			VALUES
+				($1, '125240c0-7f7f-4d0f-b30d-939fd93cf027', $3, 300, 1, 1, 'FILLED', 'MARKET', 'BUY', NOW(), 0),
+				($2, '125240c0-7f7f-4d0f-b30d-939fd93cf027', $3, 400, 1, 0, 'NEW', 'LIMIT', 'SELL', NOW(), 7)`
+			limitID := validate.GenerateID()
+			if _, err := db.ExecContext(ctx, q, validate.GenerateID(), limitID, pos.ID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to store the orders of the position : %s.", dbtest.Failed, testID, err)
+			}
+
+			if err := core.Close(ctx, pos.ID, now); !errors.Is(err, broker.ErrInsufficientBalance) {
+				t.Fatalf("\t%s\tTest %d:\tShould fail placing the offsetting order : %v.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fail placing the offsetting order.", dbtest.Success, testID)
+
+			pos, err = core.QueryByID(ctx, pos.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve position by ID: %s.", dbtest.Failed, testID, err)
+			}
+			if pos.Status != OPEN || pos.NetQuantity != 1 || len(pos.Orders) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould leave the position open with what it holds : %+v.", dbtest.Failed, testID, pos)
+			}
+			t.Logf("\t%s\tTest %d:\tShould leave the position open with what it holds.", dbtest.Success, testID)
+
+			for _, o := range pos.Orders {
+				if o.ID == limitID && o.Status != broker.OrderStatusCanceled {
+					t.Fatalf("\t%s\tTest %d:\tShould keep the open orders canceled : %+v.", dbtest.Failed, testID, o)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the open orders canceled.", dbtest.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen closing an over-exited position with orders that never fill.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			exg := &neverFills{Exchange: paper}
+			core := NewCore(log, db, exg)
+
+			nPos := NewPosition{
+				SymbolID: "125240c0-7f7f-4d0f-b30d-939fd93cf027",
+				UserID:   "45b5fbd3-755f-4379-8f07-a58d4a30fa2f",
+				Side:     "BUY",
+			}
+			pos, err := core.Create(ctx, nPos, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create position : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create position.", dbtest.Success, testID)
+
+			const q = `
+			INSERT INTO orders
+				(order_id, symbol_id, position_id, price, quantity, executed_quantity, status, type, side, creation_time)
+			VALUES
+				($1, '125240c0-7f7f-4d0f-b30d-939fd93cf027', $3, 300, 1, 1, 'FILLED', 'MARKET', 'BUY', NOW()),
+				($2, '125240c0-7f7f-4d0f-b30d-939fd93cf027', $3, 310, 2, 2, 'FILLED', 'MARKET', 'SELL', NOW())`
+			if _, err := db.ExecContext(ctx, q, validate.GenerateID(), validate.GenerateID(), pos.ID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to store the orders of the position : %s.", dbtest.Failed, testID, err)
+			}
+
+			if err := core.Close(ctx, pos.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to close position : %s.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to close position.", dbtest.Success, testID)
+
+			if len(exg.placed) != 1 || exg.placed[0].Side != broker.OrderSideBuy || exg.placed[0].Quantity != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould buy back what was sold over the position : %+v.", dbtest.Failed, testID, exg.placed)
+			}
+			t.Logf("\t%s\tTest %d:\tShould buy back what was sold over the position.", dbtest.Success, testID)
+
+			pos, err = core.QueryByID(ctx, pos.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve position by ID: %s.", dbtest.Failed, testID, err)
+			}
+			if pos.Status != CLOSED {
+				t.Fatalf("\t%s\tTest %d:\tShould close the position once binance accepted the order : %+v.", dbtest.Failed, testID, pos)
+			}
+			t.Logf("\t%s\tTest %d:\tShould close the position once binance accepted the order.", dbtest.Success, testID)
 		}
 	}
 }
 
+// offsetFails cancels every order and rejects the new ones, as binance does
+// when the balance is gone by the time a position is closed.
+type offsetFails struct {
+	broker.Exchange
+}
+
+func (offsetFails) CancelOrder(ctx context.Context, symbol string, orderID int64) (broker.OrderResult, error) {
+	return broker.OrderResult{Symbol: symbol, OrderID: orderID, Status: broker.OrderStatusCanceled}, nil
+}
+
+func (offsetFails) PlaceOrder(ctx context.Context, or broker.OrderRequest) (broker.OrderResult, error) {
+	return broker.OrderResult{}, fmt.Errorf("placing order: %w", broker.ErrInsufficientBalance)
+}
+
 func TestPagingPosition(t *testing.T) {
 	log, db, teardown := dbtest.NewUnit(t, c, "testpospg")
 	t.Cleanup(teardown)
@@ -94,7 +411,7 @@ func TestPagingPosition(t *testing.T) {
 
 	dbschema.Seed(ctx, db)
 
-	core := NewCore(log, db)
+	core := NewCore(log, db, broker.NewBinance(broker.Config{}))
 
 	t.Log("Given the need to page through Positions records.")
 	{
@@ -103,7 +420,7 @@ func TestPagingPosition(t *testing.T) {
 		{
 			ctx := context.Background()
 
-			pos1, err := core.Query(ctx, 1, 1)
+			pos1, err := core.Query(ctx, QueryFilter{}, OrderBy{}, 1, 1)
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve positions for page 1 : %s.", dbtest.Failed, testID, err)
 			}
@@ -114,7 +431,7 @@ func TestPagingPosition(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould have a single position.", dbtest.Success, testID)
 
-			pos2, err := core.QueryByUser(ctx, 2, 1, "45b5fbd3-755f-4379-8f07-a58d4a30fa2f")
+			pos2, err := core.QueryByUser(ctx, QueryFilter{}, OrderBy{}, 2, 1, "45b5fbd3-755f-4379-8f07-a58d4a30fa2f")
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve positions for page 2 : %s.", dbtest.Failed, testID, err)
 			}
@@ -132,6 +449,35 @@ func TestPagingPosition(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould have different positions.", dbtest.Success, testID)
 		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen filtering and sorting positions.", testID)
+		{
+			ctx := context.Background()
+
+			poss, err := core.Query(ctx, QueryFilter{Symbol: "BTCUSDT", Status: OPEN}, OrderBy{}, 1, 10)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to filter positions : %s.", dbtest.Failed, testID, err)
+			}
+			if len(poss) != 1 || poss[0].ID != "028300d6-6892-44b5-aa1b-17b8a7717ead" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the open BTCUSDT position only : %v.", dbtest.Failed, testID, poss)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the open BTCUSDT position only.", dbtest.Success, testID)
+
+			poss, err = core.QueryByUser(ctx, QueryFilter{}, OrderBy{Field: "creation_time", Direction: "asc"}, 1, 1, "45b5fbd3-755f-4379-8f07-a58d4a30fa2f")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sort positions : %s.", dbtest.Failed, testID, err)
+			}
+			if len(poss) != 1 || poss[0].ID != "891c178b-3dbf-4f99-a8f0-99a86cb578b7" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the oldest position first : %v.", dbtest.Failed, testID, poss)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the oldest position first.", dbtest.Success, testID)
+
+			if _, err := core.Query(ctx, QueryFilter{}, OrderBy{Field: "user_id; DROP TABLE positions"}, 1, 1); !validate.IsFieldErrors(err) {
+				t.Fatalf("\t%s\tTest %d:\tShould reject sorting by an unknown field : %v.", dbtest.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject sorting by an unknown field.", dbtest.Success, testID)
+		}
 	}
 }
 
@@ -145,7 +491,7 @@ func TestPositionOrders(t *testing.T) {
 	dbschema.Seed(ctx, db)
 
 	ID := "891c178b-3dbf-4f99-a8f0-99a86cb578b7"
-	core := NewCore(log, db)
+	core := NewCore(log, db, broker.NewBinance(broker.Config{}))
 
 	t.Log("Given the need to retrieve Positions records with Orders.")
 	{
@@ -164,20 +510,52 @@ func TestPositionOrders(t *testing.T) {
 
 		ts, _ := time.Parse("2006-01-02T15:04:05.999999", "2019-04-01T00:00:01.000001")
 		odr1 := Order{
-			ID:           "ef984be8-da66-4d52-b659-591b95d92591",
-			SymbolID:     "125240c0-7f7f-4d0f-b30d-939fd93cf027",
-			PositionID:   "891c178b-3dbf-4f99-a8f0-99a86cb578b7",
-			CreationTime: orderTime(ts),
-			Price:        1500,
-			Quantity:     2,
-			Status:       "FILLED",
-			Type:         "MARKET",
-			Side:         "SELL",
+			ID:               "ef984be8-da66-4d52-b659-591b95d92591",
+			SymbolID:         "125240c0-7f7f-4d0f-b30d-939fd93cf027",
+			PositionID:       "891c178b-3dbf-4f99-a8f0-99a86cb578b7",
+			CreationTime:     orderTime(ts),
+			Price:            1500,
+			Quantity:         2,
+			Status:           "FILLED",
+			Type:             "MARKET",
+			Side:             "SELL",
+			ExecutedQuantity: 2,
 		}
 
 		if diff := cmp.Diff(odr1, odrs[0]); diff != "" {
 			t.Fatalf("\t%s\tTest %d:\tShould get back the same order. Diff:\n%s", dbtest.Failed, testID, diff)
 		}
 		t.Logf("\t%s\tTest %d:\tShould get back the same order.", dbtest.Success, testID)
+
+		pnl, err := core.PnL(ctx, seedPos)
+		if err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould be able to compute the position P&L : %s.", dbtest.Failed, testID, err)
+		}
+		t.Logf("\t%s\tTest %d:\tShould be able to compute the position P&L.", dbtest.Success, testID)
+
+		if pnl.Realized != -200 || pnl.Unrealized != 0 || len(pnl.Orders) != 2 {
+			t.Fatalf("\t%s\tTest %d:\tShould lose 200 buying back higher than it sold : %+v.", dbtest.Failed, testID, pnl)
+		}
+		t.Logf("\t%s\tTest %d:\tShould lose 200 buying back higher than it sold.", dbtest.Success, testID)
 	}
 }
+
+// neverFills accepts every order and leaves it NEW, as binance reports the
+// orders placed in dry-run mode.
+type neverFills struct {
+	broker.Exchange
+	placed []broker.OrderRequest
+}
+
+func (nf *neverFills) PlaceOrder(ctx context.Context, or broker.OrderRequest) (broker.OrderResult, error) {
+	nf.placed = append(nf.placed, or)
+	return broker.OrderResult{
+		Symbol:        or.Symbol,
+		OrderID:       int64(len(nf.placed)),
+		ClientOrderID: or.ClientOrderID,
+		OrigQuantity:  or.Quantity,
+		Status:        broker.OrderStatusNew,
+		Type:          or.Type,
+		Side:          or.Side,
+	}, nil
+}
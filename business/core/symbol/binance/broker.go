@@ -3,9 +3,7 @@ package binance
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
 
 	"github.com/lgarciaaco/machina-api/business/broker"
 	"go.uber.org/zap"
@@ -13,33 +11,24 @@ import (
 
 // Agent manages the set of API's for symbol access.
 type Agent struct {
-	log    *zap.SugaredLogger
-	broker broker.Broker
+	log      *zap.SugaredLogger
+	exchange broker.Exchange
 }
 
 // NewAgent constructs a data for api access.
-func NewAgent(log *zap.SugaredLogger, brk broker.Broker) Agent {
+func NewAgent(log *zap.SugaredLogger, exg broker.Exchange) Agent {
 	return Agent{
-		log:    log,
-		broker: brk,
+		log:      log,
+		exchange: exg,
 	}
 }
 
 // QueryBySymbol fetch a symbol from binance api
 func (a Agent) QueryBySymbol(cxt context.Context, sbl string) (or Symbol, err error) {
-	bncResp, err := a.broker.Request(cxt, http.MethodGet, "exchangeInfo",
-		"symbol", sbl)
+	sis, err := a.exchange.ExchangeInfo(cxt, sbl)
 	if err != nil {
 		return Symbol{}, fmt.Errorf("fetching exchange info %w", err)
 	}
 
-	type exchangeInfo struct {
-		Symbols []Symbol `json:"symbols"`
-	}
-	var ei exchangeInfo
-	if err := json.NewDecoder(bncResp).Decode(&ei); err != nil {
-		return Symbol{}, fmt.Errorf("decoding exchange info %w", err)
-	}
-
-	return ei.Symbols[0], nil
+	return toSymbol(sis[0]), nil
 }
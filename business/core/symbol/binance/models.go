@@ -1,18 +1,65 @@
 package binance
 
+import "github.com/lgarciaaco/machina-api/business/broker"
+
 type Symbol struct {
-	ID                         string `json:"symbol_id"`
-	Symbol                     string `json:"symbol"`
-	Status                     string `json:"status"`
-	BaseAsset                  string `json:"baseAsset"`
-	BaseAssetPrecision         int    `json:"baseAssetPrecision"`
-	QuoteAsset                 string `json:"quoteAsset"`
-	QuotePrecision             int    `json:"quotePrecision"`
-	BaseCommissionPrecision    int    `json:"baseCommissionPrecision"`
-	QuoteCommissionPrecision   int    `json:"quoteCommissionPrecision"`
-	IcebergAllowed             bool   `json:"icebergAllowed"`
-	OcoAllowed                 bool   `json:"ocoAllowed"`
-	QuoteOrderQtyMarketAllowed bool   `json:"quoteOrderQtyMarketAllowed"`
-	IsSpotTradingAllowed       bool   `json:"isSpotTradingAllowed"`
-	IsMarginTradingAllowed     bool   `json:"isMarginTradingAllowed"`
+	ID                         string  `json:"symbol_id"`
+	Symbol                     string  `json:"symbol"`
+	Status                     string  `json:"status"`
+	BaseAsset                  string  `json:"baseAsset"`
+	BaseAssetPrecision         int     `json:"baseAssetPrecision"`
+	QuoteAsset                 string  `json:"quoteAsset"`
+	QuotePrecision             int     `json:"quotePrecision"`
+	BaseCommissionPrecision    int     `json:"baseCommissionPrecision"`
+	QuoteCommissionPrecision   int     `json:"quoteCommissionPrecision"`
+	IcebergAllowed             bool    `json:"icebergAllowed"`
+	OcoAllowed                 bool    `json:"ocoAllowed"`
+	QuoteOrderQtyMarketAllowed bool    `json:"quoteOrderQtyMarketAllowed"`
+	IsSpotTradingAllowed       bool    `json:"isSpotTradingAllowed"`
+	IsMarginTradingAllowed     bool    `json:"isMarginTradingAllowed"`
+	MinPrice                   float64 `json:"minPrice"`
+	MaxPrice                   float64 `json:"maxPrice"`
+	TickSize                   float64 `json:"tickSize"`
+	MinQty                     float64 `json:"minQty"`
+	MaxQty                     float64 `json:"maxQty"`
+	StepSize                   float64 `json:"stepSize"`
+	MinNotional                float64 `json:"minNotional"`
+	MaxNotional                float64 `json:"maxNotional"`
+	ApplyMinToMarket           bool    `json:"applyMinToMarket"`
+	ApplyMaxToMarket           bool    `json:"applyMaxToMarket"`
+	MarketMinQty               float64 `json:"marketMinQty"`
+	MarketMaxQty               float64 `json:"marketMaxQty"`
+	MarketStepSize             float64 `json:"marketStepSize"`
+}
+
+// toSymbol converts the trading rules returned by the exchange into a symbol.
+func toSymbol(si broker.SymbolInfo) Symbol {
+	return Symbol{
+		Symbol:                     si.Symbol,
+		Status:                     si.Status,
+		BaseAsset:                  si.BaseAsset,
+		BaseAssetPrecision:         si.BaseAssetPrecision,
+		QuoteAsset:                 si.QuoteAsset,
+		QuotePrecision:             si.QuotePrecision,
+		BaseCommissionPrecision:    si.BaseCommissionPrecision,
+		QuoteCommissionPrecision:   si.QuoteCommissionPrecision,
+		IcebergAllowed:             si.IcebergAllowed,
+		OcoAllowed:                 si.OcoAllowed,
+		QuoteOrderQtyMarketAllowed: si.QuoteOrderQtyMarketAllowed,
+		IsSpotTradingAllowed:       si.IsSpotTradingAllowed,
+		IsMarginTradingAllowed:     si.IsMarginTradingAllowed,
+		MinPrice:                   si.MinPrice,
+		MaxPrice:                   si.MaxPrice,
+		TickSize:                   si.TickSize,
+		MinQty:                     si.MinQty,
+		MaxQty:                     si.MaxQty,
+		StepSize:                   si.StepSize,
+		MinNotional:                si.MinNotional,
+		MaxNotional:                si.MaxNotional,
+		ApplyMinToMarket:           si.ApplyMinToMarket,
+		ApplyMaxToMarket:           si.ApplyMaxToMarket,
+		MarketMinQty:               si.MarketMinQty,
+		MarketMaxQty:               si.MarketMaxQty,
+		MarketStepSize:             si.MarketStepSize,
+	}
 }
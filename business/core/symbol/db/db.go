@@ -50,10 +50,14 @@ func (s Agent) Create(ctx context.Context, sbl Symbol) error {
 	const q = `
 	INSERT INTO symbols
 		(symbol_id, symbol, status, base_asset, base_asset_precision, quote_asset, quote_precision, base_commission_precision, 
-		 quote_commission_precision, iceberg_allowed, oco_allowed, quote_order_qty_market_allowed, is_spot_trading_allowed, is_margin_trading_allowed)
+		 quote_commission_precision, iceberg_allowed, oco_allowed, quote_order_qty_market_allowed, is_spot_trading_allowed, is_margin_trading_allowed,
+		 min_price, max_price, tick_size, min_qty, max_qty, step_size, min_notional, max_notional, apply_min_to_market, apply_max_to_market,
+		 market_min_qty, market_max_qty, market_step_size)
 	VALUES
 		(:symbol_id, :symbol, :status, :base_asset, :base_asset_precision, :quote_asset, :quote_precision, :base_commission_precision, 
-		 :quote_commission_precision, :iceberg_allowed, :oco_allowed, :quote_order_qty_market_allowed, :is_spot_trading_allowed, :is_margin_trading_allowed)`
+		 :quote_commission_precision, :iceberg_allowed, :oco_allowed, :quote_order_qty_market_allowed, :is_spot_trading_allowed, :is_margin_trading_allowed,
+		 :min_price, :max_price, :tick_size, :min_qty, :max_qty, :step_size, :min_notional, :max_notional, :apply_min_to_market, :apply_max_to_market,
+		 :market_min_qty, :market_max_qty, :market_step_size)`
 
 	if err := database.NamedExecContext(ctx, s.log, s.db, q, sbl); err != nil {
 		return fmt.Errorf("inserting symbol: %w", err)
@@ -4,18 +4,31 @@ package db
 // When buying and selling a cryptocurrency, it is often swapped with local currency. For example,
 // If you're looking to buy or sell Bitcoin with U.S. Dollar, the trading pair would be BTC to USD
 type Symbol struct {
-	ID                         string `db:"symbol_id"`
-	Symbol                     string `db:"symbol"`
-	Status                     string `db:"status"`
-	BaseAsset                  string `db:"base_asset"`
-	BaseAssetPrecision         int    `db:"base_asset_precision"`
-	QuoteAsset                 string `db:"quote_asset"`
-	QuotePrecision             int    `db:"quote_precision"`
-	BaseCommissionPrecision    int    `db:"base_commission_precision"`
-	QuoteCommissionPrecision   int    `db:"quote_commission_precision"`
-	IcebergAllowed             bool   `db:"iceberg_allowed"`
-	OcoAllowed                 bool   `db:"oco_allowed"`
-	QuoteOrderQtyMarketAllowed bool   `db:"quote_order_qty_market_allowed"`
-	IsSpotTradingAllowed       bool   `db:"is_spot_trading_allowed"`
-	IsMarginTradingAllowed     bool   `db:"is_margin_trading_allowed"`
+	ID                         string  `db:"symbol_id"`
+	Symbol                     string  `db:"symbol"`
+	Status                     string  `db:"status"`
+	BaseAsset                  string  `db:"base_asset"`
+	BaseAssetPrecision         int     `db:"base_asset_precision"`
+	QuoteAsset                 string  `db:"quote_asset"`
+	QuotePrecision             int     `db:"quote_precision"`
+	BaseCommissionPrecision    int     `db:"base_commission_precision"`
+	QuoteCommissionPrecision   int     `db:"quote_commission_precision"`
+	IcebergAllowed             bool    `db:"iceberg_allowed"`
+	OcoAllowed                 bool    `db:"oco_allowed"`
+	QuoteOrderQtyMarketAllowed bool    `db:"quote_order_qty_market_allowed"`
+	IsSpotTradingAllowed       bool    `db:"is_spot_trading_allowed"`
+	IsMarginTradingAllowed     bool    `db:"is_margin_trading_allowed"`
+	MinPrice                   float64 `db:"min_price"`
+	MaxPrice                   float64 `db:"max_price"`
+	TickSize                   float64 `db:"tick_size"`
+	MinQty                     float64 `db:"min_qty"`
+	MaxQty                     float64 `db:"max_qty"`
+	StepSize                   float64 `db:"step_size"`
+	MinNotional                float64 `db:"min_notional"`
+	MaxNotional                float64 `db:"max_notional"`
+	ApplyMinToMarket           bool    `db:"apply_min_to_market"`
+	ApplyMaxToMarket           bool    `db:"apply_max_to_market"`
+	MarketMinQty               float64 `db:"market_min_qty"`
+	MarketMaxQty               float64 `db:"market_max_qty"`
+	MarketStepSize             float64 `db:"market_step_size"`
 }
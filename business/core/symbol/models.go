@@ -5,20 +5,33 @@ import (
 )
 
 type Symbol struct {
-	ID                         string `json:"symbol_id"`
-	Symbol                     string `json:"symbol"`
-	Status                     string `json:"status"`
-	BaseAsset                  string `json:"base_asset"`
-	BaseAssetPrecision         int    `json:"base_asset_precision"`
-	QuoteAsset                 string `json:"quote_asset"`
-	QuotePrecision             int    `json:"quote_precision"`
-	BaseCommissionPrecision    int    `json:"base_commission_precision"`
-	QuoteCommissionPrecision   int    `json:"quote_commission_precision"`
-	IcebergAllowed             bool   `json:"iceberg_allowed"`
-	OcoAllowed                 bool   `json:"oco_allowed"`
-	QuoteOrderQtyMarketAllowed bool   `json:"quote_order_qty_market_allowed"`
-	IsSpotTradingAllowed       bool   `json:"is_spot_trading_allowed"`
-	IsMarginTradingAllowed     bool   `json:"is_margin_trading_allowed"`
+	ID                         string  `json:"symbol_id"`
+	Symbol                     string  `json:"symbol"`
+	Status                     string  `json:"status"`
+	BaseAsset                  string  `json:"base_asset"`
+	BaseAssetPrecision         int     `json:"base_asset_precision"`
+	QuoteAsset                 string  `json:"quote_asset"`
+	QuotePrecision             int     `json:"quote_precision"`
+	BaseCommissionPrecision    int     `json:"base_commission_precision"`
+	QuoteCommissionPrecision   int     `json:"quote_commission_precision"`
+	IcebergAllowed             bool    `json:"iceberg_allowed"`
+	OcoAllowed                 bool    `json:"oco_allowed"`
+	QuoteOrderQtyMarketAllowed bool    `json:"quote_order_qty_market_allowed"`
+	IsSpotTradingAllowed       bool    `json:"is_spot_trading_allowed"`
+	IsMarginTradingAllowed     bool    `json:"is_margin_trading_allowed"`
+	MinPrice                   float64 `json:"min_price"`
+	MaxPrice                   float64 `json:"max_price"`
+	TickSize                   float64 `json:"tick_size"`
+	MinQty                     float64 `json:"min_qty"`
+	MaxQty                     float64 `json:"max_qty"`
+	StepSize                   float64 `json:"step_size"`
+	MinNotional                float64 `json:"min_notional"`
+	MaxNotional                float64 `json:"max_notional"`
+	ApplyMinToMarket           bool    `json:"apply_min_to_market"`
+	ApplyMaxToMarket           bool    `json:"apply_max_to_market"`
+	MarketMinQty               float64 `json:"market_min_qty"`
+	MarketMaxQty               float64 `json:"market_max_qty"`
+	MarketStepSize             float64 `json:"market_step_size"`
 }
 
 type NewSymbol struct {
@@ -34,10 +34,10 @@ type Core struct {
 }
 
 // NewCore constructs a core for user api access.
-func NewCore(log *zap.SugaredLogger, sqlxDB *sqlx.DB, broker broker.Broker) Core {
+func NewCore(log *zap.SugaredLogger, sqlxDB *sqlx.DB, exg broker.Exchange) Core {
 	return Core{
 		dbAgent:  db.NewAgent(log, sqlxDB),
-		bkrAgent: binance.NewAgent(log, broker),
+		bkrAgent: binance.NewAgent(log, exg),
 	}
 }
 
@@ -51,7 +51,10 @@ func (c Core) Create(ctx context.Context, nSbl NewSymbol) (Symbol, error) {
 	// Fetch symbol from binance
 	bkrSbl, err := c.bkrAgent.QueryBySymbol(ctx, nSbl.Symbol)
 	if err != nil {
-		return Symbol{}, ErrInvalidSymbol
+		if errors.Is(err, broker.ErrUnknownSymbol) {
+			return Symbol{}, ErrInvalidSymbol
+		}
+		return Symbol{}, fmt.Errorf("fetching symbol %s: %w", nSbl.Symbol, err)
 	}
 
 	// Insert symbol into database
@@ -31,7 +31,7 @@ func TestSymbol(t *testing.T) {
 	log, db, teardown := dbtest.NewUnit(t, c, "testsbl")
 	t.Cleanup(teardown)
 
-	core := NewCore(log, db, broker.TestBinance{})
+	core := NewCore(log, db, broker.NewBinance(broker.Config{}))
 
 	t.Log("Given the need to work with SymbolID records.")
 	{
@@ -80,7 +80,7 @@ func TestPagingSymbol(t *testing.T) {
 
 	dbschema.Seed(ctx, db)
 
-	candle := NewCore(log, db, broker.TestBinance{})
+	candle := NewCore(log, db, broker.NewBinance(broker.Config{}))
 
 	t.Log("Given the need to page through Symbols records.")
 	{
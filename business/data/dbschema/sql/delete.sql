@@ -2,4 +2,9 @@ DELETE FROM users;
 DELETE FROM positions;
 DELETE FROM candles;
 DELETE FROM symbols;
-DELETE FROM orders;
\ No newline at end of file
+DELETE FROM order_fills;
+DELETE FROM orders;
+DELETE FROM balances;
+DELETE FROM paper_balances;
+DELETE FROM paper_orders;
+DELETE FROM unknown_orders;
\ No newline at end of file
@@ -81,4 +81,162 @@ CREATE TABLE orders
     PRIMARY KEY (order_id),
     FOREIGN KEY (symbol_id) REFERENCES symbols (symbol_id),
     FOREIGN KEY (position_id) REFERENCES positions (position_id)
-);
\ No newline at end of file
+);
+
+-- Version: 1.3
+-- Description: Track broker order ids, executed quantities and balances
+ALTER TABLE orders
+    ADD COLUMN broker_order_id   BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN executed_quantity FLOAT  NOT NULL DEFAULT 0;
+
+-- Filled orders stored before this version executed their whole quantity.
+UPDATE orders SET executed_quantity = quantity WHERE status = 'FILLED';
+
+CREATE TABLE balances
+(
+    asset       TEXT,
+    free        FLOAT,
+    locked      FLOAT,
+    update_time TIMESTAMP,
+
+    PRIMARY KEY (asset)
+);
+
+-- Version: 1.4
+-- Description: Create tables of the paper trading broker
+CREATE TABLE paper_balances
+(
+    asset       TEXT,
+    free        FLOAT NOT NULL,
+    update_time TIMESTAMP,
+
+    PRIMARY KEY (asset)
+);
+
+CREATE TABLE paper_orders
+(
+    order_id          BIGSERIAL,
+    symbol            TEXT NOT NULL,
+    side              TEXT NOT NULL,
+    type              TEXT NOT NULL,
+    quantity          FLOAT NOT NULL,
+    price             FLOAT NOT NULL,
+    executed_quantity FLOAT NOT NULL,
+    cumulative_quote  FLOAT NOT NULL,
+    commission        FLOAT NOT NULL,
+    commission_asset  TEXT NOT NULL,
+    status            TEXT NOT NULL,
+    transact_time     TIMESTAMP,
+
+    PRIMARY KEY (order_id)
+);
+
+-- Version: 1.5
+-- Description: Store the limit price, stop price and time in force of orders
+ALTER TABLE orders
+    ADD COLUMN limit_price   FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN stop_price    FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN time_in_force TEXT  NOT NULL DEFAULT '';
+
+-- Version: 1.6
+-- Description: Track client order ids and orders only found on the exchange
+ALTER TABLE orders
+    ADD COLUMN client_order_id TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE paper_orders
+    ADD COLUMN client_order_id TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE unknown_orders
+(
+    symbol            TEXT,
+    broker_order_id   BIGINT,
+    client_order_id   TEXT,
+    side              TEXT,
+    type              TEXT,
+    status            TEXT,
+    price             FLOAT,
+    quantity          FLOAT,
+    executed_quantity FLOAT,
+    transact_time     TIMESTAMP,
+    detection_time    TIMESTAMP,
+
+    PRIMARY KEY (symbol, broker_order_id)
+);
+
+-- Version: 1.7
+-- Description: Store the fills of orders
+CREATE TABLE order_fills
+(
+    order_id         UUID,
+    trade_id         BIGINT,
+    price            FLOAT NOT NULL,
+    quantity         FLOAT NOT NULL,
+    commission       FLOAT NOT NULL,
+    commission_asset TEXT  NOT NULL,
+    trade_time       TIMESTAMP,
+
+    PRIMARY KEY (order_id, trade_id),
+    FOREIGN KEY (order_id) REFERENCES orders (order_id) ON DELETE CASCADE
+);
+
+-- Version: 1.8
+-- Description: Store the price, lot size and notional filters of symbols
+ALTER TABLE symbols
+    ADD COLUMN min_price        FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN max_price        FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN tick_size        FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN min_qty          FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN max_qty          FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN step_size        FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN min_notional     FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN market_min_qty   FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN market_max_qty   FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN market_step_size FLOAT NOT NULL DEFAULT 0;
+
+-- Version: 1.9
+-- Description: Store the quote quantity of orders
+ALTER TABLE orders
+    ADD COLUMN quote_quantity   FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN cumulative_quote FLOAT NOT NULL DEFAULT 0;
+
+-- Version: 2.0
+-- Description: Make order and position creation idempotent
+CREATE UNIQUE INDEX orders_client_order_id ON orders (client_order_id) WHERE client_order_id <> '';
+
+ALTER TABLE positions
+    ADD COLUMN idempotency_key TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX positions_idempotency_key ON positions (user_id, idempotency_key) WHERE idempotency_key <> '';
+
+-- Version: 2.1
+-- Description: Attach take profit and stop loss orders to positions
+ALTER TABLE positions
+    ADD COLUMN take_profit FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN stop_loss   FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN stop_limit  FLOAT NOT NULL DEFAULT 0;
+
+ALTER TABLE orders
+    ADD COLUMN leg           TEXT   NOT NULL DEFAULT '',
+    ADD COLUMN order_list_id BIGINT NOT NULL DEFAULT 0;
+
+CREATE UNIQUE INDEX orders_position_leg ON orders (position_id, leg) WHERE leg <> '';
+
+-- Version: 2.2
+-- Description: Trail a stop behind the best price of positions
+ALTER TABLE positions
+    ADD COLUMN trail_amount  FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN trail_percent FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN trail_peak    FLOAT NOT NULL DEFAULT 0;
+
+-- Version: 2.3
+-- Description: Replace the bracket of positions scaling in and out
+DROP INDEX orders_position_leg;
+CREATE UNIQUE INDEX orders_position_leg ON orders (position_id, leg)
+    WHERE leg <> '' AND status IN ('PENDING', 'NEW', 'PARTIALLY_FILLED');
+
+-- Version: 2.4
+-- Description: Store the maximum notional of symbols and whether the notional filters apply to MARKET orders
+ALTER TABLE symbols
+    ADD COLUMN max_notional        FLOAT   NOT NULL DEFAULT 0,
+    ADD COLUMN apply_min_to_market BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN apply_max_to_market BOOLEAN NOT NULL DEFAULT FALSE;
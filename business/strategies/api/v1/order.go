@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/hashicorp/go-retryablehttp"
 )
 
@@ -24,11 +25,16 @@ type Order struct {
 	Side         string    `json:"side"`
 }
 
-// NewOrder contains information needed to create a new Order.
+// NewOrder contains information needed to create a new Order. QuoteQuantity
+// spends or receives an amount of the quote asset instead of a quantity of
+// the base asset. Round asks the api to round the quantity down to the step
+// size of the symbol.
 type NewOrder struct {
-	PositionID string  `json:"position_id"`
-	Quantity   float64 `json:"quantity"`
-	Side       string  `json:"side"`
+	PositionID    string  `json:"position_id"`
+	Quantity      float64 `json:"quantity,omitempty"`
+	QuoteQuantity float64 `json:"quote_quantity,omitempty"`
+	Side          string  `json:"side"`
+	Round         bool    `json:"round"`
 }
 
 func (c *Client) CreateOrder(no NewOrder) (o *Order, err error) {
@@ -42,9 +48,11 @@ func (c *Client) CreateOrder(no NewOrder) (o *Order, err error) {
 		return nil, err
 	}
 
-	// Set authentication headers
+	// Set authentication headers, retries of the request share the
+	// idempotency key so they can't create twice
 	req.Header = map[string][]string{
-		"Authorization": {fmt.Sprintf("Bearer %s", c.token)},
+		"Authorization":   {fmt.Sprintf("Bearer %s", c.token)},
+		"Idempotency-Key": {uuid.NewString()},
 	}
 	resp, err := c.Do(&retryablehttp.Request{Request: req})
 	if err != nil {
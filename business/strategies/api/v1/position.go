@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/hashicorp/go-retryablehttp"
 )
 
@@ -21,7 +22,20 @@ type Position struct {
 	CreationTime time.Time `json:"creation_time"` // CreationTime of the position
 	User         string    `json:"user"`          // Name of the owner
 	Symbol       string    `json:"symbol"`        // Symbol this position is trading on
+	NetQuantity  float64   `json:"net_quantity"`  // Quantity the entry orders filled minus the quantity the exit orders filled
+	EntryPrice   float64   `json:"entry_price"`   // Average price of the entry orders, weighted by the quantity they filled
+	Exposure     float64   `json:"exposure"`      // Net quantity valued at the last price
 	Orders       []Order   `json:"orders"`        // Orders belonging to this position
+	PnL          *PnL      `json:"pnl"`           // Profit and loss of the position
+}
+
+// PnL represents the profit and loss of a position in its quote asset
+type PnL struct {
+	Realized      float64 `json:"realized"`       // Profit of the quantity the position exited
+	Unrealized    float64 `json:"unrealized"`     // Profit of the quantity held at the last price
+	Fees          float64 `json:"fees"`           // Commissions charged for the orders
+	Net           float64 `json:"net"`            // Realized and unrealized profit minus the fees
+	ReturnPercent float64 `json:"return_percent"` // Net profit as a percent of the entry cost
 }
 
 // NewPosition contains information needed to create a new position
@@ -72,7 +86,7 @@ func (c *Client) ListPositions() (p []Position, err error) {
 
 // RetrievePosition return the last position belonging to this username
 func (c *Client) RetrievePosition() (p *Position, err error) {
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s%s", c.TraderAPI, "/v1/positions/1/1"), nil)
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s%s", c.TraderAPI, "/v1/positions/1/1?sort=creation_time&direction=desc"), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -107,7 +121,7 @@ func (c *Client) RetrievePosition() (p *Position, err error) {
 		return nil, nil
 	}
 
-	return &pos[len(pos)-1], nil
+	return &pos[0], nil
 }
 
 // CreatePosition do a POST to the trader api and Creates a position
@@ -122,9 +136,11 @@ func (c *Client) CreatePosition(np NewPosition, quantity float64) (p *Position,
 		return nil, err
 	}
 
-	// Set authentication headers
+	// Set authentication headers, retries of the request share the
+	// idempotency key so they can't create twice
 	req.Header = map[string][]string{
-		"Authorization": {fmt.Sprintf("Bearer %s", c.token)},
+		"Authorization":   {fmt.Sprintf("Bearer %s", c.token)},
+		"Idempotency-Key": {uuid.NewString()},
 	}
 	resp, err := c.Do(&retryablehttp.Request{Request: req})
 	if err != nil {
@@ -151,6 +167,7 @@ func (c *Client) CreatePosition(np NewPosition, quantity float64) (p *Position,
 		PositionID: pos.ID,
 		Quantity:   quantity,
 		Side:       pos.Side,
+		Round:      true,
 	}
 	odr, err := c.CreateOrder(nOdr)
 	if err != nil {
@@ -88,7 +88,7 @@ func (b *FixBudget) Open(p Position, c Candle) (float64, error) {
 
 // Close will close an order and adjust Budgeter and order details
 func (b *FixBudget) Close(p Position, c Candle) error {
-	if p.Status == "closed" {
+	if p.Status == "CLOSED" {
 		return fmt.Errorf("can't close an order that is already closed")
 	}
 
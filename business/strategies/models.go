@@ -2,7 +2,6 @@
 package strategies
 
 import (
-	"fmt"
 	"time"
 
 	v1 "github.com/lgarciaaco/machina-api/business/strategies/api/v1"
@@ -81,22 +80,11 @@ type Position struct {
 	CreationTime time.Time `json:"creation_time"` // CreationTime of the position
 	User         string    `json:"user"`          // Name of the owner
 	Symbol       string    `json:"symbol"`        // Symbol this position is trading on
+	NetQuantity  float64   `json:"net_quantity"`  // Quantity the entry orders filled minus the quantity the exit orders filled
+	EntryPrice   float64   `json:"entry_price"`   // Average price of the entry orders, weighted by the quantity they filled
+	Exposure     float64   `json:"exposure"`      // Net quantity valued at the last price
 	Orders       []Order   `json:"orders"`        // Orders belonging to this position
-}
-
-// close return the order to close a position.
-func (p *Position) close() (Order, error) {
-	if len(p.Orders) != 1 {
-		return Order{}, fmt.Errorf("wrong orders.len, need 1 but got %d", len(p.Orders))
-	}
-	rOdr := p.Orders[0]
-
-	rOdr.Side = financial.SideBuy
-	if p.Side == financial.SideBuy {
-		rOdr.Side = financial.SideSell
-	}
-
-	return rOdr, nil
+	PnL          *v1.PnL   `json:"pnl"`           // Profit and loss reported by the api, nil for local positions
 }
 
 func toPosition(v1Pos *v1.Position) *Position {
@@ -109,19 +97,32 @@ func toPosition(v1Pos *v1.Position) *Position {
 		CreationTime: v1Pos.CreationTime,
 		User:         v1Pos.User,
 		Symbol:       v1Pos.Symbol,
+		NetQuantity:  v1Pos.NetQuantity,
+		EntryPrice:   v1Pos.EntryPrice,
+		Exposure:     v1Pos.Exposure,
 		Orders:       toOrderSlice(v1Pos.Orders),
+		PnL:          v1Pos.PnL,
 	}
 }
 
+// Profit returns the profit of a closed position in the quote asset. It is the
+// realized P&L the api reports, or the quote received selling minus the quote
+// spent buying for positions the api doesn't know of.
 func (p Position) Profit() float64 {
-	var profit float64
-	if p.Status == "closed" && len(p.Orders) == 2 {
-		if p.Side == broker.OrderSideBuy {
-			profit = (p.Orders[1].Price * p.Orders[1].Quantity) - (p.Orders[0].Price * p.Orders[0].Quantity)
-		}
+	if p.Status != "CLOSED" {
+		return 0
+	}
+	if p.PnL != nil {
+		return p.PnL.Realized
+	}
 
-		if p.Side == broker.OrderSideSell {
-			profit = (p.Orders[0].Price * p.Orders[0].Quantity) - (p.Orders[1].Price * p.Orders[1].Quantity)
+	var profit float64
+	for _, o := range p.Orders {
+		switch o.Side {
+		case broker.OrderSideSell:
+			profit += o.Price * o.Quantity
+		case broker.OrderSideBuy:
+			profit -= o.Price * o.Quantity
 		}
 	}
 
@@ -64,7 +64,7 @@ func (s *ToAPI) Trade(done <-chan bool, candles <-chan financial.Candle, rule fi
 				}
 
 				if pos != nil {
-					s.Log.Infof("trader : closed : %s [%s, %f, %f] | budget: %s", pos.ID, pos.Side, c.ClosePrice, pos.Orders[1].Quantity, s.Budget)
+					s.Log.Infof("trader : closed : %s [%s, %f, %f] | budget: %s", pos.ID, pos.Side, c.ClosePrice, pos.Orders[len(pos.Orders)-1].Quantity, s.Budget)
 				}
 			}
 		}
@@ -102,23 +102,8 @@ func (s *ToAPI) close(c financial.Candle) (p *Position, err error) {
 		return s.currentPosition, ErrNotSufficientFund
 	}
 
-	cOdr, err := s.currentPosition.close()
-	if err != nil {
-		return nil, err
-	}
-
-	nOdr := v1.NewOrder{
-		PositionID: s.currentPosition.ID,
-		Quantity:   cOdr.Quantity,
-		Side:       cOdr.Side,
-	}
-
-	_, err = s.Client.CreateOrder(nOdr)
-	if err != nil {
-		return nil, err
-	}
-
-	// call the trader api and close the position
+	// call the trader api and close the position, it places the order
+	// offsetting what the position holds
 	v1Pos, err := s.Client.ClosePosition(s.currentPosition.ID)
 	if err != nil {
 		return nil, err
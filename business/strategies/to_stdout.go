@@ -50,7 +50,7 @@ func (t *ToStdout) Trade(done <-chan bool, candles <-chan financial.Candle, rule
 func (t *ToStdout) open(p Position, c financial.Candle) error {
 	if len(t.positions) != 0 {
 		pos := t.positions[len(t.positions)-1]
-		if pos.Status != "closed" {
+		if pos.Status != "CLOSED" {
 			// we can't leave a position open, therefore we have to force close it
 			t.Log.Infof("force closing position")
 			t.close(c)
@@ -65,12 +65,12 @@ func (t *ToStdout) open(p Position, c financial.Candle) error {
 				Price:        c.ClosePrice,
 				Quantity:     t.Lot,
 				Type:         broker.OrderTypeMarket,
-				Side:         broker.OrderSideBuy,
+				Side:         p.Side,
 			},
 		},
 		Symbol: c.Symbol,
 		Side:   p.Side,
-		Status: "open",
+		Status: "OPEN",
 	})
 	return nil
 }
@@ -78,19 +78,38 @@ func (t *ToStdout) open(p Position, c financial.Candle) error {
 func (t *ToStdout) close(c financial.Candle) error {
 	if len(t.positions) != 0 {
 		pos := t.positions[len(t.positions)-1]
-		if len(pos.Orders) != 1 {
-			return fmt.Errorf("can't close position with len(orders) != 1")
+		if pos.Status == "CLOSED" {
+			return fmt.Errorf("can't close a position that is already closed")
+		}
+
+		// Orders on the side of the position add to what it holds, the
+		// others take from it.
+		var net float64
+		for _, o := range pos.Orders {
+			if o.Side == pos.Side {
+				net += o.Quantity
+			} else {
+				net -= o.Quantity
+			}
+		}
+		pos.Status = "CLOSED"
+		if net <= 0 {
+			return nil
+		}
+
+		side := broker.OrderSideSell
+		if pos.Side == broker.OrderSideSell {
+			side = broker.OrderSideBuy
 		}
 
 		pos.Orders = append(pos.Orders, Order{
 			CreationTime: c.OpenTime,
 			SymbolID:     c.SymbolID,
 			Price:        c.ClosePrice,
-			Quantity:     t.Lot,
+			Quantity:     net,
 			Type:         broker.OrderTypeMarket,
-			Side:         broker.OrderSideSell,
+			Side:         side,
 		})
-		pos.Status = "closed"
 	}
 
 	return nil
@@ -99,13 +118,13 @@ func (t *ToStdout) close(c financial.Candle) error {
 func (t *ToStdout) Profit() float64 {
 	var total float64
 	for i, p := range t.positions {
-		if p.Status == "closed" {
+		if p.Status == "CLOSED" {
 			t.Log.Infof("Position [OPEN %s, CLOSE %s] : [type: %s, open: %f, close %f], Profit for operation %d: %f",
 				p.Orders[0].CreationTime.Format("Mon Jan 2 15:04"),
-				p.Orders[1].CreationTime.Format("Mon Jan 2 15:04"),
+				p.Orders[len(p.Orders)-1].CreationTime.Format("Mon Jan 2 15:04"),
 				p.Side,
 				p.Orders[0].Price*p.Orders[0].Quantity,
-				p.Orders[1].Price*p.Orders[1].Quantity,
+				p.Orders[len(p.Orders)-1].Price*p.Orders[len(p.Orders)-1].Quantity,
 				i, p.Profit())
 
 			total += p.Profit()
@@ -12,7 +12,7 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/lgarciaaco/machina-api/foundation/web"
-	_ "github.com/lib/pq" // Calls init function.
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
@@ -22,6 +22,9 @@ var (
 	ErrDBDuplicatedEntry = errors.New("duplicated entry")
 )
 
+// uniqueViolation is the postgres error code of a duplicated unique key.
+const uniqueViolation = "23505"
+
 // Config is the required properties to use the database.
 type Config struct {
 	User         string
@@ -147,6 +150,10 @@ func NamedExecContext(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtCo
 	log.Infow("database.NamedExecContext", "traceid", web.GetTraceID(ctx), "query", q)
 
 	if _, err := sqlx.NamedExecContext(ctx, db, query, data); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return ErrDBDuplicatedEntry
+		}
 		return err
 	}
 
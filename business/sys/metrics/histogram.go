@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in milliseconds, of the latency
+// histogram buckets.
+var latencyBuckets = []int64{10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// histogram is an expvar.Var counting observations into cumulative buckets.
+// It is safe to be accessed concurrently.
+type histogram struct {
+	mu      sync.Mutex
+	buckets []int64
+	counts  []int64
+	count   int64
+	sum     int64
+}
+
+// newHistogram constructs an empty histogram with the latency buckets.
+func newHistogram() *histogram {
+	return &histogram{
+		buckets: latencyBuckets,
+		counts:  make([]int64, len(latencyBuckets)),
+	}
+}
+
+// observe records a duration into the histogram.
+func (h *histogram) observe(d time.Duration) {
+	ms := d.Milliseconds()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.count++
+	h.sum += ms
+	for i, le := range h.buckets {
+		if ms <= le {
+			h.counts[i]++
+		}
+	}
+}
+
+// String implements the expvar.Var interface.
+func (h *histogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buckets := make(map[string]int64, len(h.buckets))
+	for i, le := range h.buckets {
+		buckets["le_"+strconv.FormatInt(le, 10)] = h.counts[i]
+	}
+
+	data := struct {
+		Count   int64            `json:"count"`
+		SumMS   int64            `json:"sum_ms"`
+		Buckets map[string]int64 `json:"buckets"`
+	}{
+		Count:   h.count,
+		SumMS:   h.sum,
+		Buckets: buckets,
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
@@ -5,6 +5,8 @@ import (
 	"context"
 	"expvar"
 	"runtime"
+	"sync"
+	"time"
 )
 
 // This holds the single instance of the metrics value needed for
@@ -22,6 +24,10 @@ type metrics struct {
 	requests   *expvar.Int
 	errors     *expvar.Int
 	panics     *expvar.Int
+
+	mu            sync.Mutex
+	brokerLatency *expvar.Map
+	brokerErrors  *expvar.Map
 }
 
 // init constructs the metrics value that will be used to capture metrics.
@@ -34,6 +40,9 @@ func init() {
 		requests:   expvar.NewInt("requests"),
 		errors:     expvar.NewInt("errors"),
 		panics:     expvar.NewInt("panics"),
+
+		brokerLatency: expvar.NewMap("broker_latency"),
+		brokerErrors:  expvar.NewMap("broker_errors"),
 	}
 }
 
@@ -87,3 +96,24 @@ func AddPanics(ctx context.Context) {
 		v.panics.Add(1)
 	}
 }
+
+// The broker is called outside of web requests, by the synchronizer for
+// example, so its metrics don't depend on the context.
+
+// AddBrokerLatency records the latency of a broker call to the endpoint.
+func AddBrokerLatency(endpoint string, d time.Duration) {
+	m.mu.Lock()
+	h, ok := m.brokerLatency.Get(endpoint).(*histogram)
+	if !ok {
+		h = newHistogram()
+		m.brokerLatency.Set(endpoint, h)
+	}
+	m.mu.Unlock()
+
+	h.observe(d)
+}
+
+// AddBrokerErrors increments the broker errors metric for the endpoint by 1.
+func AddBrokerErrors(endpoint string) {
+	m.brokerErrors.Add(endpoint, 1)
+}
@@ -1,7 +1,24 @@
 // Package v1 represents types used by the web application for v1.
 package v1
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// IdempotencyKeyHeader is the header clients set to retry a create request
+// without creating twice.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// ErrInvalidIdempotencyKey is returned when the idempotency key of a request
+// is not in its proper form.
+var ErrInvalidIdempotencyKey = errors.New("idempotency key must be 1 to 36 letters, digits or .:/_- characters")
+
+// idempotencyKey is the format binance accepts for client order ids.
+var idempotencyKey = regexp.MustCompile(`^[.A-Za-z0-9:/_-]{1,36}$`)
 
 // ErrorResponse is the form used for API responses from failures in the API.
 type ErrorResponse struct {
@@ -34,6 +51,34 @@ func IsRequestError(err error) bool {
 	return errors.As(err, &re)
 }
 
+// IdempotencyKey returns the idempotency key of the request, empty when the
+// client didn't send one. Keys are sent to binance as client order ids, so
+// they have to follow the same format.
+func IdempotencyKey(r *http.Request) (string, error) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key == "" {
+		return "", nil
+	}
+	if !idempotencyKey.MatchString(key) {
+		return "", NewRequestError(ErrInvalidIdempotencyKey, http.StatusBadRequest)
+	}
+	return key, nil
+}
+
+// QueryTime returns the RFC3339 time of a query parameter, the zero time when
+// the client didn't send it.
+func QueryTime(r *http.Request, key string) (time.Time, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, NewRequestError(fmt.Errorf("invalid %s format, %s[%s]", key, key, v), http.StatusBadRequest)
+	}
+	return t, nil
+}
+
 // GetRequestError returns a copy of the RequestError pointer.
 func GetRequestError(err error) *RequestError {
 	var re *RequestError